@@ -4,10 +4,13 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -16,7 +19,9 @@ import (
 	"github.com/rs/zerolog/log"
 
 	"channelog/config"
+	"channelog/filters"
 	"channelog/models"
+	"channelog/queue"
 	"channelog/service"
 )
 
@@ -99,8 +104,56 @@ func main() {
 		log.Fatal().Err(err).Msg("failed to load configuration")
 	}
 
-	openaiService := models.NewOpenAIService(cfg)
-	log.Info().Msg("OpenAI service initialized")
+	// "channelog migrate-layout" moves an existing repository to the resource layout and exits.
+	if flag.Arg(0) == "migrate-layout" {
+		migrateLayout(cfg)
+		return
+	}
+
+	// Filter rules are validated up front so a broken rules file fails fast.
+	rules, err := filters.LoadRules(cfg.FilterRulesFile)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to load filter rules")
+	}
+	redaction := filters.NewRedactionFilterCondition(rules, []byte(cfg.RedactionHashKey))
+	if redaction.Enabled() && !redaction.Keyed() {
+		// Unkeyed hashes of short values such as passwords can be reversed by
+		// hashing guesses, and the hashes end up in git and the model prompt.
+		log.Warn().Msg("REDACTION_HASH_KEY is not set: redacted values are hashed with plain SHA-256 and short secrets " +
+			"can be recovered from the changelog by brute force; set REDACTION_HASH_KEY to a random secret")
+	}
+
+	summarizer, err := models.NewSummarizer(cfg, redaction.RedactValue)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to create summarizer")
+	}
+	log.Info().Str("provider", cfg.LLMProvider).Msg("summarizer initialized")
+
+	// A single GitService keeps the clone alive and serializes all commits.
+	gitService := service.NewGitService(cfg)
+
+	changelogService := service.NewChangelogService(cfg, summarizer, gitService, rules)
+
+	// Durable queue between admission and changelog generation; pending items
+	// from a previous run are replayed on start.
+	// Correlated changes, such as those of one Helm upgrade, arriving within
+	// the batch window are recorded in one commit.
+	changelogQueue, err := queue.New(cfg.QueueDir, changelogService.ProcessBatch, queue.Options{
+		Capacity:     cfg.QueueCapacity,
+		Overflow:     queue.OverflowPolicy(cfg.QueueOverflowPolicy),
+		Merge:        service.NewItemCoalescer(rules),
+		MaxAttempts:  cfg.QueueMaxAttempts,
+		RetryBackoff: cfg.QueueRetryBackoff,
+		BatchWindow:  cfg.BatchWindow,
+		BatchKey:     service.NewBatchKeyFunc(),
+		BatchMax:     cfg.BatchMaxSize,
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to open changelog queue")
+	}
+	if err := changelogQueue.Start(cfg.QueueWorkers); err != nil {
+		log.Fatal().Err(err).Msg("failed to start changelog queue")
+	}
 
 	// Set up the Fiber HTTP server with panic recovery middleware.
 	app := fiber.New()
@@ -111,16 +164,70 @@ func main() {
 		return service.LivenessService(c, cfg)
 	})
 
+	// Queue and pipeline metrics in the Prometheus text format.
+	app.Get("/metrics", service.MetricsService)
+
 	// Register admission channelog endpoints.
 	app.Post(("/validate"), func(c *fiber.Ctx) error {
-		return service.CommitService(c, cfg, openaiService)
+		return service.CommitService(c, cfg, rules, redaction, changelogQueue)
 	})
 
+	// Stop on SIGTERM from the kubelet, or SIGINT, without cutting a commit
+	// or push short.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// Start listening with TLS, using the ADDR environment variable if set.
 	listenAddr := getEnv("ADDR", *addr)
-	if err := app.ListenTLS(listenAddr, *certFile, *keyFile); err != nil {
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- app.ListenTLS(listenAddr, *certFile, *keyFile)
+	}()
+
+	select {
+	case err := <-serverErr:
 		log.Fatal().Err(err).Msg("failed to start HTTPS server")
+	case <-ctx.Done():
+	}
+	log.Info().Msg("shutting down")
+
+	// Stop accepting admission requests first, then let the queue workers
+	// finish and acknowledge their items, so that no committed change is
+	// replayed after the restart, and finally stop the GitService they
+	// commit through. Waiting items stay on disk for the next start.
+	if err := app.Shutdown(); err != nil {
+		log.Error().Err(err).Msg("failed to shut down HTTPS server")
+	}
+	changelogQueue.Stop()
+	gitService.Stop()
+	log.Info().Msg("shutdown complete")
+}
+
+// migrateLayout moves the timestamped changelog files of the repository to
+// the resource layout in one commit
+func migrateLayout(cfg *config.Config) {
+	if cfg.ChangelogLayout != config.LayoutResource {
+		log.Warn().
+			Str("layout", cfg.ChangelogLayout).
+			Msg("CHANGELOG_LAYOUT is not resource; new entries will still be written in the old layout")
+	}
+
+	gitService := service.NewGitService(cfg)
+	defer gitService.Stop()
+
+	result, err := gitService.MigrateLayout()
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to migrate changelog repository")
+	}
+	for _, file := range result.Skipped {
+		log.Warn().Str("file", file).Msg("left file in place, the API group of its kind is unknown")
 	}
+	log.Info().
+		Int("migrated", result.Migrated).
+		Int("resources", result.Resources).
+		Int("skipped", len(result.Skipped)).
+		Str("mode", cfg.ResourceFileMode).
+		Msg("changelog repository migrated")
 }
 
 // getEnv returns the environment variable value if set, or the provided fallback.
@@ -5,9 +5,38 @@ package config
 import (
 	"fmt"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+
+	"channelog/helpers"
+)
+
+// LLM providers selectable with LLM_PROVIDER; rules writes entries from the
+// diff without a model
+const (
+	ProviderOpenAI    = "openai"
+	ProviderAnthropic = "anthropic"
+	ProviderOllama    = "ollama"
+	ProviderRules     = "rules"
+)
+
+// Repository layouts selectable with CHANGELOG_LAYOUT: a new timestamped file
+// per change, or one file per resource
+const (
+	LayoutTimestamped = "timestamped"
+	LayoutResource    = "resource"
+)
+
+// How CHANGELOG_RESOURCE_FILE_MODE updates the file of a resource in the
+// resource layout
+const (
+	ResourceFileAppend  = "append"
+	ResourceFileRewrite = "rewrite"
 )
 
 // Config holds all of the application's settings sourced from environment variables.
@@ -33,6 +62,30 @@ type Config struct {
 	// If provided, will be used for HTTPS authentication
 	GitToken string
 
+	// GitAuthorFromUser records the Kubernetes user as the commit author
+	// while the committer stays Username/UserEmail
+	GitAuthorFromUser bool
+
+	// GitAuthorEmailTemplate builds the author email of human users
+	// Example: "{user}@corp.example"
+	GitAuthorEmailTemplate string
+
+	// GitAuthorServiceAccountEmail builds the author email of service accounts;
+	// when empty, service accounts are committed as the bot identity
+	// Example: "{name}@{namespace}.serviceaccount.cluster.local"
+	GitAuthorServiceAccountEmail string
+
+	// GitAuthorMap maps Kubernetes usernames to "Name <email>" or a bare email,
+	// loaded from the YAML file at GIT_AUTHOR_MAP_FILE
+	GitAuthorMap map[string]string
+
+	// GitPushMaxRetries is how many times a rejected push is rebased and retried
+	// before the commit is given up
+	GitPushMaxRetries int
+
+	// GitPushRetryBackoff is the initial delay between push retries; it doubles on every attempt
+	GitPushRetryBackoff time.Duration
+
 	// OpenAI configuration
 	// OpenAIApiUrl is the OpenAI API base URL
 	OpenAIApiUrl string
@@ -46,8 +99,132 @@ type Config struct {
 	// UserMessageTemplate is the template for user messages with placeholders
 	UserMessageTemplate string
 
-	// OpenAITimeout is the timeout for OpenAI requests
+	// DeleteMessageTemplate is the template for user messages about deleted resources
+	// Falls back to UserMessageTemplate when empty
+	DeleteMessageTemplate string
+
+	// ClusterName identifies the cluster in prompt templates (optional)
+	ClusterName string
+
+	// PromptProfiles select other prompts by kind, namespace or labels; the
+	// first matching profile is used and the prompts above otherwise
+	PromptProfiles []PromptProfile
+
+	// OpenAITimeout is the timeout for a single model request of every provider
 	OpenAITimeout time.Duration
+
+	// LLMMaxRetries is how many times a model request failing with a rate
+	// limit, server error, timeout or network error is retried
+	LLMMaxRetries int
+
+	// LLMRetryBackoff is the initial, jittered delay between model request
+	// retries; it doubles per retry up to LLMMaxRetryBackoff
+	LLMRetryBackoff time.Duration
+
+	// LLMMaxRetryBackoff caps the retry delay; a longer Retry-After fails the request
+	LLMMaxRetryBackoff time.Duration
+
+	// LLMRequestsPerMinute and LLMTokensPerMinute limit the rate of model
+	// requests on the client side; zero means unlimited
+	LLMRequestsPerMinute int
+	LLMTokensPerMinute   int
+
+	// LLMBreakerFailures is the number of consecutive failed model requests
+	// that opens the circuit breaker; zero disables it
+	LLMBreakerFailures int
+
+	// LLMBreakerCooldown is how long the open circuit breaker rejects requests
+	// before probing the provider again
+	LLMBreakerCooldown time.Duration
+
+	// LLMPromptTokenBudget is the estimated number of tokens a prompt may use;
+	// larger prompts are reduced. Zero means unlimited.
+	LLMPromptTokenBudget int
+
+	// LLMCacheSize is how many changelog entries the response cache keeps in
+	// memory; zero disables the memory tier
+	LLMCacheSize int
+
+	// LLMCacheDir keeps every cached changelog entry on disk as well (optional)
+	// Example: "/var/lib/channelog/cache"
+	LLMCacheDir string
+
+	// LLMProvider selects the API that generates changelog entries
+	// One of: "openai", "anthropic", "ollama", "rules"
+	LLMProvider string
+
+	// LLMFallback writes a rule-based entry when the model fails, instead of
+	// retrying the change later
+	LLMFallback bool
+
+	// AnthropicApiUrl is the Anthropic API base URL
+	AnthropicApiUrl string
+
+	// AnthropicApiKey authenticates requests to the Anthropic API
+	AnthropicApiKey string
+
+	// AnthropicModel is the model name to use for Anthropic requests
+	AnthropicModel string
+
+	// AnthropicMaxTokens bounds the length of Anthropic responses
+	AnthropicMaxTokens int
+
+	// OllamaApiUrl is the base URL of the Ollama server
+	// Example: "http://ollama.ollama.svc:11434"
+	OllamaApiUrl string
+
+	// OllamaModel is the model name to use for Ollama requests
+	OllamaModel string
+
+	// FilterRulesFile is the YAML file declaring include/exclude rules and
+	// fields to strip before diffing (optional)
+	// Example: "/etc/channelog/filters/rules.yaml"
+	FilterRulesFile string
+
+	// RedactionHashKey keys the hashes that replace redacted values, so short
+	// values cannot be recovered by hashing guesses (optional)
+	RedactionHashKey string
+
+	// QueueDir is the directory holding the durable changelog queue
+	// Example: "/var/lib/channelog/queue" (backed by a PersistentVolume)
+	QueueDir string
+
+	// QueueMaxAttempts is how many times a queued change is processed before it is dead-lettered
+	QueueMaxAttempts int
+
+	// QueueRetryBackoff is the initial delay before a failed queued change is retried
+	QueueRetryBackoff time.Duration
+
+	// QueueWorkers is the number of goroutines generating and committing changelog entries
+	QueueWorkers int
+
+	// QueueCapacity is the maximum number of changes held by the queue
+	QueueCapacity int
+
+	// QueueOverflowPolicy decides what happens when the queue is full
+	// One of: "drop-newest", "drop-oldest", "coalesce"
+	QueueOverflowPolicy string
+
+	// BatchWindow is how long correlated changes, such as those of one Helm
+	// upgrade or Argo CD sync, are collected into one entry and commit; zero
+	// disables batching
+	BatchWindow time.Duration
+
+	// BatchMaxSize bounds the changes recorded together
+	BatchMaxSize int
+
+	// ChangelogLayout selects where entries are written
+	// One of: "timestamped", "resource"
+	ChangelogLayout string
+
+	// ResourceFileMode decides whether an entry is appended to the file of
+	// its resource or replaces it, in the resource layout
+	// One of: "append", "rewrite"
+	ResourceFileMode string
+
+	// StoreManifests writes the filtered manifest of a resource next to its
+	// changelog, so that the repository holds a snapshot of the cluster
+	StoreManifests bool
 }
 
 // LoadConfig reads required environment variables, applies defaults,
@@ -85,54 +262,381 @@ func LoadConfig() (*Config, error) {
 	// 5) GIT_TOKEN is optional for HTTPS authentication
 	gitToken := os.Getenv("GIT_TOKEN")
 
-	// 6) OPENAI_API_URL is required for OpenAI API access
+	// 6) GIT_AUTHOR_* map Kubernetes users to commit authors (optional)
+	gitAuthorFromUser, err := boolEnv("GIT_AUTHOR_FROM_USER", false)
+	if err != nil {
+		return nil, err
+	}
+	gitAuthorEmailTemplate := os.Getenv("GIT_AUTHOR_EMAIL_TEMPLATE")
+	gitAuthorServiceAccountEmail := os.Getenv("GIT_AUTHOR_SERVICE_ACCOUNT_EMAIL")
+	var gitAuthorMap map[string]string
+	if path := os.Getenv("GIT_AUTHOR_MAP_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Error().Err(err).Str("GIT_AUTHOR_MAP_FILE", path).Msg("failed to read author map")
+			return nil, fmt.Errorf("failed to read GIT_AUTHOR_MAP_FILE: %w", err)
+		}
+		if err := yaml.Unmarshal(data, &gitAuthorMap); err != nil {
+			log.Error().Err(err).Str("GIT_AUTHOR_MAP_FILE", path).Msg("failed to parse author map")
+			return nil, fmt.Errorf("failed to parse GIT_AUTHOR_MAP_FILE: %w", err)
+		}
+	}
+
+	// 7) OPENAI_API_URL is required for OpenAI API access
 	openAIApiUrl := os.Getenv("OPENAI_API_URL")
 	if openAIApiUrl == "" {
 		openAIApiUrl = "https://api.openai.com/v1" // Default to official OpenAI API
 	}
 
-	// 7) OPENAI_MODEL is required to specify which model to use
+	// 8) OPENAI_MODEL is required to specify which model to use
 	openAIModel := os.Getenv("OPENAI_MODEL")
 	if openAIModel == "" {
 		openAIModel = "gpt-4" // Default to GPT-4
 	}
 
-	// 8) SYSTEM_PROMPT for OpenAI system messages
+	// 9) SYSTEM_PROMPT for OpenAI system messages
 	systemPrompt := os.Getenv("SYSTEM_PROMPT")
 	if systemPrompt == "" {
 		log.Warn().Msg("SYSTEM_PROMPT not set, using empty system prompt")
 	}
 
-	// 9) USER_MESSAGE_TEMPLATE for formatting user messages
+	// 10) USER_MESSAGE_TEMPLATE for formatting user messages
 	userMessageTemplate := os.Getenv("USER_MESSAGE_TEMPLATE")
 	if userMessageTemplate == "" {
 		log.Warn().Msg("USER_MESSAGE_TEMPLATE not set, using empty template")
 	}
 
-	// 10) OPENAI_TIMEOUT for OpenAI requests
-	openAITimeoutStr := os.Getenv("OPENAI_TIMEOUT")
-	openAITimeout := 30 * time.Second
-	if openAITimeoutStr != "" {
-		d, err := time.ParseDuration(openAITimeoutStr)
+	// 11) DELETE_MESSAGE_TEMPLATE for deleted resources (optional)
+	deleteMessageTemplate := os.Getenv("DELETE_MESSAGE_TEMPLATE")
+
+	// 12) Prompt templates are parsed up front so a broken template fails fast
+	for _, prompt := range []struct{ name, text string }{
+		{"SYSTEM_PROMPT", systemPrompt},
+		{"USER_MESSAGE_TEMPLATE", userMessageTemplate},
+		{"DELETE_MESSAGE_TEMPLATE", deleteMessageTemplate},
+	} {
+		if _, err := helpers.ParsePromptTemplate(prompt.name, prompt.text); err != nil {
+			log.Error().Err(err).Msgf("%s is not a valid template", prompt.name)
+			return nil, fmt.Errorf("invalid %s: %w", prompt.name, err)
+		}
+	}
+
+	// 13) CLUSTER_NAME for prompt templates (optional)
+	clusterName := os.Getenv("CLUSTER_NAME")
+
+	// 14) PROMPT_PROFILES_FILE for per-kind and per-namespace prompts (optional)
+	var promptProfiles []PromptProfile
+	if promptProfilesFile := os.Getenv("PROMPT_PROFILES_FILE"); promptProfilesFile != "" {
+		profiles, err := loadPromptProfiles(promptProfilesFile)
 		if err != nil {
-			log.Warn().Str("OPENAI_TIMEOUT", openAITimeoutStr).
-				Msg("invalid OPENAI_TIMEOUT, using default 30s")
-		} else {
-			openAITimeout = d
+			log.Error().Err(err).Str("PROMPT_PROFILES_FILE", promptProfilesFile).
+				Msg("failed to load prompt profiles")
+			return nil, fmt.Errorf("invalid PROMPT_PROFILES_FILE: %w", err)
 		}
+		promptProfiles = profiles
+	}
+
+	// 15) OPENAI_TIMEOUT for OpenAI requests
+	openAITimeout, err := durationEnv("OPENAI_TIMEOUT", 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	// 16) LLM_PROVIDER selects the model API
+	llmProvider, err := oneOfEnv("LLM_PROVIDER", ProviderOpenAI, ProviderAnthropic, ProviderOllama, ProviderRules)
+	if err != nil {
+		return nil, err
+	}
+	llmFallback, err := boolEnv("LLM_FALLBACK", true)
+	if err != nil {
+		return nil, err
+	}
+
+	// 17) ANTHROPIC_* configure the Anthropic Messages API
+	anthropicApiUrl := os.Getenv("ANTHROPIC_API_URL")
+	if anthropicApiUrl == "" {
+		anthropicApiUrl = "https://api.anthropic.com"
+	}
+	anthropicApiKey := os.Getenv("ANTHROPIC_API_KEY")
+	if llmProvider == ProviderAnthropic && anthropicApiKey == "" {
+		log.Error().Msg("ANTHROPIC_API_KEY is required when LLM_PROVIDER is anthropic")
+		return nil, fmt.Errorf("ANTHROPIC_API_KEY is required when LLM_PROVIDER is anthropic")
+	}
+	anthropicModel := os.Getenv("ANTHROPIC_MODEL")
+	if anthropicModel == "" {
+		anthropicModel = "claude-sonnet-4-5"
+	}
+	anthropicMaxTokens, err := positiveIntEnv("ANTHROPIC_MAX_TOKENS", 1024)
+	if err != nil {
+		return nil, err
+	}
+
+	// 18) OLLAMA_* configure a local Ollama server
+	ollamaApiUrl := os.Getenv("OLLAMA_API_URL")
+	if ollamaApiUrl == "" {
+		ollamaApiUrl = "http://localhost:11434"
+	}
+	ollamaModel := os.Getenv("OLLAMA_MODEL")
+	if ollamaModel == "" {
+		ollamaModel = "llama3.1"
+	}
+
+	// 19) LLM_* retries, rate limits, circuit breaker, prompt budget and response cache of model requests
+	llmMaxRetries, err := nonNegativeIntEnv("LLM_MAX_RETRIES", 3)
+	if err != nil {
+		return nil, err
+	}
+	llmRetryBackoff, err := durationEnv("LLM_RETRY_BACKOFF", time.Second)
+	if err != nil {
+		return nil, err
+	}
+	llmMaxRetryBackoff, err := durationEnv("LLM_MAX_RETRY_BACKOFF", 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	llmRequestsPerMinute, err := nonNegativeIntEnv("LLM_RATE_LIMIT_RPM", 0)
+	if err != nil {
+		return nil, err
+	}
+	llmTokensPerMinute, err := nonNegativeIntEnv("LLM_RATE_LIMIT_TPM", 0)
+	if err != nil {
+		return nil, err
+	}
+	llmBreakerFailures, err := nonNegativeIntEnv("LLM_BREAKER_FAILURES", 5)
+	if err != nil {
+		return nil, err
+	}
+	llmBreakerCooldown, err := durationEnv("LLM_BREAKER_COOLDOWN", time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	llmPromptTokenBudget, err := nonNegativeIntEnv("LLM_PROMPT_TOKEN_BUDGET", 12000)
+	if err != nil {
+		return nil, err
+	}
+	llmCacheSize, err := nonNegativeIntEnv("LLM_CACHE_SIZE", 1000)
+	if err != nil {
+		return nil, err
+	}
+	llmCacheDir := os.Getenv("LLM_CACHE_DIR")
+
+	// 20) GIT_PUSH_MAX_RETRIES for rejected pushes
+	gitPushMaxRetries, err := nonNegativeIntEnv("GIT_PUSH_MAX_RETRIES", 5)
+	if err != nil {
+		return nil, err
+	}
+
+	// 21) GIT_PUSH_RETRY_BACKOFF for the first retry delay
+	gitPushRetryBackoff, err := durationEnv("GIT_PUSH_RETRY_BACKOFF", 500*time.Millisecond)
+	if err != nil {
+		return nil, err
+	}
+
+	// 22) FILTER_RULES_FILE for declarative filter rules (optional)
+	filterRulesFile := os.Getenv("FILTER_RULES_FILE")
+
+	// 23) REDACTION_HASH_KEY for keyed redaction hashes (optional)
+	redactionHashKey := os.Getenv("REDACTION_HASH_KEY")
+
+	// 24) QUEUE_DIR for the durable changelog queue
+	queueDir := os.Getenv("QUEUE_DIR")
+	if queueDir == "" {
+		queueDir = "/var/lib/channelog/queue"
+	}
+
+	// 25) QUEUE_MAX_ATTEMPTS before a change is dead-lettered
+	queueMaxAttempts, err := positiveIntEnv("QUEUE_MAX_ATTEMPTS", 5)
+	if err != nil {
+		return nil, err
+	}
+
+	// 26) QUEUE_RETRY_BACKOFF for the first retry of a failed change
+	queueRetryBackoff, err := durationEnv("QUEUE_RETRY_BACKOFF", 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	// 27) QUEUE_WORKERS bounds concurrent LLM requests and in-flight commits
+	queueWorkers, err := positiveIntEnv("QUEUE_WORKERS", 4)
+	if err != nil {
+		return nil, err
+	}
+
+	// 28) QUEUE_CAPACITY bounds the number of queued changes
+	queueCapacity, err := positiveIntEnv("QUEUE_CAPACITY", 1000)
+	if err != nil {
+		return nil, err
+	}
+
+	// 29) QUEUE_OVERFLOW_POLICY for a full queue
+	queueOverflowPolicy, err := oneOfEnv("QUEUE_OVERFLOW_POLICY", "drop-newest", "drop-oldest", "coalesce")
+	if err != nil {
+		return nil, err
 	}
 
-	// 11) Return the populated Config struct.
+	// 30) BATCH_* group correlated changes into one entry and commit
+	batchWindow, err := nonNegativeDurationEnv("BATCH_WINDOW", 0)
+	if err != nil {
+		return nil, err
+	}
+	batchMaxSize, err := positiveIntEnv("BATCH_MAX_SIZE", 50)
+	if err != nil {
+		return nil, err
+	}
+
+	// 31) CHANGELOG_LAYOUT and CHANGELOG_RESOURCE_FILE_MODE for the repository layout
+	changelogLayout, err := oneOfEnv("CHANGELOG_LAYOUT", LayoutTimestamped, LayoutResource)
+	if err != nil {
+		return nil, err
+	}
+	resourceFileMode, err := oneOfEnv("CHANGELOG_RESOURCE_FILE_MODE", ResourceFileAppend, ResourceFileRewrite)
+	if err != nil {
+		return nil, err
+	}
+
+	// 32) STORE_MANIFESTS writes the filtered manifest of every changed resource
+	storeManifests, err := boolEnv("STORE_MANIFESTS", false)
+	if err != nil {
+		return nil, err
+	}
+
+	// 33) Return the populated Config struct.
 	return &Config{
-		GitRepo:             gitRepo,
-		GitBranch:           gitBranch,
-		Username:            username,
-		UserEmail:           userEmail,
-		GitToken:            gitToken,
-		OpenAIApiUrl:        openAIApiUrl,
-		OpenAIModel:         openAIModel,
-		SystemPrompt:        systemPrompt,
-		UserMessageTemplate: userMessageTemplate,
-		OpenAITimeout:       openAITimeout,
+		GitRepo:                      gitRepo,
+		GitBranch:                    gitBranch,
+		Username:                     username,
+		UserEmail:                    userEmail,
+		GitToken:                     gitToken,
+		GitAuthorFromUser:            gitAuthorFromUser,
+		GitAuthorEmailTemplate:       gitAuthorEmailTemplate,
+		GitAuthorServiceAccountEmail: gitAuthorServiceAccountEmail,
+		GitAuthorMap:                 gitAuthorMap,
+		GitPushMaxRetries:            gitPushMaxRetries,
+		GitPushRetryBackoff:          gitPushRetryBackoff,
+		OpenAIApiUrl:                 openAIApiUrl,
+		OpenAIModel:                  openAIModel,
+		SystemPrompt:                 systemPrompt,
+		UserMessageTemplate:          userMessageTemplate,
+		DeleteMessageTemplate:        deleteMessageTemplate,
+		ClusterName:                  clusterName,
+		PromptProfiles:               promptProfiles,
+		OpenAITimeout:                openAITimeout,
+		LLMProvider:                  llmProvider,
+		LLMFallback:                  llmFallback,
+		AnthropicApiUrl:              anthropicApiUrl,
+		AnthropicApiKey:              anthropicApiKey,
+		AnthropicModel:               anthropicModel,
+		AnthropicMaxTokens:           anthropicMaxTokens,
+		OllamaApiUrl:                 ollamaApiUrl,
+		OllamaModel:                  ollamaModel,
+		LLMMaxRetries:                llmMaxRetries,
+		LLMRetryBackoff:              llmRetryBackoff,
+		LLMMaxRetryBackoff:           llmMaxRetryBackoff,
+		LLMRequestsPerMinute:         llmRequestsPerMinute,
+		LLMTokensPerMinute:           llmTokensPerMinute,
+		LLMBreakerFailures:           llmBreakerFailures,
+		LLMBreakerCooldown:           llmBreakerCooldown,
+		LLMPromptTokenBudget:         llmPromptTokenBudget,
+		LLMCacheSize:                 llmCacheSize,
+		LLMCacheDir:                  llmCacheDir,
+		FilterRulesFile:              filterRulesFile,
+		RedactionHashKey:             redactionHashKey,
+		QueueDir:                     queueDir,
+		QueueMaxAttempts:             queueMaxAttempts,
+		QueueRetryBackoff:            queueRetryBackoff,
+		QueueWorkers:                 queueWorkers,
+		QueueCapacity:                queueCapacity,
+		QueueOverflowPolicy:          queueOverflowPolicy,
+		BatchWindow:                  batchWindow,
+		BatchMaxSize:                 batchMaxSize,
+		ChangelogLayout:              changelogLayout,
+		ResourceFileMode:             resourceFileMode,
+		StoreManifests:               storeManifests,
 	}, nil
 }
+
+// boolEnv parses an optional boolean environment variable
+func boolEnv(key string, fallback bool) (bool, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		log.Error().Str(key, v).Msgf("%s must be a boolean", key)
+		return false, fmt.Errorf("invalid %s %q", key, v)
+	}
+	return b, nil
+}
+
+// oneOfEnv parses an optional environment variable that must be one of
+// values; the first value is the default
+func oneOfEnv(key string, values ...string) (string, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return values[0], nil
+	}
+	if !slices.Contains(values, v) {
+		allowed := strings.Join(values[:len(values)-1], ", ") + " or " + values[len(values)-1]
+		log.Error().Str(key, v).Msgf("%s must be %s", key, allowed)
+		return "", fmt.Errorf("invalid %s %q", key, v)
+	}
+	return v, nil
+}
+
+// positiveIntEnv parses an optional positive integer environment variable
+func positiveIntEnv(key string, fallback int) (int, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		log.Error().Str(key, v).Msgf("%s must be a positive integer", key)
+		return 0, fmt.Errorf("invalid %s %q", key, v)
+	}
+	return n, nil
+}
+
+// nonNegativeIntEnv parses an optional non-negative integer environment variable
+func nonNegativeIntEnv(key string, fallback int) (int, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		log.Error().Str(key, v).Msgf("%s must be a non-negative integer", key)
+		return 0, fmt.Errorf("invalid %s %q", key, v)
+	}
+	return n, nil
+}
+
+// durationEnv parses an optional positive duration environment variable
+func durationEnv(key string, fallback time.Duration) (time.Duration, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		log.Error().Str(key, v).Msgf("%s must be a positive duration", key)
+		return 0, fmt.Errorf("invalid %s %q", key, v)
+	}
+	return d, nil
+}
+
+// nonNegativeDurationEnv parses an optional duration environment variable
+// that may be zero
+func nonNegativeDurationEnv(key string, fallback time.Duration) (time.Duration, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		log.Error().Str(key, v).Msgf("%s must be a non-negative duration", key)
+		return 0, fmt.Errorf("invalid %s %q", key, v)
+	}
+	return d, nil
+}
@@ -0,0 +1,103 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+// setRequiredEnv sets the variables LoadConfig cannot do without
+func setRequiredEnv(t *testing.T) {
+	t.Helper()
+	t.Setenv("GIT_REPO", "https://git.example.com/changelog.git")
+	t.Setenv("GIT_BRANCH", "main")
+	t.Setenv("USERNAME", "channelog")
+	t.Setenv("USER_EMAIL", "channelog@example.com")
+}
+
+func TestLoadConfigDefaults(t *testing.T) {
+	setRequiredEnv(t)
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if cfg.GitPushMaxRetries != 5 || cfg.GitPushRetryBackoff != 500*time.Millisecond {
+		t.Errorf("git push retries = %d after %s, want 5 after 500ms", cfg.GitPushMaxRetries, cfg.GitPushRetryBackoff)
+	}
+	if cfg.QueueMaxAttempts != 5 || cfg.QueueRetryBackoff != 10*time.Second {
+		t.Errorf("queue attempts = %d after %s, want 5 after 10s", cfg.QueueMaxAttempts, cfg.QueueRetryBackoff)
+	}
+	if cfg.QueueWorkers != 4 || cfg.QueueCapacity != 1000 || cfg.QueueOverflowPolicy != "drop-newest" {
+		t.Errorf("queue = %d workers, %d capacity, %s, want 4, 1000, drop-newest", cfg.QueueWorkers, cfg.QueueCapacity, cfg.QueueOverflowPolicy)
+	}
+	if cfg.LLMProvider != ProviderOpenAI || !cfg.LLMFallback || cfg.OpenAITimeout != 30*time.Second {
+		t.Errorf("provider = %s, fallback %t, timeout %s, want openai, true, 30s", cfg.LLMProvider, cfg.LLMFallback, cfg.OpenAITimeout)
+	}
+	if cfg.ChangelogLayout != LayoutTimestamped || cfg.ResourceFileMode != ResourceFileAppend || cfg.StoreManifests {
+		t.Errorf("layout = %s, %s, manifests %t, want timestamped, append, false", cfg.ChangelogLayout, cfg.ResourceFileMode, cfg.StoreManifests)
+	}
+}
+
+func TestLoadConfigParsesValues(t *testing.T) {
+	setRequiredEnv(t)
+	t.Setenv("GIT_PUSH_MAX_RETRIES", "0")
+	t.Setenv("QUEUE_RETRY_BACKOFF", "1m")
+	t.Setenv("QUEUE_OVERFLOW_POLICY", "coalesce")
+	t.Setenv("LLM_PROVIDER", "rules")
+	t.Setenv("STORE_MANIFESTS", "true")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if cfg.GitPushMaxRetries != 0 {
+		t.Errorf("GitPushMaxRetries = %d, want 0", cfg.GitPushMaxRetries)
+	}
+	if cfg.QueueRetryBackoff != time.Minute {
+		t.Errorf("QueueRetryBackoff = %s, want 1m", cfg.QueueRetryBackoff)
+	}
+	if cfg.QueueOverflowPolicy != "coalesce" || cfg.LLMProvider != ProviderRules || !cfg.StoreManifests {
+		t.Errorf("config = %s, %s, %t, want coalesce, rules, true", cfg.QueueOverflowPolicy, cfg.LLMProvider, cfg.StoreManifests)
+	}
+}
+
+func TestLoadConfigRejectsMalformedValues(t *testing.T) {
+	tests := []struct{ key, value string }{
+		{"GIT_PUSH_MAX_RETRIES", "-1"},
+		{"GIT_PUSH_RETRY_BACKOFF", "soon"},
+		{"QUEUE_MAX_ATTEMPTS", "0"},
+		{"QUEUE_RETRY_BACKOFF", "-10s"},
+		{"QUEUE_WORKERS", "four"},
+		{"QUEUE_CAPACITY", "0"},
+		{"QUEUE_OVERFLOW_POLICY", "drop-all"},
+		{"OPENAI_TIMEOUT", "30"},
+		{"LLM_PROVIDER", "gemini"},
+		{"LLM_FALLBACK", "sometimes"},
+		{"LLM_MAX_RETRIES", "-3"},
+		{"BATCH_WINDOW", "-1s"},
+		{"CHANGELOG_LAYOUT", "flat"},
+		{"CHANGELOG_RESOURCE_FILE_MODE", "prepend"},
+		{"STORE_MANIFESTS", "yes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			setRequiredEnv(t)
+			t.Setenv(tt.key, tt.value)
+			if _, err := LoadConfig(); err == nil {
+				t.Errorf("LoadConfig() with %s=%q succeeded, want an error", tt.key, tt.value)
+			}
+		})
+	}
+}
+
+func TestLoadConfigRequiresGitSettings(t *testing.T) {
+	for _, key := range []string{"GIT_REPO", "GIT_BRANCH", "USERNAME", "USER_EMAIL"} {
+		t.Run(key, func(t *testing.T) {
+			setRequiredEnv(t)
+			t.Setenv(key, "")
+			if _, err := LoadConfig(); err == nil {
+				t.Errorf("LoadConfig() without %s succeeded, want an error", key)
+			}
+		})
+	}
+}
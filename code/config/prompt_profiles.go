@@ -0,0 +1,107 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"channelog/helpers"
+)
+
+// PromptProfile is a set of prompt templates for the resources it matches.
+// All of Kinds, Namespaces and Labels that are set must match; the first
+// matching profile is used and the default prompts otherwise.
+type PromptProfile struct {
+	Name string `yaml:"name"`
+
+	// Kinds match the kind of the resource as Kind, group/Kind or
+	// group/version/Kind, e.g. ClusterRoleBinding or autoscaling/HorizontalPodAutoscaler;
+	// the core group is empty, as in /v1/ConfigMap
+	Kinds []string `yaml:"kinds"`
+
+	// Namespaces match the namespace of the resource; shell patterns such as
+	// team-* are allowed
+	Namespaces []string `yaml:"namespaces"`
+
+	// Labels must all be present with the given values on the resource
+	Labels map[string]string `yaml:"labels"`
+
+	// SystemPrompt, UserMessageTemplate and DeleteMessageTemplate are read
+	// from <name>.system-prompt, <name>.user-message-template and
+	// <name>.delete-message-template next to the profiles file. Empty
+	// templates fall back to the default prompts.
+	SystemPrompt          string `yaml:"-"`
+	UserMessageTemplate   string `yaml:"-"`
+	DeleteMessageTemplate string `yaml:"-"`
+}
+
+// promptProfilesFile is the layout of PROMPT_PROFILES_FILE
+type promptProfilesFile struct {
+	Profiles []PromptProfile `yaml:"profiles"`
+}
+
+// loadPromptProfiles reads the profiles and their templates, and validates
+// the templates. This matches the channelog-prompts ConfigMap mounted as a
+// directory, with the profiles file and the templates as keys.
+func loadPromptProfiles(file string) ([]PromptProfile, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read prompt profiles: %w", err)
+	}
+
+	var layout promptProfilesFile
+	if err := yaml.Unmarshal(data, &layout); err != nil {
+		return nil, fmt.Errorf("failed to parse prompt profiles: %w", err)
+	}
+
+	dir := filepath.Dir(file)
+	seen := make(map[string]bool, len(layout.Profiles))
+	for i := range layout.Profiles {
+		profile := &layout.Profiles[i]
+		if profile.Name == "" || strings.ContainsAny(profile.Name, `/\`) {
+			return nil, fmt.Errorf("prompt profile %d: invalid name %q", i, profile.Name)
+		}
+		if seen[profile.Name] {
+			return nil, fmt.Errorf("prompt profile %q is declared twice", profile.Name)
+		}
+		seen[profile.Name] = true
+
+		for _, kind := range profile.Kinds {
+			if kind == "" || strings.Count(kind, "/") > 2 {
+				return nil, fmt.Errorf("prompt profile %q: invalid kind %q", profile.Name, kind)
+			}
+		}
+		for _, namespace := range profile.Namespaces {
+			if _, err := path.Match(namespace, ""); err != nil {
+				return nil, fmt.Errorf("prompt profile %q: invalid namespace pattern %q", profile.Name, namespace)
+			}
+		}
+
+		for _, prompt := range []struct {
+			key  string
+			text *string
+		}{
+			{"system-prompt", &profile.SystemPrompt},
+			{"user-message-template", &profile.UserMessageTemplate},
+			{"delete-message-template", &profile.DeleteMessageTemplate},
+		} {
+			name := profile.Name + "." + prompt.key
+			text, err := os.ReadFile(filepath.Join(dir, name))
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", name, err)
+			}
+			if _, err := helpers.ParsePromptTemplate(name, string(text)); err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", name, err)
+			}
+			*prompt.text = string(text)
+		}
+	}
+	return layout.Profiles, nil
+}
@@ -0,0 +1,86 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeProfiles writes the profiles file and the given templates into a
+// directory and returns the path of the profiles file
+func writeProfiles(t *testing.T, profiles string, templates map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range templates {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	file := filepath.Join(dir, "profiles.yaml")
+	if err := os.WriteFile(file, []byte(profiles), 0o644); err != nil {
+		t.Fatalf("failed to write profiles: %v", err)
+	}
+	return file
+}
+
+func TestLoadPromptProfiles(t *testing.T) {
+	file := writeProfiles(t, `profiles:
+  - name: rbac
+    kinds: ["rbac.authorization.k8s.io/ClusterRoleBinding", "RoleBinding"]
+  - name: payments
+    namespaces: ["payments-*"]
+    labels:
+      tier: critical
+`, map[string]string{
+		"rbac.system-prompt":             "Focus on privilege escalation.",
+		"payments.user-message-template": "{{.Kind}} {{.Name}}",
+	})
+
+	profiles, err := loadPromptProfiles(file)
+	if err != nil {
+		t.Fatalf("loadPromptProfiles() error = %v", err)
+	}
+	want := []PromptProfile{
+		{
+			Name:         "rbac",
+			Kinds:        []string{"rbac.authorization.k8s.io/ClusterRoleBinding", "RoleBinding"},
+			SystemPrompt: "Focus on privilege escalation.",
+		},
+		{
+			Name:                "payments",
+			Namespaces:          []string{"payments-*"},
+			Labels:              map[string]string{"tier": "critical"},
+			UserMessageTemplate: "{{.Kind}} {{.Name}}",
+		},
+	}
+	if !reflect.DeepEqual(profiles, want) {
+		t.Errorf("loadPromptProfiles() = %+v, want %+v", profiles, want)
+	}
+}
+
+func TestLoadPromptProfilesRejectsInvalidProfiles(t *testing.T) {
+	tests := []struct {
+		name      string
+		profiles  string
+		templates map[string]string
+		wantErr   string
+	}{
+		{"missing name", "profiles:\n  - kinds: [Secret]\n", nil, `invalid name ""`},
+		{"path in name", "profiles:\n  - name: ../secrets\n", nil, `invalid name "../secrets"`},
+		{"duplicate", "profiles:\n  - name: a\n  - name: a\n", nil, `prompt profile "a" is declared twice`},
+		{"invalid kind", "profiles:\n  - name: a\n    kinds: [a/b/c/d]\n", nil, `invalid kind "a/b/c/d"`},
+		{"invalid namespace", "profiles:\n  - name: a\n    namespaces: [\"team-[\"]\n", nil, `invalid namespace pattern "team-["`},
+		{"invalid template", "profiles:\n  - name: a\n", map[string]string{"a.user-message-template": "{{.Nmae}}"}, "invalid a.user-message-template"},
+		{"invalid YAML", "profiles: [", nil, "failed to parse prompt profiles"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadPromptProfiles(writeProfiles(t, tt.profiles, tt.templates))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("loadPromptProfiles() error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
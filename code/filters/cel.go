@@ -0,0 +1,116 @@
+package filters
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/ext"
+)
+
+// celVariables are the variables available to skip expressions, matching the
+// webhook matchConditions
+var celVariables = []string{"object", "oldObject", "request"}
+
+var (
+	celEnvOnce sync.Once
+	celEnv     *cel.Env
+	celEnvErr  error
+)
+
+// newCELEnv returns the environment of skip expressions: the CEL standard
+// library with the options and the string and set extensions of the
+// Kubernetes base environment, and celVariables declared as dyn
+func newCELEnv() (*cel.Env, error) {
+	celEnvOnce.Do(func() {
+		opts := []cel.EnvOption{
+			cel.HomogeneousAggregateLiterals(),
+			cel.EagerlyValidateDeclarations(true),
+			cel.DefaultUTCTimeZone(true),
+			cel.CrossTypeNumericComparisons(true),
+			cel.OptionalTypes(),
+			ext.Strings(ext.StringsVersion(2)),
+			ext.Sets(),
+		}
+		for _, name := range celVariables {
+			opts = append(opts, cel.Variable(name, cel.DynType))
+		}
+		celEnv, celEnvErr = cel.NewEnv(opts...)
+	})
+	return celEnv, celEnvErr
+}
+
+// compileCEL type-checks expr and returns its program. As in the webhook
+// matchConditions the expression must evaluate to bool.
+func compileCEL(expr string) (cel.Program, error) {
+	env, err := newCELEnv()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CEL environment: %w", err)
+	}
+	ast, issues := env.Compile(expr)
+	if issues.Err() != nil {
+		return nil, issues.Err()
+	}
+	if !ast.OutputType().IsExactType(cel.BoolType) {
+		return nil, fmt.Errorf("expression must evaluate to bool, got %s", ast.OutputType())
+	}
+	// Optimizing checks constant regular expressions when the rules load
+	return env.Program(ast, cel.EvalOptions(cel.OptOptimize))
+}
+
+// evalCEL evaluates a program and requires a boolean result; expressions
+// over dyn values are only checked when evaluated
+func evalCEL(program cel.Program, vars map[string]any) (bool, error) {
+	out, _, err := program.Eval(vars)
+	if err != nil {
+		return false, err
+	}
+	b, ok := out.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("expression returned %s, expected bool", out.Type())
+	}
+	return b, nil
+}
+
+// celValue converts a value decoded with json.Decoder.UseNumber to the
+// values seen by expressions: whole numbers become int64, as they do for
+// the webhook, and others float64
+func celValue(v any) (any, error) {
+	switch x := v.(type) {
+	case json.Number:
+		if n, err := x.Int64(); err == nil {
+			return n, nil
+		}
+		return x.Float64()
+	case []any:
+		for i := range x {
+			elem, err := celValue(x[i])
+			if err != nil {
+				return nil, err
+			}
+			x[i] = elem
+		}
+	case map[string]any:
+		for k := range x {
+			elem, err := celValue(x[k])
+			if err != nil {
+				return nil, err
+			}
+			x[k] = elem
+		}
+	}
+	return v, nil
+}
+
+// decodeCELValue decodes JSON into the values seen by expressions
+func decodeCELValue(data []byte) (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var v any
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+	return celValue(v)
+}
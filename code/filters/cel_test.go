@@ -0,0 +1,204 @@
+package filters
+
+import (
+	"strings"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+)
+
+// celTestVars returns the variables of a Deployment update
+func celTestVars(t *testing.T) map[string]any {
+	t.Helper()
+	object, err := decodeCELValue([]byte(`{
+		"metadata": {"name": "web", "namespace": "prod", "labels": {"team": "sandbox", "tier": "web"}},
+		"spec": {"replicas": 3, "ratio": 0.5, "template": {"spec": {"containers": [
+			{"name": "app", "image": "registry.example.com/app:1.2"},
+			{"name": "sidecar", "image": "envoy:1.30"}
+		]}}}
+	}`))
+	if err != nil {
+		t.Fatalf("failed to decode object: %v", err)
+	}
+	request, err := decodeCELValue([]byte(`{
+		"operation": "UPDATE",
+		"namespace": "prod",
+		"userInfo": {"username": "system:serviceaccount:kube-system:replicaset-controller", "groups": ["system:serviceaccounts"]}
+	}`))
+	if err != nil {
+		t.Fatalf("failed to decode request: %v", err)
+	}
+	return map[string]any{"object": object, "oldObject": nil, "request": request}
+}
+
+func TestCELEvaluate(t *testing.T) {
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		// Literals, comparisons and equality
+		{"true", true},
+		{"!false", true},
+		{"object.spec.replicas == 3.0", true},
+		{"'a' < 'b'", true},
+		{"2 >= 3", false},
+		{"null == oldObject", true},
+		{"[1, 2] == [1, 2]", true},
+		{`"it's" == 'it\'s'`, true},
+
+		// Arithmetic; whole JSON numbers are ints
+		{"object.spec.replicas / 2 == 1", true},
+		{"object.spec.replicas % 2 == 1", true},
+		{"object.spec.replicas * 2 - 1 == 5", true},
+		{"-object.spec.replicas == -3", true},
+		{"object.spec.ratio * 2.0 == 1.0", true},
+		{"object.spec.replicas > 2.5", true},
+		{"int(object.spec.ratio * 10.0) == 5", true},
+		{"'a' + 'b' == 'ab'", true},
+		{"size([1] + [2, 3]) == 3", true},
+
+		// Field, index and membership access
+		{"object.metadata.labels['team'] == 'sandbox'", true},
+		{"object.spec.template.spec.containers[1].name == 'sidecar'", true},
+		{"'team' in object.metadata.labels", true},
+		{"'owner' in object.metadata.labels", false},
+		{"request.operation in ['CREATE', 'UPDATE']", true},
+		{"object.?metadata.annotations.orValue({}).size() == 0", true},
+
+		// has()
+		{"has(object.metadata.labels)", true},
+		{"has(object.metadata.annotations)", false},
+		{"has(object.metadata.labels.team)", true},
+
+		// Functions of the standard library and the string and set extensions
+		{"request.userInfo.username.startsWith('system:serviceaccount:kube-system:')", true},
+		{"object.metadata.name.endsWith('eb')", true},
+		{"object.metadata.name.contains('e')", true},
+		{"object.metadata.name.matches('^w[a-z]+$')", true},
+		{"matches(object.metadata.name, '^x')", false},
+		{"'Web'.lowerAscii() == 'web' && 'web'.upperAscii() == 'WEB'", true},
+		{"object.metadata.name.split('e') == ['w', 'b']", true},
+		{"size(object.metadata.labels) == 2 && object.metadata.name.size() == 3", true},
+		{"sets.contains(request.userInfo.groups, ['system:serviceaccounts'])", true},
+
+		// Macros
+		{"object.spec.template.spec.containers.exists(c, c.image.startsWith('envoy:'))", true},
+		{"object.spec.template.spec.containers.all(c, c.image.contains('registry.example.com'))", false},
+		{"object.spec.template.spec.containers.exists_one(c, c.name == 'app')", true},
+		{"object.spec.template.spec.containers.filter(c, c.name != 'app').size() == 1", true},
+		{"object.spec.template.spec.containers.map(c, c.name) == ['app', 'sidecar']", true},
+		{"object.metadata.labels.exists(k, k == 'tier')", true},
+		{"[].all(x, x > 0)", true},
+
+		// The matchConditions of the webhook in deploy/config.yaml
+		{"!(request.namespace.matches('^p-[0-9]+$') || request.namespace.matches('^multi-.*'))", true},
+
+		// Conditional
+		{"object.spec.replicas > 1 ? request.namespace == 'prod' : false", true},
+
+		// && and || absorb errors when the other operand decides
+		{"has(object.metadata.annotations) && object.metadata.annotations['a'] == 'b'", false},
+		{"object.metadata.annotations['a'] == 'b' && false", false},
+		{"object.metadata.annotations['a'] == 'b' || true", true},
+		{"true || object.missing", true},
+	}
+	vars := celTestVars(t)
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			program, err := compileCEL(tt.expr)
+			if err != nil {
+				t.Fatalf("compileCEL() error = %v", err)
+			}
+			got, err := evalCEL(program, vars)
+			if err != nil {
+				t.Fatalf("evalCEL() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("evalCEL() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCELEvaluateErrors(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr string
+	}{
+		{"object.metadata.annotations['a'] == 'b'", "no such key: annotations"},
+		{"object.metadata.annotations['a'] == 'b' && true", "no such key: annotations"},
+		{"false || object.missing == 1", "no such key: missing"},
+		{"object.spec.template.spec.containers[5].name == 'x'", "index out of bounds: 5"},
+		{"object.spec.replicas / 0 == 1", "division by zero"},
+		{"object.spec.ratio * 2 > 0.5", "no such overload"},
+		{"object.spec.replicas < 'a'", "no such overload"},
+		{"!object.metadata.name", "no such overload"},
+		{"size(object.spec.replicas) == 1", "no such overload"},
+		{"object.metadata.labels.all(k, k)", "no such overload"},
+		{"1 in object.metadata.name", "no such overload"},
+		{"object.spec.replicas ? true : false", "no such overload"},
+	}
+	vars := celTestVars(t)
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			program, err := compileCEL(tt.expr)
+			if err != nil {
+				t.Fatalf("compileCEL() error = %v", err)
+			}
+			_, err = evalCEL(program, vars)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("evalCEL() error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCELCompileErrors(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr string
+	}{
+		{"", "Syntax error: mismatched input '<EOF>'"},
+		{"object.metadata.name ==", "Syntax error"},
+		{"object.metadata.name == 'web", "Syntax error"},
+		{"object.metadata.name # 1", "Syntax error"},
+		{"spec.replicas == 1", "undeclared reference to 'spec'"},
+		{"object.spec.containers.exists(c, d.name == 'app')", "undeclared reference to 'd'"},
+		{"has(object)", "invalid argument to has() macro"},
+		{"size() == 0", "found no matching overload for 'size'"},
+		{"1 == 1.0", "found no matching overload for '_==_' applied to '(int, double)'"},
+		{"7 / 2.0 == 3.5", "found no matching overload for '_/_'"},
+		{"object.metadata.name.startsWith(1)", "found no matching overload for 'startsWith'"},
+		{"object.metadata.name.matches('[')", "missing closing ]"},
+		{"object.spec.containers.sortBy(c, c.name) == []", "undeclared reference to 'sortBy'"},
+		{"object.metadata.name", "expression must evaluate to bool, got dyn"},
+		{"1 + 1", "expression must evaluate to bool, got int"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := compileCEL(tt.expr)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("compileCEL() error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRulesSkip(t *testing.T) {
+	rules := mustLoadRules(t, `skipExpressions:
+  - name: odd-replicas
+    expression: "object.spec.replicas / 2 == 1 && request.operation == 'UPDATE'"
+  - name: broken
+    expression: "object.metadata.annotations['a'] == 'b'"
+`)
+	object := map[string]any{"metadata": map[string]any{}, "spec": map[string]any{"replicas": 3}}
+	name, skip := rules.Skip(request("apps", "Deployment", "prod", "web", admissionv1.Update, object))
+	if !skip || name != "odd-replicas" {
+		t.Errorf("Skip() = (%q, %t), want (\"odd-replicas\", true)", name, skip)
+	}
+
+	object["spec"] = map[string]any{"replicas": 4}
+	if name, skip := rules.Skip(request("apps", "Deployment", "prod", "web", admissionv1.Update, object)); skip {
+		t.Errorf("Skip() = (%q, true), want the change recorded", name)
+	}
+}
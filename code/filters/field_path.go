@@ -0,0 +1,124 @@
+package filters
+
+import (
+	"fmt"
+	"strings"
+)
+
+// pathSegment is one step of a field path: a map key, or every element of a list
+type pathSegment struct {
+	key      string
+	wildcard bool
+}
+
+// fieldPath is a parsed field path such as
+// spec.template.spec.containers[*].env or metadata.annotations["example.com/key"]
+type fieldPath []pathSegment
+
+// parseFieldPath parses a dot separated field path. Keys containing dots or
+// slashes are written in brackets with quotes, and [*] selects every element
+// of a list.
+func parseFieldPath(path string) (fieldPath, error) {
+	var segments fieldPath
+	rest := strings.TrimPrefix(path, ".")
+	if rest == "" {
+		return nil, fmt.Errorf("empty field path")
+	}
+
+	for rest != "" {
+		switch {
+		case strings.HasPrefix(rest, "[*]"):
+			segments = append(segments, pathSegment{wildcard: true})
+			rest = rest[len("[*]"):]
+		case strings.HasPrefix(rest, `["`):
+			end := strings.Index(rest, `"]`)
+			if end < 0 {
+				return nil, fmt.Errorf("field path %q: unterminated [\"", path)
+			}
+			segments = append(segments, pathSegment{key: rest[2:end]})
+			rest = rest[end+2:]
+		case strings.HasPrefix(rest, "["):
+			return nil, fmt.Errorf("field path %q: only [*] and [\"key\"] are supported in brackets", path)
+		default:
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("field path %q: empty segment", path)
+			}
+			segments = append(segments, pathSegment{key: rest[:end]})
+			rest = rest[end:]
+		}
+
+		if strings.HasPrefix(rest, ".") {
+			rest = rest[1:]
+			if rest == "" {
+				return nil, fmt.Errorf("field path %q: trailing dot", path)
+			}
+		}
+	}
+
+	return segments, nil
+}
+
+// String renders the path back in its canonical form
+func (p fieldPath) String() string {
+	var b strings.Builder
+	for i, seg := range p {
+		switch {
+		case seg.wildcard:
+			b.WriteString("[*]")
+		case strings.ContainsAny(seg.key, "./[]"):
+			fmt.Fprintf(&b, "[%q]", seg.key)
+		default:
+			if i > 0 {
+				b.WriteByte('.')
+			}
+			b.WriteString(seg.key)
+		}
+	}
+	return b.String()
+}
+
+// update returns a copy of value in which fn has been applied to the parent
+// map of every field matched by the path. Maps and lists along the path are
+// copied, so the original object is never modified.
+func (p fieldPath) update(value any, fn func(parent map[string]any, key string)) any {
+	if len(p) == 0 {
+		return value
+	}
+	seg := p[0]
+
+	if seg.wildcard {
+		list, ok := value.([]any)
+		if !ok {
+			return value
+		}
+		copied := make([]any, len(list))
+		for i, elem := range list {
+			copied[i] = p[1:].update(elem, fn)
+		}
+		return copied
+	}
+
+	obj, ok := value.(map[string]any)
+	if !ok {
+		return value
+	}
+	child, exists := obj[seg.key]
+	if !exists {
+		return value
+	}
+
+	copied := make(map[string]any, len(obj))
+	for k, v := range obj {
+		copied[k] = v
+	}
+	if len(p) == 1 {
+		fn(copied, seg.key)
+		return copied
+	}
+	copied[seg.key] = p[1:].update(child, fn)
+	return copied
+}
@@ -0,0 +1,38 @@
+package filters
+
+import "slices"
+
+// FieldStripFilterCondition removes the fields listed in the stripFields
+// section of the filter rules
+type FieldStripFilterCondition struct {
+	fields []StripField
+}
+
+// NewFieldStripFilterCondition creates a condition removing the given fields
+func NewFieldStripFilterCondition(fields []StripField) *FieldStripFilterCondition {
+	return &FieldStripFilterCondition{fields: fields}
+}
+
+// Name returns the name of the filter condition
+func (fsc *FieldStripFilterCondition) Name() string {
+	return "field_strip_filter"
+}
+
+func (fsc *FieldStripFilterCondition) Apply(obj map[string]any) map[string]any {
+	if obj == nil {
+		return nil
+	}
+
+	kind, _ := obj["kind"].(string)
+	var filtered any = obj
+	for _, field := range fsc.fields {
+		if len(field.Kinds) > 0 && !slices.Contains(field.Kinds, kind) {
+			continue
+		}
+		filtered = field.parsed.update(filtered, func(parent map[string]any, key string) {
+			delete(parent, key)
+		})
+	}
+
+	return filtered.(map[string]any)
+}
@@ -15,13 +15,19 @@ type FilterConditions struct {
 	conditions []FilterCondition
 }
 
-// NewFilterConditions creates a new FilterConditions instance with default conditions
-func NewFilterConditions() *FilterConditions {
+// NewFilterConditions creates a new FilterConditions instance with the default
+// conditions followed by the ones declared in rules
+func NewFilterConditions(rules *Rules) *FilterConditions {
+	conditions := []FilterCondition{
+		&MetadataFilterCondition{},
+		NewNormalizeFilterCondition(rules.Normalize),
+	}
+	if len(rules.StripFields) > 0 {
+		conditions = append(conditions, NewFieldStripFilterCondition(rules.StripFields))
+	}
+
 	return &FilterConditions{
-		conditions: []FilterCondition{
-			&MetadataFilterCondition{},
-			// Add more filter conditions here in the future
-		},
+		conditions: conditions,
 	}
 }
 
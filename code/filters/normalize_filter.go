@@ -0,0 +1,162 @@
+package filters
+
+import (
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"channelog/helpers"
+)
+
+var (
+	quantityType = reflect.TypeOf(resource.Quantity{})
+	durationType = reflect.TypeOf(metav1.Duration{})
+)
+
+// quantityMaps are the names of resource lists in kinds without type
+// information, e.g. the container resources of a custom resource
+var quantityMaps = []string{"limits", "requests", "capacity", "allocatable", "hard"}
+
+// durationSuffixes mark duration fields in kinds without type information
+var durationSuffixes = []string{"duration", "Duration", "timeout", "Timeout", "interval", "Interval"}
+
+// Normalize configures the canonicalization applied to both objects before
+// diffing, so equivalent spellings of the same value are not a change
+type Normalize struct {
+	// Quantities rewrites resource quantities in canonical form, e.g. 1000m
+	// as 1 and 1024Mi as 1Gi (default true)
+	Quantities *bool `yaml:"quantities"`
+
+	// Durations rewrites durations in canonical form, e.g. 60m as 1h0m0s (default true)
+	Durations *bool `yaml:"durations"`
+
+	// Sets sorts lists whose order carries no meaning, such as finalizers
+	// and RBAC verbs (default true)
+	Sets *bool `yaml:"sets"`
+
+	// Defaults removes fields holding the value the API server defaults them
+	// to, so a field being defaulted is not a change (default false)
+	Defaults bool `yaml:"defaults"`
+}
+
+// NormalizeFilterCondition canonicalizes quantities, durations and unordered
+// lists, and optionally removes server-applied defaults
+type NormalizeFilterCondition struct {
+	quantities bool
+	durations  bool
+	sets       bool
+	defaults   bool
+}
+
+// NewNormalizeFilterCondition creates the normalization stage from the rules
+func NewNormalizeFilterCondition(cfg Normalize) *NormalizeFilterCondition {
+	return &NormalizeFilterCondition{
+		quantities: cfg.Quantities == nil || *cfg.Quantities,
+		durations:  cfg.Durations == nil || *cfg.Durations,
+		sets:       cfg.Sets == nil || *cfg.Sets,
+		defaults:   cfg.Defaults,
+	}
+}
+
+// Name returns the name of the filter condition
+func (nfc *NormalizeFilterCondition) Name() string {
+	return "normalize_filter"
+}
+
+func (nfc *NormalizeFilterCondition) Apply(obj map[string]any) map[string]any {
+	if obj == nil {
+		return nil
+	}
+
+	normalized := helpers.TransformFields(obj, nfc.normalizeValue)
+	if nfc.defaults {
+		normalized = stripServerDefaults(normalized)
+	}
+	return normalized
+}
+
+// normalizeValue rewrites a single value according to its field. Maps and
+// lists passed in are already copies and may be modified.
+func (nfc *NormalizeFilterCondition) normalizeValue(info helpers.FieldInfo, value any) any {
+	switch {
+	case nfc.quantities && info.Type == quantityType:
+		return canonicalQuantity(value)
+	case nfc.quantities && !info.Typed && slices.Contains(quantityMaps, info.Name):
+		if resources, ok := value.(map[string]any); ok {
+			for name, quantity := range resources {
+				resources[name] = canonicalQuantity(quantity)
+			}
+		}
+	case nfc.durations && (info.Type == durationType || !info.Typed && hasDurationSuffix(info.Name)):
+		return canonicalDuration(value)
+	case nfc.sets && info.Set:
+		return sortedStrings(value)
+	}
+	return value
+}
+
+// canonicalQuantity formats a quantity string or number in canonical form
+func canonicalQuantity(value any) any {
+	var text string
+	switch v := value.(type) {
+	case string:
+		text = v
+	case float64:
+		text = strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return value
+	}
+	quantity, err := resource.ParseQuantity(text)
+	if err != nil {
+		return value
+	}
+	return quantity.String()
+}
+
+// canonicalDuration formats a duration string in canonical form
+func canonicalDuration(value any) any {
+	text, ok := value.(string)
+	if !ok {
+		return value
+	}
+	duration, err := time.ParseDuration(text)
+	if err != nil {
+		return value
+	}
+	return duration.String()
+}
+
+// sortedStrings sorts a list that only holds strings
+func sortedStrings(value any) any {
+	list, ok := value.([]any)
+	if !ok {
+		return value
+	}
+	sorted := make([]string, 0, len(list))
+	for _, elem := range list {
+		s, ok := elem.(string)
+		if !ok {
+			return value
+		}
+		sorted = append(sorted, s)
+	}
+	slices.Sort(sorted)
+	for i, s := range sorted {
+		list[i] = s
+	}
+	return list
+}
+
+func hasDurationSuffix(name string) bool {
+	for _, suffix := range durationSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
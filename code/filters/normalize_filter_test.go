@@ -0,0 +1,109 @@
+package filters
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// decodeObject decodes a JSON object the way admission requests are decoded
+func decodeObject(t *testing.T, data string) map[string]any {
+	t.Helper()
+	var obj map[string]any
+	if err := json.Unmarshal([]byte(data), &obj); err != nil {
+		t.Fatalf("failed to decode %s: %v", data, err)
+	}
+	return obj
+}
+
+func TestNormalizeApply(t *testing.T) {
+	disabled := false
+	tests := []struct {
+		name   string
+		config Normalize
+		object string
+		want   string
+	}{
+		{
+			name: "quantities of built-in kinds",
+			object: `{"apiVersion": "apps/v1", "kind": "Deployment", "spec": {"template": {"spec": {"containers": [
+				{"name": "app", "resources": {"limits": {"cpu": "1000m", "memory": "1024Mi"}, "requests": {"cpu": 0.5}}}
+			]}}}}`,
+			want: `{"apiVersion": "apps/v1", "kind": "Deployment", "spec": {"template": {"spec": {"containers": [
+				{"name": "app", "resources": {"limits": {"cpu": "1", "memory": "1Gi"}, "requests": {"cpu": "500m"}}}
+			]}}}}`,
+		},
+		{
+			name:   "quantities and durations of custom resources by field name",
+			object: `{"apiVersion": "example.com/v1", "kind": "Worker", "spec": {"limits": {"cpu": "2000m"}, "drainTimeout": "60m", "name": "60m"}}`,
+			want:   `{"apiVersion": "example.com/v1", "kind": "Worker", "spec": {"limits": {"cpu": "2"}, "drainTimeout": "1h0m0s", "name": "60m"}}`,
+		},
+		{
+			name:   "invalid values are kept",
+			object: `{"apiVersion": "example.com/v1", "kind": "Worker", "spec": {"limits": {"cpu": "lots"}, "timeout": "soon"}}`,
+			want:   `{"apiVersion": "example.com/v1", "kind": "Worker", "spec": {"limits": {"cpu": "lots"}, "timeout": "soon"}}`,
+		},
+		{
+			name: "sets are sorted, ordered lists are not",
+			object: `{"apiVersion": "rbac.authorization.k8s.io/v1", "kind": "ClusterRole",
+				"metadata": {"finalizers": ["b.example.com", "a.example.com"]},
+				"rules": [{"verbs": ["watch", "get", "list"], "resources": ["pods"]}],
+				"aggregationRule": {"clusterRoleSelectors": []}}`,
+			want: `{"apiVersion": "rbac.authorization.k8s.io/v1", "kind": "ClusterRole",
+				"metadata": {"finalizers": ["a.example.com", "b.example.com"]},
+				"rules": [{"verbs": ["get", "list", "watch"], "resources": ["pods"]}],
+				"aggregationRule": {"clusterRoleSelectors": []}}`,
+		},
+		{
+			name:   "container args keep their order",
+			object: `{"apiVersion": "v1", "kind": "Pod", "spec": {"containers": [{"name": "app", "args": ["--b", "--a"]}]}}`,
+			want:   `{"apiVersion": "v1", "kind": "Pod", "spec": {"containers": [{"name": "app", "args": ["--b", "--a"]}]}}`,
+		},
+		{
+			name:   "disabled stages",
+			config: Normalize{Quantities: &disabled, Durations: &disabled, Sets: &disabled},
+			object: `{"apiVersion": "example.com/v1", "kind": "Worker", "metadata": {"finalizers": ["b", "a"]}, "spec": {"limits": {"cpu": "2000m"}, "timeout": "60m"}}`,
+			want:   `{"apiVersion": "example.com/v1", "kind": "Worker", "metadata": {"finalizers": ["b", "a"]}, "spec": {"limits": {"cpu": "2000m"}, "timeout": "60m"}}`,
+		},
+		{
+			name: "server defaults are kept by default",
+			object: `{"apiVersion": "apps/v1", "kind": "Deployment", "spec": {"revisionHistoryLimit": 10,
+				"template": {"spec": {"restartPolicy": "Always", "containers": [{"name": "app"}]}}}}`,
+			want: `{"apiVersion": "apps/v1", "kind": "Deployment", "spec": {"revisionHistoryLimit": 10,
+				"template": {"spec": {"restartPolicy": "Always", "containers": [{"name": "app"}]}}}}`,
+		},
+		{
+			name:   "server defaults are removed",
+			config: Normalize{Defaults: true},
+			object: `{"apiVersion": "apps/v1", "kind": "Deployment", "spec": {"revisionHistoryLimit": 5, "progressDeadlineSeconds": 600,
+				"strategy": {"type": "RollingUpdate", "rollingUpdate": {"maxSurge": "25%", "maxUnavailable": "25%"}},
+				"template": {"metadata": {"creationTimestamp": null}, "spec": {"restartPolicy": "Always", "dnsPolicy": "None",
+				"containers": [{"name": "app", "terminationMessagePolicy": "File", "ports": [{"containerPort": 80, "protocol": "TCP"}],
+				"readinessProbe": {"periodSeconds": 10, "timeoutSeconds": 5}}]}}}}`,
+			want: `{"apiVersion": "apps/v1", "kind": "Deployment", "spec": {"revisionHistoryLimit": 5,
+				"template": {"metadata": {}, "spec": {"dnsPolicy": "None",
+				"containers": [{"name": "app", "ports": [{"containerPort": 80}],
+				"readinessProbe": {"timeoutSeconds": 5}}]}}}}`,
+		},
+		{
+			name:   "server defaults of other kinds are kept",
+			config: Normalize{Defaults: true},
+			object: `{"apiVersion": "example.com/v1", "kind": "Worker", "spec": {"revisionHistoryLimit": 10, "type": "ClusterIP"}}`,
+			want:   `{"apiVersion": "example.com/v1", "kind": "Worker", "spec": {"revisionHistoryLimit": 10, "type": "ClusterIP"}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			object := decodeObject(t, tt.object)
+			original := decodeObject(t, tt.object)
+			got := NewNormalizeFilterCondition(tt.config).Apply(object)
+			if want := decodeObject(t, tt.want); !reflect.DeepEqual(got, want) {
+				gotJSON, _ := json.Marshal(got)
+				t.Errorf("Apply() = %s, want %s", gotJSON, tt.want)
+			}
+			if !reflect.DeepEqual(object, original) {
+				t.Error("Apply() modified its input")
+			}
+		})
+	}
+}
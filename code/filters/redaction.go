@@ -0,0 +1,308 @@
+package filters
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"regexp"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"channelog/helpers"
+)
+
+// lastAppliedAnnotation holds the full previous manifest, including Secret data
+const lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// RedactField replaces the value at Path with a hash. Maps and lists are
+// redacted element by element, so the diff still shows which key changed.
+// When Kinds is set only objects of those kinds are affected.
+type RedactField struct {
+	Path  string   `yaml:"path"`
+	Kinds []string `yaml:"kinds"`
+
+	parsed fieldPath
+}
+
+// Detector is a regular expression for credentials embedded in annotation
+// and environment variable values. Every match is replaced with a hash, or
+// only the first capture group when the pattern has one.
+type Detector struct {
+	Name    string `yaml:"name"`
+	Pattern string `yaml:"pattern"`
+
+	re *regexp.Regexp
+}
+
+// Redaction configures what is hidden before objects are diffed, sent to the
+// model or stored
+type Redaction struct {
+	// Secrets hashes every value of Secret data and stringData (default true)
+	Secrets *bool `yaml:"secrets"`
+
+	// DefaultDetectors enables the built-in token and key detectors (default true)
+	DefaultDetectors *bool `yaml:"defaultDetectors"`
+
+	// Fields are additional values to hash
+	Fields []RedactField `yaml:"fields"`
+
+	// Detectors are additional patterns to hash wherever they appear in
+	// annotations and environment variables
+	Detectors []Detector `yaml:"detectors"`
+}
+
+// defaultDetectors catch common credential formats
+var defaultDetectors = []Detector{
+	{Name: "private-key", Pattern: `-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`},
+	{Name: "aws-access-key-id", Pattern: `\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`},
+	{Name: "github-token", Pattern: `\bgh[pousr]_[A-Za-z0-9]{36,}\b`},
+	{Name: "slack-token", Pattern: `\bxox[abprs]-[A-Za-z0-9-]{10,}`},
+	{Name: "openai-key", Pattern: `\bsk-[A-Za-z0-9_-]{20,}`},
+	{Name: "jwt", Pattern: `\beyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`},
+	{Name: "url-credentials", Pattern: `[A-Za-z][A-Za-z0-9+.-]*://[^/\s:@]+:([^/\s@]+)@`},
+}
+
+// sensitiveEnvName matches environment variable names whose whole value is a credential
+var sensitiveEnvName = regexp.MustCompile(`(?i)(password|passwd|secret|token|api_?key|private_?key|credential)`)
+
+// compile parses the field paths and detector patterns
+func (r *Redaction) compile() error {
+	for i := range r.Fields {
+		parsed, err := parseFieldPath(r.Fields[i].Path)
+		if err != nil {
+			return fmt.Errorf("redaction.fields %d: %w", i, err)
+		}
+		r.Fields[i].parsed = parsed
+	}
+
+	for i := range r.Detectors {
+		re, err := regexp.Compile(r.Detectors[i].Pattern)
+		if err != nil {
+			return fmt.Errorf("redaction.detectors %q: %w", r.Detectors[i].Name, err)
+		}
+		r.Detectors[i].re = re
+	}
+
+	return nil
+}
+
+// RedactionFilterCondition replaces sensitive values with stable hashes, so a
+// changed value still shows up as a change without revealing the value
+type RedactionFilterCondition struct {
+	secrets   bool
+	fields    []RedactField
+	detectors []Detector
+	key       []byte
+}
+
+// NewRedactionFilterCondition creates the redaction stage from the rules.
+// When key is set hashes are keyed with HMAC-SHA256, which prevents guessing
+// short values by hashing candidates.
+func NewRedactionFilterCondition(rules *Rules, key []byte) *RedactionFilterCondition {
+	cfg := rules.Redaction
+	rfc := &RedactionFilterCondition{
+		secrets: cfg.Secrets == nil || *cfg.Secrets,
+		fields:  cfg.Fields,
+		key:     key,
+	}
+
+	if cfg.DefaultDetectors == nil || *cfg.DefaultDetectors {
+		for _, detector := range defaultDetectors {
+			detector.re = regexp.MustCompile(detector.Pattern)
+			rfc.detectors = append(rfc.detectors, detector)
+		}
+	}
+	rfc.detectors = append(rfc.detectors, cfg.Detectors...)
+
+	return rfc
+}
+
+// Enabled reports whether any value is redacted
+func (rfc *RedactionFilterCondition) Enabled() bool {
+	return rfc.secrets || len(rfc.fields) > 0 || len(rfc.detectors) > 0
+}
+
+// Keyed reports whether the hashes are keyed, see NewRedactionFilterCondition
+func (rfc *RedactionFilterCondition) Keyed() bool {
+	return len(rfc.key) > 0
+}
+
+// Name returns the name of the filter condition
+func (rfc *RedactionFilterCondition) Name() string {
+	return "redaction_filter"
+}
+
+func (rfc *RedactionFilterCondition) Apply(obj map[string]any) map[string]any {
+	if obj == nil {
+		return nil
+	}
+
+	redacted := runtime.DeepCopyJSON(obj)
+	kind, _ := redacted["kind"].(string)
+
+	if rfc.secrets && kind == "Secret" {
+		for _, key := range []string{"data", "stringData"} {
+			if value, ok := redacted[key]; ok {
+				redacted[key] = rfc.redactValue(value)
+			}
+		}
+		if annotations, ok := nestedMap(redacted, "metadata", "annotations"); ok {
+			if value, ok := annotations[lastAppliedAnnotation]; ok {
+				annotations[lastAppliedAnnotation] = rfc.redactValue(value)
+			}
+		}
+	}
+
+	var filtered any = redacted
+	for _, field := range rfc.fields {
+		if len(field.Kinds) > 0 && !slices.Contains(field.Kinds, kind) {
+			continue
+		}
+		filtered = field.parsed.update(filtered, func(parent map[string]any, key string) {
+			parent[key] = rfc.redactValue(parent[key])
+		})
+	}
+
+	if len(rfc.detectors) > 0 {
+		rfc.scan(filtered)
+	}
+
+	return filtered.(map[string]any)
+}
+
+// scan walks the object in place and redacts credentials found in annotation
+// values and container environment variables
+func (rfc *RedactionFilterCondition) scan(value any) {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, child := range v {
+			switch key {
+			case "annotations":
+				if annotations, ok := child.(map[string]any); ok {
+					for name, annotation := range annotations {
+						if s, ok := annotation.(string); ok {
+							annotations[name] = rfc.detect(s)
+						}
+					}
+					continue
+				}
+			case "env":
+				if env, ok := child.([]any); ok {
+					for _, entry := range env {
+						rfc.redactEnvVar(entry)
+					}
+					continue
+				}
+			}
+			rfc.scan(child)
+		}
+	case []any:
+		for _, child := range v {
+			rfc.scan(child)
+		}
+	}
+}
+
+// redactEnvVar hashes the value of a container environment variable when its
+// name looks like a credential, and runs the detectors otherwise
+func (rfc *RedactionFilterCondition) redactEnvVar(entry any) {
+	envVar, ok := entry.(map[string]any)
+	if !ok {
+		return
+	}
+	value, ok := envVar["value"].(string)
+	if !ok || value == "" {
+		return
+	}
+	if name, _ := envVar["name"].(string); sensitiveEnvName.MatchString(name) {
+		envVar["value"] = rfc.hash(value)
+		return
+	}
+	envVar["value"] = rfc.detect(value)
+}
+
+// detect replaces every detector match in s with its hash
+func (rfc *RedactionFilterCondition) detect(s string) string {
+	for _, detector := range rfc.detectors {
+		matches := detector.re.FindAllStringSubmatchIndex(s, -1)
+		if matches == nil {
+			continue
+		}
+		var b strings.Builder
+		last := 0
+		for _, m := range matches {
+			start, end := m[0], m[1]
+			if len(m) >= 4 && m[2] >= 0 {
+				start, end = m[2], m[3]
+			}
+			b.WriteString(s[last:start])
+			b.WriteString(rfc.hash(s[start:end]))
+			last = end
+		}
+		b.WriteString(s[last:])
+		s = b.String()
+	}
+	return s
+}
+
+// RedactValue hashes a value the way redacted fields are hashed, for use
+// outside of the filter such as the redact template function
+func (rfc *RedactionFilterCondition) RedactValue(value any) any {
+	return rfc.redactValue(value)
+}
+
+// redactValue hashes scalars and recurses into maps and lists
+func (rfc *RedactionFilterCondition) redactValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		redacted := make(map[string]any, len(v))
+		for key, child := range v {
+			redacted[key] = rfc.redactValue(child)
+		}
+		return redacted
+	case []any:
+		redacted := make([]any, len(v))
+		for i, child := range v {
+			redacted[i] = rfc.redactValue(child)
+		}
+		return redacted
+	case string:
+		return rfc.hash(v)
+	case nil:
+		return nil
+	}
+	data, _ := json.Marshal(value)
+	return rfc.hash(string(data))
+}
+
+// hash returns a short stable digest of value
+func (rfc *RedactionFilterCondition) hash(value string) string {
+	var h hash.Hash
+	algorithm := "sha256"
+	if len(rfc.key) > 0 {
+		h = hmac.New(sha256.New, rfc.key)
+		algorithm = "hmac-sha256"
+	} else {
+		h = sha256.New()
+	}
+	h.Write([]byte(value))
+	return fmt.Sprintf("%s%s:%s>", helpers.RedactedPrefix, algorithm, hex.EncodeToString(h.Sum(nil))[:16])
+}
+
+// nestedMap returns the map found by following keys from obj
+func nestedMap(obj map[string]any, keys ...string) (map[string]any, bool) {
+	current := obj
+	for _, key := range keys {
+		next, ok := current[key].(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		current = next
+	}
+	return current, true
+}
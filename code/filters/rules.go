@@ -0,0 +1,303 @@
+package filters
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/google/cel-go/cel"
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+	admissionv1 "k8s.io/api/admission/v1"
+)
+
+// Action is what a matching rule does with an admission request
+type Action string
+
+const (
+	// ActionInclude records the change
+	ActionInclude Action = "include"
+	// ActionExclude skips the change
+	ActionExclude Action = "exclude"
+)
+
+// Rule selects admission requests. Every non-empty field must match; list
+// fields match when any entry matches. Namespaces, names and label values
+// accept shell globs such as "p-*".
+type Rule struct {
+	Action     Action            `yaml:"action"`
+	Groups     []string          `yaml:"groups"`
+	Versions   []string          `yaml:"versions"`
+	Kinds      []string          `yaml:"kinds"`
+	Namespaces []string          `yaml:"namespaces"`
+	Names      []string          `yaml:"names"`
+	Labels     map[string]string `yaml:"labels"`
+	Operations []string          `yaml:"operations"`
+}
+
+// StripField removes a field before diffing. Path uses dots between keys,
+// ["key"] for keys containing dots or slashes and [*] for every list element.
+// When Kinds is set only objects of those kinds are affected.
+type StripField struct {
+	Path  string   `yaml:"path"`
+	Kinds []string `yaml:"kinds"`
+
+	parsed fieldPath
+}
+
+// SkipExpression is a CEL expression over object, oldObject and request;
+// requests for which it evaluates to true are skipped
+type SkipExpression struct {
+	Name       string `yaml:"name"`
+	Expression string `yaml:"expression"`
+
+	program cel.Program
+}
+
+// Rules is the declarative filter configuration loaded from FILTER_RULES_FILE
+type Rules struct {
+	// Rules are evaluated in order and the first match decides; requests
+	// matching no rule are recorded
+	Rules []Rule `yaml:"rules"`
+
+	// StripFields are removed from both objects before diffing
+	StripFields []StripField `yaml:"stripFields"`
+
+	// SkipExpressions skip a request when any of them evaluates to true
+	SkipExpressions []SkipExpression `yaml:"skipExpressions"`
+
+	// Redaction hides sensitive values before diffing and prompting
+	Redaction Redaction `yaml:"redaction"`
+
+	// Normalize canonicalizes equivalent values before diffing
+	Normalize Normalize `yaml:"normalize"`
+}
+
+// DefaultRules returns the rules used when no rules file is configured
+func DefaultRules() *Rules {
+	return &Rules{
+		Rules: []Rule{
+			// Pods are owned by workloads whose own changes are recorded
+			{Action: ActionExclude, Kinds: []string{"Pod"}},
+		},
+	}
+}
+
+// LoadRules reads and validates the rules file. An empty file name returns
+// DefaultRules.
+func LoadRules(file string) (*Rules, error) {
+	if file == "" {
+		return DefaultRules(), nil
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read filter rules %s: %w", file, err)
+	}
+
+	rules := &Rules{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(rules); err != nil {
+		return nil, fmt.Errorf("failed to parse filter rules %s: %w", file, err)
+	}
+
+	if err := rules.compile(); err != nil {
+		return nil, fmt.Errorf("invalid filter rules %s: %w", file, err)
+	}
+
+	log.Info().
+		Str("path", file).
+		Int("rules", len(rules.Rules)).
+		Int("strip_fields", len(rules.StripFields)).
+		Int("skip_expressions", len(rules.SkipExpressions)).
+		Msg("Loaded filter rules")
+
+	return rules, nil
+}
+
+// compile validates every rule and parses the field paths
+func (r *Rules) compile() error {
+	for i, rule := range r.Rules {
+		if rule.Action != ActionInclude && rule.Action != ActionExclude {
+			return fmt.Errorf("rule %d: action must be %q or %q, got %q", i, ActionInclude, ActionExclude, rule.Action)
+		}
+		patterns := slices.Concat(rule.Namespaces, rule.Names)
+		for _, v := range rule.Labels {
+			patterns = append(patterns, v)
+		}
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("rule %d: invalid pattern %q: %w", i, pattern, err)
+			}
+		}
+		for _, op := range rule.Operations {
+			switch admissionv1.Operation(strings.ToUpper(op)) {
+			case admissionv1.Create, admissionv1.Update, admissionv1.Delete, admissionv1.Connect:
+			default:
+				return fmt.Errorf("rule %d: unknown operation %q", i, op)
+			}
+		}
+	}
+
+	for i := range r.StripFields {
+		parsed, err := parseFieldPath(r.StripFields[i].Path)
+		if err != nil {
+			return fmt.Errorf("stripFields %d: %w", i, err)
+		}
+		r.StripFields[i].parsed = parsed
+	}
+
+	if err := r.Redaction.compile(); err != nil {
+		return err
+	}
+
+	for i := range r.SkipExpressions {
+		expr := &r.SkipExpressions[i]
+		if expr.Name == "" {
+			expr.Name = fmt.Sprintf("skipExpressions[%d]", i)
+		}
+		program, err := compileCEL(expr.Expression)
+		if err != nil {
+			return fmt.Errorf("skip expression %q: %w", expr.Name, err)
+		}
+		expr.program = program
+	}
+
+	return nil
+}
+
+// Evaluate returns the action of the first rule matching the request, and
+// false when no rule matches
+func (r *Rules) Evaluate(review admissionv1.AdmissionReview) (Action, bool) {
+	labels := requestLabels(review)
+	for _, rule := range r.Rules {
+		if rule.matches(review.Request, labels) {
+			return rule.Action, true
+		}
+	}
+	return "", false
+}
+
+// Skip returns the name of the first skip expression that evaluates to true.
+// Expressions that fail to evaluate are logged and treated as false, so a
+// broken expression never hides a change.
+func (r *Rules) Skip(review admissionv1.AdmissionReview) (string, bool) {
+	if len(r.SkipExpressions) == 0 {
+		return "", false
+	}
+
+	vars, err := celActivation(review.Request)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to prepare skip expression variables")
+		return "", false
+	}
+
+	for _, expr := range r.SkipExpressions {
+		skip, err := evalCEL(expr.program, vars)
+		if err != nil {
+			log.Warn().
+				Err(err).
+				Str("expression", expr.Name).
+				Str("kind", review.Request.Kind.Kind).
+				Str("name", review.Request.Name).
+				Msg("Skip expression failed to evaluate")
+			continue
+		}
+		if skip {
+			return expr.Name, true
+		}
+	}
+	return "", false
+}
+
+// celActivation decodes the request into the JSON values seen by expressions
+func celActivation(req *admissionv1.AdmissionRequest) (map[string]any, error) {
+	vars := map[string]any{"object": nil, "oldObject": nil}
+	for name, raw := range map[string][]byte{"object": req.Object.Raw, "oldObject": req.OldObject.Raw} {
+		if raw == nil {
+			continue
+		}
+		obj, err := decodeCELValue(raw)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", name, err)
+		}
+		vars[name] = obj
+	}
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+	request, err := decodeCELValue(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode request: %w", err)
+	}
+	vars["request"] = request
+	return vars, nil
+}
+
+// matches reports whether every configured selector of the rule matches
+func (rule Rule) matches(req *admissionv1.AdmissionRequest, labels map[string]any) bool {
+	if len(rule.Groups) > 0 && !slices.Contains(rule.Groups, req.Kind.Group) {
+		return false
+	}
+	if len(rule.Versions) > 0 && !slices.Contains(rule.Versions, req.Kind.Version) {
+		return false
+	}
+	if len(rule.Kinds) > 0 && !slices.Contains(rule.Kinds, req.Kind.Kind) {
+		return false
+	}
+	if len(rule.Operations) > 0 && !slices.ContainsFunc(rule.Operations, func(op string) bool {
+		return strings.EqualFold(op, string(req.Operation))
+	}) {
+		return false
+	}
+	if len(rule.Namespaces) > 0 && !matchAny(rule.Namespaces, req.Namespace) {
+		return false
+	}
+	if len(rule.Names) > 0 && !matchAny(rule.Names, req.Name) {
+		return false
+	}
+	for key, pattern := range rule.Labels {
+		value, ok := labels[key].(string)
+		if !ok {
+			return false
+		}
+		if matched, _ := path.Match(pattern, value); !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// matchAny reports whether value matches any of the glob patterns
+func matchAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, value); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// requestLabels returns the labels of the new object, or of the old object for DELETE
+func requestLabels(review admissionv1.AdmissionReview) map[string]any {
+	raw := review.Request.Object.Raw
+	if raw == nil {
+		raw = review.Request.OldObject.Raw
+	}
+	var obj struct {
+		Metadata struct {
+			Labels map[string]any `json:"labels"`
+		} `json:"metadata"`
+	}
+	if raw == nil || json.Unmarshal(raw, &obj) != nil {
+		return nil
+	}
+	return obj.Metadata.Labels
+}
@@ -0,0 +1,181 @@
+package filters
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// writeRules writes a rules file and loads it
+func writeRules(t *testing.T, content string) (*Rules, error) {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "rules.yaml")
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write rules: %v", err)
+	}
+	return LoadRules(file)
+}
+
+// mustLoadRules loads a rules file that must be valid
+func mustLoadRules(t *testing.T, content string) *Rules {
+	t.Helper()
+	rules, err := writeRules(t, content)
+	if err != nil {
+		t.Fatalf("LoadRules() error = %v", err)
+	}
+	return rules
+}
+
+// request builds an admission review of group/kind namespace/name with the
+// object as both old and new state
+func request(group, kind, namespace, name string, op admissionv1.Operation, object map[string]any) admissionv1.AdmissionReview {
+	data, _ := json.Marshal(object)
+	return admissionv1.AdmissionReview{
+		Request: &admissionv1.AdmissionRequest{
+			Kind:      metav1.GroupVersionKind{Group: group, Version: "v1", Kind: kind},
+			Namespace: namespace,
+			Name:      name,
+			Operation: op,
+			Object:    runtime.RawExtension{Raw: data},
+			OldObject: runtime.RawExtension{Raw: data},
+		},
+	}
+}
+
+// labelled returns an object with labels
+func labelled(labels map[string]any) map[string]any {
+	return map[string]any{"metadata": map[string]any{"labels": labels}}
+}
+
+func TestLoadRulesDefaults(t *testing.T) {
+	rules, err := LoadRules("")
+	if err != nil {
+		t.Fatalf("LoadRules(\"\") error = %v", err)
+	}
+	if !ValidateValidRequest(request("", "Pod", "prod", "web-1", admissionv1.Update, nil), rules) {
+		t.Error("Pods are recorded, want them skipped by default")
+	}
+	if ValidateValidRequest(request("apps", "Deployment", "prod", "web", admissionv1.Update, nil), rules) {
+		t.Error("Deployments are skipped, want them recorded by default")
+	}
+}
+
+func TestRulesEvaluate(t *testing.T) {
+	rules := mustLoadRules(t, `
+rules:
+  - action: include
+    kinds: ["ReplicaSet"]
+    names: ["keep-*"]
+  - action: exclude
+    groups: ["apps"]
+    kinds: ["ReplicaSet"]
+  - action: exclude
+    namespaces: ["p-*"]
+    operations: ["update"]
+  - action: exclude
+    labels:
+      team: sand*
+`)
+
+	tests := []struct {
+		name       string
+		review     admissionv1.AdmissionReview
+		wantAction Action
+		wantMatch  bool
+	}{
+		{"first match wins", request("apps", "ReplicaSet", "prod", "keep-web", admissionv1.Update, nil), ActionInclude, true},
+		{"group and kind", request("apps", "ReplicaSet", "prod", "web-5d8f", admissionv1.Update, nil), ActionExclude, true},
+		{"namespace glob and operation, case-insensitive", request("", "ConfigMap", "p-123", "settings", admissionv1.Update, nil), ActionExclude, true},
+		{"operation must match", request("", "ConfigMap", "p-123", "settings", admissionv1.Create, nil), "", false},
+		{"label glob", request("", "ConfigMap", "prod", "settings", admissionv1.Create, labelled(map[string]any{"team": "sandbox"})), ActionExclude, true},
+		{"label must be present", request("", "ConfigMap", "prod", "settings", admissionv1.Create, labelled(map[string]any{"tier": "sandbox"})), "", false},
+		{"no match", request("apps", "Deployment", "prod", "web", admissionv1.Update, nil), "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action, matched := rules.Evaluate(tt.review)
+			if action != tt.wantAction || matched != tt.wantMatch {
+				t.Errorf("Evaluate() = %q, %t, want %q, %t", action, matched, tt.wantAction, tt.wantMatch)
+			}
+		})
+	}
+}
+
+func TestLoadRulesRejectsInvalidRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"unknown key", "rules:\n  - action: exclude\n    kind: [Pod]\n", "field kind not found"},
+		{"unknown action", "rules:\n  - action: drop\n", `action must be "include" or "exclude"`},
+		{"invalid glob", "rules:\n  - action: exclude\n    names: [\"[\"]\n", "invalid pattern"},
+		{"unknown operation", "rules:\n  - action: exclude\n    operations: [PATCH]\n", "unknown operation"},
+		{"malformed path", "stripFields:\n  - path: spec.containers[0]\n", "only [*] and [\"key\"] are supported"},
+		{"broken expression", "skipExpressions:\n  - expression: \"object.metadata.name ==\"\n", "skip expression"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := writeRules(t, tt.content)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("LoadRules() error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestStripFields(t *testing.T) {
+	rules := mustLoadRules(t, `
+stripFields:
+  - path: spec.replicas
+    kinds: ["Deployment"]
+  - path: metadata.annotations["example.com/last-sync"]
+  - path: spec.template.spec.containers[*].terminationMessagePath
+`)
+	obj := map[string]any{
+		"kind": "Deployment",
+		"metadata": map[string]any{
+			"name":        "web",
+			"annotations": map[string]any{"example.com/last-sync": "now", "team": "web"},
+		},
+		"spec": map[string]any{
+			"replicas": 3.0,
+			"template": map[string]any{"spec": map[string]any{"containers": []any{
+				map[string]any{"name": "app", "terminationMessagePath": "/dev/termination-log"},
+				map[string]any{"name": "sidecar", "terminationMessagePath": "/dev/termination-log"},
+			}}},
+		},
+	}
+
+	got := NewFieldStripFilterCondition(rules.StripFields).Apply(obj)
+	want := map[string]any{
+		"kind": "Deployment",
+		"metadata": map[string]any{
+			"name":        "web",
+			"annotations": map[string]any{"team": "web"},
+		},
+		"spec": map[string]any{
+			"template": map[string]any{"spec": map[string]any{"containers": []any{
+				map[string]any{"name": "app"},
+				map[string]any{"name": "sidecar"},
+			}}},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Apply() = %v, want %v", got, want)
+	}
+
+	// Fields limited to other kinds stay
+	obj["kind"] = "StatefulSet"
+	got = NewFieldStripFilterCondition(rules.StripFields).Apply(obj)
+	if _, ok := got["spec"].(map[string]any)["replicas"]; !ok {
+		t.Error("spec.replicas of a StatefulSet was stripped, want it kept")
+	}
+}
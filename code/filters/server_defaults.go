@@ -0,0 +1,154 @@
+package filters
+
+import (
+	"reflect"
+	"slices"
+)
+
+// serverDefault is a field the API server sets when it is omitted
+type serverDefault struct {
+	kinds []string
+	path  fieldPath
+	value any
+}
+
+// podSpecPaths locates the pod spec of each workload kind
+var podSpecPaths = map[string]string{
+	"Pod":                   "spec",
+	"Deployment":            "spec.template.spec",
+	"StatefulSet":           "spec.template.spec",
+	"DaemonSet":             "spec.template.spec",
+	"ReplicaSet":            "spec.template.spec",
+	"ReplicationController": "spec.template.spec",
+	"Job":                   "spec.template.spec",
+	"CronJob":               "spec.jobTemplate.spec.template.spec",
+}
+
+// podSpecDefaults are relative to the pod spec
+var podSpecDefaults = map[string]any{
+	"restartPolicy":                 "Always",
+	"dnsPolicy":                     "ClusterFirst",
+	"schedulerName":                 "default-scheduler",
+	"terminationGracePeriodSeconds": float64(30),
+	"enableServiceLinks":            true,
+	"securityContext":               map[string]any{},
+
+	"containers[*].terminationMessagePath":               "/dev/termination-log",
+	"containers[*].terminationMessagePolicy":             "File",
+	"containers[*].resources":                            map[string]any{},
+	"containers[*].ports[*].protocol":                    "TCP",
+	"containers[*].env[*].valueFrom.fieldRef.apiVersion": "v1",
+	"initContainers[*].terminationMessagePath":           "/dev/termination-log",
+	"initContainers[*].terminationMessagePolicy":         "File",
+	"initContainers[*].resources":                        map[string]any{},
+
+	"volumes[*].configMap.defaultMode": float64(420),
+	"volumes[*].secret.defaultMode":    float64(420),
+	"volumes[*].projected.defaultMode": float64(420),
+}
+
+// probeDefaults apply to the liveness, readiness and startup probes of every container
+var probeDefaults = map[string]any{
+	"timeoutSeconds":   float64(1),
+	"periodSeconds":    float64(10),
+	"successThreshold": float64(1),
+	"failureThreshold": float64(3),
+	"httpGet.scheme":   "HTTP",
+}
+
+// kindDefaults are relative to the object
+var kindDefaults = []struct {
+	kinds []string
+	path  string
+	value any
+}{
+	{[]string{"Deployment"}, "spec.revisionHistoryLimit", float64(10)},
+	{[]string{"Deployment"}, "spec.progressDeadlineSeconds", float64(600)},
+	{[]string{"Deployment"}, "spec.strategy", map[string]any{
+		"type":          "RollingUpdate",
+		"rollingUpdate": map[string]any{"maxSurge": "25%", "maxUnavailable": "25%"},
+	}},
+	{[]string{"StatefulSet"}, "spec.revisionHistoryLimit", float64(10)},
+	{[]string{"StatefulSet"}, "spec.podManagementPolicy", "OrderedReady"},
+	{[]string{"StatefulSet"}, "spec.updateStrategy", map[string]any{
+		"type":          "RollingUpdate",
+		"rollingUpdate": map[string]any{"partition": float64(0)},
+	}},
+	{[]string{"StatefulSet"}, "spec.persistentVolumeClaimRetentionPolicy", map[string]any{
+		"whenDeleted": "Retain",
+		"whenScaled":  "Retain",
+	}},
+	{[]string{"DaemonSet"}, "spec.revisionHistoryLimit", float64(10)},
+	{[]string{"DaemonSet"}, "spec.updateStrategy", map[string]any{
+		"type":          "RollingUpdate",
+		"rollingUpdate": map[string]any{"maxSurge": float64(0), "maxUnavailable": float64(1)},
+	}},
+	{[]string{"Job"}, "spec.backoffLimit", float64(6)},
+	{[]string{"Job"}, "spec.completions", float64(1)},
+	{[]string{"Job"}, "spec.parallelism", float64(1)},
+	{[]string{"Job"}, "spec.completionMode", "NonIndexed"},
+	{[]string{"Job", "CronJob"}, "spec.suspend", false},
+	{[]string{"CronJob"}, "spec.concurrencyPolicy", "Allow"},
+	{[]string{"CronJob"}, "spec.successfulJobsHistoryLimit", float64(3)},
+	{[]string{"CronJob"}, "spec.failedJobsHistoryLimit", float64(1)},
+	{[]string{"Service"}, "spec.type", "ClusterIP"},
+	{[]string{"Service"}, "spec.sessionAffinity", "None"},
+	{[]string{"Service"}, "spec.ipFamilyPolicy", "SingleStack"},
+	{[]string{"Service"}, "spec.internalTrafficPolicy", "Cluster"},
+	{[]string{"Service"}, "spec.ports[*].protocol", "TCP"},
+}
+
+// serverDefaults is the compiled table of well-known defaults
+var serverDefaults = compileServerDefaults()
+
+func compileServerDefaults() []serverDefault {
+	var defaults []serverDefault
+	add := func(kinds []string, path string, value any) {
+		parsed, err := parseFieldPath(path)
+		if err != nil {
+			panic("invalid server default path " + path + ": " + err.Error())
+		}
+		defaults = append(defaults, serverDefault{kinds: kinds, path: parsed, value: value})
+	}
+
+	for kind, podSpec := range podSpecPaths {
+		kinds := []string{kind}
+		for path, value := range podSpecDefaults {
+			add(kinds, podSpec+"."+path, value)
+		}
+		for _, containers := range []string{"containers", "initContainers"} {
+			for _, probe := range []string{"livenessProbe", "readinessProbe", "startupProbe"} {
+				for path, value := range probeDefaults {
+					add(kinds, podSpec+"."+containers+"[*]."+probe+"."+path, value)
+				}
+			}
+		}
+		if kind != "Pod" {
+			// The API server serializes the unset template timestamp as null
+			template := podSpec[:len(podSpec)-len(".spec")]
+			add(kinds, template+".metadata.creationTimestamp", nil)
+		}
+	}
+	for _, d := range kindDefaults {
+		add(d.kinds, d.path, d.value)
+	}
+
+	return defaults
+}
+
+// stripServerDefaults removes every field of obj that holds its server default
+func stripServerDefaults(obj map[string]any) map[string]any {
+	kind, _ := obj["kind"].(string)
+	var stripped any = obj
+	for _, d := range serverDefaults {
+		if !slices.Contains(d.kinds, kind) {
+			continue
+		}
+		stripped = d.path.update(stripped, func(parent map[string]any, key string) {
+			if reflect.DeepEqual(parent[key], d.value) {
+				delete(parent, key)
+			}
+		})
+	}
+	return stripped.(map[string]any)
+}
@@ -1,13 +1,32 @@
 package filters
 
-import admissionv1 "k8s.io/api/admission/v1"
+import (
+	"github.com/rs/zerolog/log"
+	admissionv1 "k8s.io/api/admission/v1"
+)
 
 // ValidateValidRequest determines whether the admission request should be
 // skipped for changelog processing. It returns true when the request should
-// not be processed further, for example when the object kind is Pod.
-func ValidateValidRequest(review admissionv1.AdmissionReview) bool {
-	if review.Request.Kind.Kind == "Pod" {
-		// Skip Pod objects entirely.
+// not be processed further, i.e. when the first matching rule excludes it or
+// a skip expression evaluates to true. Other requests are processed.
+func ValidateValidRequest(review admissionv1.AdmissionReview, rules *Rules) bool {
+	action, matched := rules.Evaluate(review)
+	if matched && action == ActionExclude {
+		log.Debug().
+			Str("kind", review.Request.Kind.String()).
+			Str("name", review.Request.Name).
+			Str("namespace", review.Request.Namespace).
+			Msg("request excluded by filter rules")
+		return true
+	}
+
+	if name, skip := rules.Skip(review); skip {
+		log.Debug().
+			Str("kind", review.Request.Kind.String()).
+			Str("name", review.Request.Name).
+			Str("namespace", review.Request.Namespace).
+			Str("expression", name).
+			Msg("request skipped by filter expression")
 		return true
 	}
 
@@ -0,0 +1,136 @@
+package helpers
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+)
+
+// ActorType distinguishes who made a change in the cluster
+type ActorType string
+
+const (
+	// ActorHuman is a user authenticated by the cluster's identity provider
+	ActorHuman ActorType = "human"
+	// ActorServiceAccount is a Kubernetes service account, e.g. a controller or CI job
+	ActorServiceAccount ActorType = "serviceaccount"
+	// ActorSystem is a built-in component such as a node or the controller manager
+	ActorSystem ActorType = "system"
+)
+
+const serviceAccountPrefix = "system:serviceaccount:"
+
+// recordedExtraKeys are the UserInfo.Extra keys recorded with a change. Other
+// keys are dropped, as they can carry credential metadata such as
+// authentication.kubernetes.io/credential-id.
+var recordedExtraKeys = []string{
+	"authentication.kubernetes.io/node-name",
+	"authentication.kubernetes.io/pod-name",
+}
+
+// impersonatorExtraKeys hold the original user of an impersonated request.
+// The API server passes only the impersonated user to webhooks, so a client
+// or proxy that impersonates marks it with one of these extras, e.g. with the
+// header Impersonate-Extra-Impersonator.
+var impersonatorExtraKeys = []string{
+	"impersonator",
+	"originaluser.jetstack.io-user",
+}
+
+// Actor describes the user behind an admission request
+type Actor struct {
+	Username string
+	UID      string
+	Groups   []string
+	Extra    map[string][]string
+	Type     ActorType
+
+	// Impersonator is the user who impersonated Username, if known
+	Impersonator string
+
+	// ServiceAccountNamespace and ServiceAccountName are set for ActorServiceAccount
+	ServiceAccountNamespace string
+	ServiceAccountName      string
+}
+
+// NewActor builds an Actor from the UserInfo of an AdmissionRequest
+func NewActor(userInfo authenticationv1.UserInfo) Actor {
+	actor := Actor{
+		Username: userInfo.Username,
+		UID:      userInfo.UID,
+		Groups:   userInfo.Groups,
+		Type:     ActorHuman,
+	}
+
+	for _, k := range recordedExtraKeys {
+		if v, ok := userInfo.Extra[k]; ok {
+			if actor.Extra == nil {
+				actor.Extra = make(map[string][]string)
+			}
+			actor.Extra[k] = slices.Clone(v)
+		}
+	}
+	for _, k := range impersonatorExtraKeys {
+		if v := userInfo.Extra[k]; len(v) > 0 && v[0] != "" {
+			actor.Impersonator = v[0]
+			break
+		}
+	}
+
+	switch {
+	case strings.HasPrefix(userInfo.Username, serviceAccountPrefix):
+		actor.Type = ActorServiceAccount
+		// system:serviceaccount:<namespace>:<name>
+		parts := strings.SplitN(strings.TrimPrefix(userInfo.Username, serviceAccountPrefix), ":", 2)
+		actor.ServiceAccountNamespace = parts[0]
+		if len(parts) == 2 {
+			actor.ServiceAccountName = parts[1]
+		}
+	case strings.HasPrefix(userInfo.Username, "system:"):
+		actor.Type = ActorSystem
+	}
+
+	return actor
+}
+
+// TypeLabel returns a human readable label for the actor type
+func (a Actor) TypeLabel() string {
+	switch a.Type {
+	case ActorServiceAccount:
+		return "Service Account"
+	case ActorSystem:
+		return "System Component"
+	default:
+		return "Human"
+	}
+}
+
+// String returns the username followed by the actor type, e.g. "alice (Human)"
+// or "deployer (Human, impersonated by bob)"
+func (a Actor) String() string {
+	if a.Username == "" {
+		return "unknown"
+	}
+	if a.Impersonator != "" {
+		return fmt.Sprintf("%s (%s, impersonated by %s)", a.Username, a.TypeLabel(), a.Impersonator)
+	}
+	return fmt.Sprintf("%s (%s)", a.Username, a.TypeLabel())
+}
+
+// GroupList returns the groups as a comma separated list
+func (a Actor) GroupList() string {
+	return strings.Join(a.Groups, ", ")
+}
+
+// ExtraList returns the extra attributes as "key=v1,v2; key2=v3", sorted by key
+func (a Actor) ExtraList() string {
+	keys := slices.Sorted(maps.Keys(a.Extra))
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", k, strings.Join(a.Extra[k], ",")))
+	}
+	return strings.Join(pairs, "; ")
+}
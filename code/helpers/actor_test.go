@@ -0,0 +1,78 @@
+package helpers
+
+import (
+	"testing"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+)
+
+func TestNewActorTypes(t *testing.T) {
+	tests := []struct {
+		username      string
+		wantType      ActorType
+		wantNamespace string
+		wantName      string
+	}{
+		{"alice@example.com", ActorHuman, "", ""},
+		{"system:serviceaccount:ci:deployer", ActorServiceAccount, "ci", "deployer"},
+		{"system:kube-controller-manager", ActorSystem, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.username, func(t *testing.T) {
+			actor := NewActor(authenticationv1.UserInfo{Username: tt.username})
+			if actor.Type != tt.wantType {
+				t.Errorf("Type = %s, want %s", actor.Type, tt.wantType)
+			}
+			if actor.ServiceAccountNamespace != tt.wantNamespace || actor.ServiceAccountName != tt.wantName {
+				t.Errorf("service account = %s/%s, want %s/%s",
+					actor.ServiceAccountNamespace, actor.ServiceAccountName, tt.wantNamespace, tt.wantName)
+			}
+		})
+	}
+}
+
+func TestNewActorRecordsAllowListedExtras(t *testing.T) {
+	actor := NewActor(authenticationv1.UserInfo{
+		Username: "system:serviceaccount:ci:deployer",
+		Extra: map[string]authenticationv1.ExtraValue{
+			"authentication.kubernetes.io/pod-name":      {"runner-1"},
+			"authentication.kubernetes.io/credential-id": {"JTI=5f2c"},
+			"scopes.example.com":                         {"admin"},
+		},
+	})
+
+	if got, want := actor.ExtraList(), "authentication.kubernetes.io/pod-name=runner-1"; got != want {
+		t.Errorf("ExtraList() = %q, want %q", got, want)
+	}
+}
+
+func TestNewActorMarksImpersonation(t *testing.T) {
+	tests := []struct {
+		name  string
+		extra map[string]authenticationv1.ExtraValue
+		want  string
+	}{
+		{"impersonator extra", map[string]authenticationv1.ExtraValue{"impersonator": {"bob"}}, "bob"},
+		{"kube-oidc-proxy extra", map[string]authenticationv1.ExtraValue{"originaluser.jetstack.io-user": {"carol"}}, "carol"},
+		{"not impersonated", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actor := NewActor(authenticationv1.UserInfo{Username: "deployer", Extra: tt.extra})
+			if actor.Impersonator != tt.want {
+				t.Errorf("Impersonator = %q, want %q", actor.Impersonator, tt.want)
+			}
+			if len(actor.Extra) != 0 {
+				t.Errorf("Extra = %v, want the impersonation extras left out", actor.Extra)
+			}
+		})
+	}
+
+	actor := NewActor(authenticationv1.UserInfo{
+		Username: "deployer",
+		Extra:    map[string]authenticationv1.ExtraValue{"impersonator": {"bob"}},
+	})
+	if got, want := actor.String(), "deployer (Human, impersonated by bob)"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
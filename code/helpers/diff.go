@@ -0,0 +1,374 @@
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	fdiff "github.com/go-git/go-git/v5/plumbing/format/diff"
+	"github.com/go-git/go-git/v5/utils/diff"
+	"github.com/rs/zerolog/log"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// ChangeOp is the kind of a structured change
+type ChangeOp string
+
+const (
+	// ChangeAdd is a field or list element that only exists in the new object
+	ChangeAdd ChangeOp = "add"
+	// ChangeRemove is a field or list element that only exists in the old object
+	ChangeRemove ChangeOp = "remove"
+	// ChangeReplace is a value that differs between the two objects
+	ChangeReplace ChangeOp = "replace"
+)
+
+// Change is one leaf-level difference between two objects. Path uses dots
+// between keys and ["key"] for keys containing dots or slashes. Elements of
+// lists with a merge key are addressed by it, e.g.
+// spec.template.spec.containers[name=app].image, other list elements by
+// index, e.g. spec.template.spec.containers[name=app].args[0].
+type Change struct {
+	Path     string   `json:"path"`
+	Op       ChangeOp `json:"op"`
+	OldValue any      `json:"oldValue,omitempty"`
+	NewValue any      `json:"newValue,omitempty"`
+}
+
+// String renders the change on one line, as used in logs and prompts
+func (c Change) String() string {
+	switch c.Op {
+	case ChangeAdd:
+		return fmt.Sprintf("%s added: %s", c.Path, formatChangeValue(c.NewValue))
+	case ChangeRemove:
+		return fmt.Sprintf("%s removed (was %s)", c.Path, formatChangeValue(c.OldValue))
+	}
+	return fmt.Sprintf("%s changed: %s -> %s", c.Path, formatChangeValue(c.OldValue), formatChangeValue(c.NewValue))
+}
+
+// maxSummaryChanges bounds the number of changes listed by SummarizeChanges
+const maxSummaryChanges = 100
+
+// Diff is the difference between two objects
+type Diff struct {
+	// Unified is the git-style unified diff of the YAML documents, empty when
+	// the objects are equal
+	Unified string `json:"unified"`
+
+	// Changes lists every changed field in document order, with map keys sorted
+	Changes []Change `json:"changes,omitempty"`
+
+	// JSONPatch turns the old object into the new one and RevertPatch the new
+	// object back into the old one (RFC 6902). Only set when both objects exist.
+	JSONPatch   []PatchOperation `json:"jsonPatch,omitempty"`
+	RevertPatch []PatchOperation `json:"revertPatch,omitempty"`
+
+	// MergePatch turns the old object into the new one (RFC 7386). Only set
+	// when both objects exist.
+	MergePatch map[string]any `json:"mergePatch,omitempty"`
+
+	// OmittedPatchPaths are the paths left out of the patches because the
+	// filtered objects differ from the live ones there: redacted values and
+	// set-like lists sorted by normalization
+	OmittedPatchPaths []string `json:"omittedPatchPaths,omitempty"`
+}
+
+// UnmarshalJSON also accepts the plain diff text stored by earlier versions
+func (d *Diff) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*d = Diff{}
+		if text != "No differences found" {
+			d.Unified = text
+		}
+		return nil
+	}
+
+	type plain Diff
+	return json.Unmarshal(data, (*plain)(d))
+}
+
+// String returns the unified diff, or "No differences found"
+func (d *Diff) String() string {
+	if d.Unified == "" {
+		return "No differences found"
+	}
+	return d.Unified
+}
+
+// SummarizeChanges lists the changes one per line, e.g.
+// spec.template.spec.containers[name=app].image changed: "app:1" -> "app:2"
+func SummarizeChanges(changes []Change) string {
+	var b strings.Builder
+	for i, change := range changes {
+		if i == maxSummaryChanges {
+			fmt.Fprintf(&b, "... and %d more changes\n", len(changes)-i)
+			break
+		}
+		b.WriteString(change.String())
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// DiffObjects compares two decoded objects without going through git. The
+// unified text is what `git diff` prints for the two YAML documents (minus
+// the file headers), after the elements of lists with a merge key, such as
+// containers, env and ports, have been put in the old order so that
+// reordering them is not a change. Either object may be nil.
+func DiffObjects(oldObj, newObj map[string]any) (*Diff, error) {
+	// Most admissions are no-op updates once filtered; skip the encoding
+	if (oldObj == nil) == (newObj == nil) && reflect.DeepEqual(oldObj, newObj) {
+		return &Diff{}, nil
+	}
+
+	result := &Diff{}
+	fields := schemaFor(newObj, oldObj)
+	if oldObj != nil && newObj != nil {
+		// Patches apply to the objects as they are, before lists are aligned
+		var omitted, revertOmitted, mergeOmitted []string
+		result.JSONPatch, omitted = replayablePatch(fields, JSONPatch(oldObj, newObj))
+		result.RevertPatch, revertOmitted = replayablePatch(fields, JSONPatch(newObj, oldObj))
+		result.MergePatch, mergeOmitted = replayableMergePatch(fields, "", MergePatch(oldObj, newObj))
+		result.OmittedPatchPaths = slices.Compact(slices.Sorted(slices.Values(
+			slices.Concat(omitted, revertOmitted, mergeOmitted))))
+	}
+
+	if oldObj != nil && newObj != nil {
+		newObj = alignLists(fields, oldObj, newObj).(map[string]any)
+	}
+
+	oldYAML, err := marshalObject(oldObj)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to marshal old object to YAML")
+		return nil, fmt.Errorf("failed to marshal old object to YAML: %w", err)
+	}
+
+	newYAML, err := marshalObject(newObj)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to marshal new object to YAML")
+		return nil, fmt.Errorf("failed to marshal new object to YAML: %w", err)
+	}
+
+	if string(oldYAML) == string(newYAML) {
+		// Only the order of keyed lists changed
+		return &Diff{}, nil
+	}
+
+	result.Unified, err = unifiedDiff(string(oldYAML), string(newYAML))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate diff: %w", err)
+	}
+
+	var oldValue, newValue any
+	if oldObj != nil {
+		oldValue = oldObj
+	}
+	if newObj != nil {
+		newValue = newObj
+	}
+	result.Changes = collectChanges(nil, fields, "", oldValue, newValue)
+
+	return result, nil
+}
+
+// unifiedDiff renders the line diff of two documents with three lines of
+// context using the go-git encoder, without file headers
+func unifiedDiff(from, to string) (string, error) {
+	var chunks []fdiff.Chunk
+	for _, d := range diff.Do(from, to) {
+		var op fdiff.Operation
+		switch d.Type {
+		case diffmatchpatch.DiffEqual:
+			op = fdiff.Equal
+		case diffmatchpatch.DiffInsert:
+			op = fdiff.Add
+		case diffmatchpatch.DiffDelete:
+			op = fdiff.Delete
+		}
+		chunks = append(chunks, textChunk{content: d.Text, op: op})
+	}
+
+	var out strings.Builder
+	encoder := fdiff.NewUnifiedEncoder(&out, fdiff.DefaultContextLines)
+	if err := encoder.Encode(textPatch{chunks: chunks}); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// textPatch is a single headerless file patch for the go-git unified encoder
+type textPatch struct {
+	chunks []fdiff.Chunk
+}
+
+func (p textPatch) FilePatches() []fdiff.FilePatch { return []fdiff.FilePatch{p} }
+func (p textPatch) Message() string                { return "" }
+func (p textPatch) IsBinary() bool                 { return false }
+func (p textPatch) Chunks() []fdiff.Chunk          { return p.chunks }
+
+// Files returns no files so the encoder omits the diff --git header
+func (p textPatch) Files() (fdiff.File, fdiff.File) { return nil, nil }
+
+type textChunk struct {
+	content string
+	op      fdiff.Operation
+}
+
+func (c textChunk) Content() string       { return c.content }
+func (c textChunk) Type() fdiff.Operation { return c.op }
+
+// collectChanges appends the leaf-level differences between oldValue and
+// newValue below path. A nil value stands for a missing field.
+func collectChanges(changes []Change, s fieldSchema, path string, oldValue, newValue any) []Change {
+	switch {
+	case oldValue == nil && newValue == nil:
+		return changes
+	case oldValue == nil:
+		return append(changes, Change{Path: rootPath(path), Op: ChangeAdd, NewValue: newValue})
+	case newValue == nil:
+		return append(changes, Change{Path: rootPath(path), Op: ChangeRemove, OldValue: oldValue})
+	}
+
+	oldMap, oldIsMap := oldValue.(map[string]any)
+	newMap, newIsMap := newValue.(map[string]any)
+	if oldIsMap && newIsMap {
+		keys := slices.Sorted(maps.Keys(oldMap))
+		for key := range newMap {
+			if _, ok := oldMap[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			changes = collectChanges(changes, s.field(key), joinPath(path, key), oldMap[key], newMap[key])
+		}
+		return changes
+	}
+
+	oldList, oldIsList := oldValue.([]any)
+	newList, newIsList := newValue.([]any)
+	if oldIsList && newIsList {
+		if key, keyed := s.listKey(oldList, newList); keyed {
+			return collectKeyedChanges(changes, s.elem(), path, key, oldList, newList)
+		}
+		for i := 0; i < max(len(oldList), len(newList)); i++ {
+			elemPath := path + "[" + strconv.Itoa(i) + "]"
+			switch {
+			case i >= len(oldList):
+				changes = append(changes, Change{Path: elemPath, Op: ChangeAdd, NewValue: newList[i]})
+			case i >= len(newList):
+				changes = append(changes, Change{Path: elemPath, Op: ChangeRemove, OldValue: oldList[i]})
+			default:
+				changes = collectChanges(changes, s.elem(), elemPath, oldList[i], newList[i])
+			}
+		}
+		return changes
+	}
+
+	if !reflect.DeepEqual(oldValue, newValue) {
+		changes = append(changes, Change{Path: rootPath(path), Op: ChangeReplace, OldValue: oldValue, NewValue: newValue})
+	}
+	return changes
+}
+
+// collectKeyedChanges matches list elements by their merge key instead of
+// their position
+func collectKeyedChanges(changes []Change, elem fieldSchema, path, key string, oldList, newList []any) []Change {
+	oldByKey := make(map[string]any, len(oldList))
+	for _, oldElem := range oldList {
+		id, _ := elementKey(oldElem, key)
+		oldByKey[id] = oldElem
+	}
+
+	seen := make(map[string]bool, len(newList))
+	for _, newElem := range newList {
+		id, _ := elementKey(newElem, key)
+		seen[id] = true
+		elemPath := path + "[" + key + "=" + id + "]"
+		if oldElem, ok := oldByKey[id]; ok {
+			changes = collectChanges(changes, elem, elemPath, oldElem, newElem)
+		} else {
+			changes = append(changes, Change{Path: elemPath, Op: ChangeAdd, NewValue: newElem})
+		}
+	}
+	for _, oldElem := range oldList {
+		if id, _ := elementKey(oldElem, key); !seen[id] {
+			changes = append(changes, Change{Path: path + "[" + key + "=" + id + "]", Op: ChangeRemove, OldValue: oldElem})
+		}
+	}
+	return changes
+}
+
+// joinPath appends key to path, quoting keys that contain separators
+func joinPath(path, key string) string {
+	if strings.ContainsAny(key, "./[]") {
+		return path + "[" + strconv.Quote(key) + "]"
+	}
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// SplitPath splits a Change path into its map keys and list selectors, e.g.
+// spec.containers[name=app].env[0] into spec, containers, [name=app], env and
+// [0]. Quoted keys are unquoted. The root path "." has no segments.
+func SplitPath(path string) []string {
+	var segments []string
+	for i := 0; i < len(path); {
+		switch path[i] {
+		case '.':
+			i++
+		case '[':
+			if i+1 < len(path) && path[i+1] == '"' {
+				quoted, err := strconv.QuotedPrefix(path[i+1:])
+				if err == nil {
+					key, _ := strconv.Unquote(quoted)
+					segments = append(segments, key)
+					i += 1 + len(quoted) + 1
+					continue
+				}
+			}
+			end := strings.IndexByte(path[i:], ']')
+			if end < 0 {
+				return append(segments, path[i:])
+			}
+			segments = append(segments, path[i:i+end+1])
+			i += end + 1
+		default:
+			end := strings.IndexAny(path[i:], ".[")
+			if end < 0 {
+				end = len(path) - i
+			}
+			segments = append(segments, path[i:i+end])
+			i += end
+		}
+	}
+	return segments
+}
+
+// rootPath names the whole object when path is empty
+func rootPath(path string) string {
+	if path == "" {
+		return "."
+	}
+	return path
+}
+
+// formatChangeValue renders a value compactly for Change.String
+func formatChangeValue(value any) string {
+	switch v := value.(type) {
+	case string:
+		return strconv.Quote(v)
+	case map[string]any:
+		return fmt.Sprintf("{%d fields}", len(v))
+	case []any:
+		return fmt.Sprintf("[%d items]", len(v))
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,267 @@
+package helpers
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// settings returns a ConfigMap with the given mode
+func settings(mode string) map[string]any {
+	return map[string]any{
+		"kind":     "ConfigMap",
+		"metadata": map[string]any{"name": "settings"},
+		"data":     map[string]any{"level": "info", "mode": mode},
+	}
+}
+
+func TestDiffObjectsUnified(t *testing.T) {
+	tests := []struct {
+		name        string
+		old, new    map[string]any
+		wantUnified string
+		wantChanges []Change
+	}{
+		{
+			// The missing side is an empty document, not "null", so every
+			// line shows as added
+			name: "create",
+			new:  settings("fast"),
+			wantUnified: `@@ -0,0 +1,6 @@
++data:
++    level: info
++    mode: fast
++kind: ConfigMap
++metadata:
++    name: settings
+`,
+			wantChanges: []Change{{Path: ".", Op: ChangeAdd, NewValue: settings("fast")}},
+		},
+		{
+			name: "update",
+			old:  settings("fast"),
+			new:  settings("slow"),
+			wantUnified: `@@ -1,6 +1,6 @@
+ data:
+     level: info
+-    mode: fast
++    mode: slow
+ kind: ConfigMap
+ metadata:
+     name: settings
+`,
+			wantChanges: []Change{{Path: "data.mode", Op: ChangeReplace, OldValue: "fast", NewValue: "slow"}},
+		},
+		{
+			name: "delete",
+			old:  settings("fast"),
+			wantUnified: `@@ -1,6 +0,0 @@
+-data:
+-    level: info
+-    mode: fast
+-kind: ConfigMap
+-metadata:
+-    name: settings
+`,
+			wantChanges: []Change{{Path: ".", Op: ChangeRemove, OldValue: settings("fast")}},
+		},
+		{
+			name: "no change",
+			old:  settings("fast"),
+			new:  settings("fast"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DiffObjects(tt.old, tt.new)
+			if err != nil {
+				t.Fatalf("DiffObjects() error = %v", err)
+			}
+			if got.Unified != tt.wantUnified {
+				t.Errorf("Unified =\n%s\nwant\n%s", got.Unified, tt.wantUnified)
+			}
+			if !reflect.DeepEqual(got.Changes, tt.wantChanges) {
+				t.Errorf("Changes = %v, want %v", got.Changes, tt.wantChanges)
+			}
+		})
+	}
+}
+
+func TestDiffObjectsMatchesGit(t *testing.T) {
+	oldObj, newObj := benchmarkDeployment("app:1.0"), benchmarkDeployment("app:1.1")
+	got, err := DiffObjects(oldObj, newObj)
+	if err != nil {
+		t.Fatalf("DiffObjects() error = %v", err)
+	}
+	want, err := gitRepoDiff(oldObj, newObj)
+	if err != nil {
+		t.Fatalf("gitRepoDiff() error = %v", err)
+	}
+	if got.Unified != want {
+		t.Errorf("Unified =\n%s\nwant what git prints\n%s", got.Unified, want)
+	}
+}
+
+// benchmarkDeployment returns a Deployment with three containers
+func benchmarkDeployment(image string) map[string]any {
+	var containers []any
+	for i := range 3 {
+		containers = append(containers, map[string]any{
+			"name":  fmt.Sprintf("container-%d", i),
+			"image": image,
+			"args":  []any{"--port=8080", "--verbose"},
+			"env": []any{
+				map[string]any{"name": "LOG_LEVEL", "value": "info"},
+				map[string]any{"name": "REGION", "value": "eu-west-1"},
+			},
+			"ports":     []any{map[string]any{"containerPort": 8080 + i, "protocol": "TCP"}},
+			"resources": map[string]any{"limits": map[string]any{"cpu": "500m", "memory": "256Mi"}},
+		})
+	}
+	return map[string]any{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata": map[string]any{
+			"name":      "web",
+			"namespace": "prod",
+			"labels":    map[string]any{"app": "web", "team": "platform"},
+		},
+		"spec": map[string]any{
+			"replicas": 3,
+			"selector": map[string]any{"matchLabels": map[string]any{"app": "web"}},
+			"template": map[string]any{
+				"metadata": map[string]any{"labels": map[string]any{"app": "web"}},
+				"spec":     map[string]any{"containers": containers},
+			},
+		},
+	}
+}
+
+func BenchmarkDiffObjects(b *testing.B) {
+	b.Run("no-op update", func(b *testing.B) {
+		oldObj, newObj := benchmarkDeployment("app:1.0"), benchmarkDeployment("app:1.0")
+		b.ReportAllocs()
+		for b.Loop() {
+			if _, err := DiffObjects(oldObj, newObj); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("real change", func(b *testing.B) {
+		oldObj, newObj := benchmarkDeployment("app:1.0"), benchmarkDeployment("app:1.1")
+		b.ReportAllocs()
+		for b.Loop() {
+			if _, err := DiffObjects(oldObj, newObj); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkGitRepoDiff measures the previous implementation, which committed
+// both documents to an in-memory repository, as a baseline for DiffObjects
+func BenchmarkGitRepoDiff(b *testing.B) {
+	b.Run("no-op update", func(b *testing.B) {
+		oldObj, newObj := benchmarkDeployment("app:1.0"), benchmarkDeployment("app:1.0")
+		b.ReportAllocs()
+		for b.Loop() {
+			if _, err := gitRepoDiff(oldObj, newObj); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("real change", func(b *testing.B) {
+		oldObj, newObj := benchmarkDeployment("app:1.0"), benchmarkDeployment("app:1.1")
+		b.ReportAllocs()
+		for b.Loop() {
+			if _, err := gitRepoDiff(oldObj, newObj); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// gitRepoDiff is the previous ObjectDiff: it commits both YAML documents to a
+// throwaway in-memory repository and lets go-git diff the two trees
+func gitRepoDiff(oldObj, newObj map[string]any) (string, error) {
+	oldYAML, err := marshalObject(oldObj)
+	if err != nil {
+		return "", err
+	}
+	newYAML, err := marshalObject(newObj)
+	if err != nil {
+		return "", err
+	}
+
+	fs := memfs.New()
+	repo, err := git.Init(memory.NewStorage(), fs)
+	if err != nil {
+		return "", err
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return "", err
+	}
+
+	var trees []*object.Tree
+	for _, content := range [][]byte{oldYAML, newYAML} {
+		file, err := fs.OpenFile("object.yaml", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+		if err != nil {
+			return "", err
+		}
+		if _, err := file.Write(content); err != nil {
+			return "", err
+		}
+		file.Close()
+		if _, err := worktree.Add("object.yaml"); err != nil {
+			return "", err
+		}
+		hash, err := worktree.Commit("version", &git.CommitOptions{
+			Author:            &object.Signature{Name: "diff-generator", Email: "diff@example.com"},
+			AllowEmptyCommits: true,
+		})
+		if err != nil {
+			return "", err
+		}
+		commit, err := repo.CommitObject(hash)
+		if err != nil {
+			return "", err
+		}
+		tree, err := commit.Tree()
+		if err != nil {
+			return "", err
+		}
+		trees = append(trees, tree)
+	}
+
+	changes, err := object.DiffTree(trees[0], trees[1])
+	if err != nil {
+		return "", err
+	}
+	var out strings.Builder
+	for _, change := range changes {
+		patch, err := change.Patch()
+		if err != nil {
+			return "", err
+		}
+		out.WriteString(patch.String())
+	}
+
+	// Drop the file headers, as the previous cleanDiffOutput did
+	var lines []string
+	for _, line := range strings.Split(out.String(), "\n") {
+		if strings.HasPrefix(line, "diff --git") || strings.HasPrefix(line, "index ") ||
+			strings.HasPrefix(line, "--- a/") || strings.HasPrefix(line, "+++ b/") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n"), nil
+}
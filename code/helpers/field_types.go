@@ -0,0 +1,53 @@
+package helpers
+
+import (
+	"reflect"
+)
+
+// FieldInfo describes a value of a decoded object as seen by TransformFields
+type FieldInfo struct {
+	// Name is the JSON name of the field, empty for list elements
+	Name string
+	// Type is the Go type of the value in k8s.io/api, nil when unknown
+	Type reflect.Type
+	// Typed is set for values inside built-in kinds
+	Typed bool
+	// Set is set for lists of strings whose order carries no meaning, such as
+	// finalizers and RBAC verbs
+	Set bool
+}
+
+// TransformFields returns a copy of obj in which fn has replaced every value,
+// children before their parents. For built-in kinds fn also learns the Go type
+// of the value, so e.g. resource.Quantity fields can be recognized wherever
+// they appear. obj itself is not modified.
+func TransformFields(obj map[string]any, fn func(info FieldInfo, value any) any) map[string]any {
+	if obj == nil {
+		return nil
+	}
+	root := schemaFor(obj)
+	transformed := transformValue(root, "", obj, fn)
+	if m, ok := transformed.(map[string]any); ok {
+		return m
+	}
+	return obj
+}
+
+func transformValue(s fieldSchema, name string, value any, fn func(FieldInfo, any) any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		copied := make(map[string]any, len(v))
+		for key, child := range v {
+			copied[key] = transformValue(s.field(key), key, child, fn)
+		}
+		value = copied
+	case []any:
+		elem := s.elem()
+		copied := make([]any, len(v))
+		for i, child := range v {
+			copied[i] = transformValue(elem, "", child, fn)
+		}
+		value = copied
+	}
+	return fn(FieldInfo{Name: name, Type: s.t, Typed: s.typed, Set: s.set}, value)
+}
@@ -0,0 +1,12 @@
+package helpers
+
+import "testing"
+
+func TestQualifiedName(t *testing.T) {
+	if got := QualifiedName("prod", "web"); got != "prod/web" {
+		t.Errorf("QualifiedName() = %q, want %q", got, "prod/web")
+	}
+	if got := QualifiedName("", "admin"); got != "admin" {
+		t.Errorf("QualifiedName() = %q, want %q", got, "admin")
+	}
+}
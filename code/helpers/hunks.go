@@ -0,0 +1,150 @@
+package helpers
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// hunkHeader matches the header of a unified diff hunk, e.g. @@ -3,7 +3,8 @@
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@(.*)$`)
+
+// SplitHunks splits a unified diff into its hunks, each starting with its
+// @@ header. Text before the first header is kept with the first hunk.
+func SplitHunks(unified string) []string {
+	var hunks []string
+	var current strings.Builder
+	hasHeader := false
+	for _, line := range strings.SplitAfter(unified, "\n") {
+		if strings.HasPrefix(line, "@@ ") {
+			if hasHeader {
+				hunks = append(hunks, current.String())
+				current.Reset()
+			}
+			hasHeader = true
+		}
+		current.WriteString(line)
+	}
+	if current.Len() > 0 {
+		hunks = append(hunks, current.String())
+	}
+	return hunks
+}
+
+// TrimDiffContext reduces every hunk of a unified diff to at most n lines of
+// unchanged context around the changed lines, splitting hunks where the
+// context in between is dropped
+func TrimDiffContext(unified string, n int) string {
+	var b strings.Builder
+	for _, hunk := range SplitHunks(unified) {
+		lines := strings.SplitAfter(hunk, "\n")
+		if lines[len(lines)-1] == "" {
+			lines = lines[:len(lines)-1]
+		}
+		m := hunkHeader.FindStringSubmatch(strings.TrimSuffix(lines[0], "\n"))
+		if m == nil {
+			b.WriteString(hunk)
+			continue
+		}
+		oldLine, _ := strconv.Atoi(m[1])
+		newLine, _ := strconv.Atoi(m[3])
+		// Empty sides point at the line before
+		if m[2] == "0" {
+			oldLine++
+		}
+		if m[4] == "0" {
+			newLine++
+		}
+		trimHunk(&b, lines[1:], oldLine, newLine, n)
+	}
+	return b.String()
+}
+
+// trimHunk writes the body lines of a hunk starting at oldLine and newLine
+// as hunks with at most n lines of context
+func trimHunk(b *strings.Builder, lines []string, oldLine, newLine, n int) {
+	// Distance of every line to the nearest changed line
+	distance := make([]int, len(lines))
+	last := -len(lines) - n - 1
+	for i, line := range lines {
+		if isChangedLine(line) {
+			last = i
+		}
+		distance[i] = i - last
+	}
+	last = 2*len(lines) + n + 1
+	for i := len(lines) - 1; i >= 0; i-- {
+		if isChangedLine(lines[i]) {
+			last = i
+		}
+		distance[i] = min(distance[i], last-i)
+	}
+
+	type hunk struct {
+		oldStart, newStart, oldCount, newCount int
+		body                                   strings.Builder
+	}
+	var current *hunk
+	flush := func() {
+		if current == nil {
+			return
+		}
+		oldStart, newStart := current.oldStart, current.newStart
+		// Empty sides point at the line before
+		if current.oldCount == 0 {
+			oldStart--
+		}
+		if current.newCount == 0 {
+			newStart--
+		}
+		fmt.Fprintf(b, "@@ -%d,%d +%d,%d @@\n", oldStart, current.oldCount, newStart, current.newCount)
+		b.WriteString(current.body.String())
+		current = nil
+	}
+
+	kept := false
+	for i, line := range lines {
+		if strings.HasPrefix(line, `\`) {
+			// "\ No newline at end of file" belongs to the line before
+			if kept {
+				current.body.WriteString(line)
+			}
+			continue
+		}
+		kept = distance[i] <= n
+		if kept {
+			if current == nil {
+				current = &hunk{oldStart: oldLine, newStart: newLine}
+			}
+			current.body.WriteString(line)
+		} else {
+			flush()
+		}
+		switch {
+		case strings.HasPrefix(line, "-"):
+			oldLine++
+			if kept {
+				current.oldCount++
+			}
+		case strings.HasPrefix(line, "+"):
+			newLine++
+			if kept {
+				current.newCount++
+			}
+		default:
+			oldLine++
+			newLine++
+			if kept {
+				current.oldCount++
+				current.newCount++
+			}
+		}
+	}
+	flush()
+}
+
+// isChangedLine reports whether a hunk line was added or removed
+func isChangedLine(line string) bool {
+	return strings.HasPrefix(line, "+") || strings.HasPrefix(line, "-")
+}
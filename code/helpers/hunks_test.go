@@ -0,0 +1,76 @@
+package helpers
+
+import (
+	"reflect"
+	"testing"
+)
+
+const twoHunks = `@@ -1,7 +1,7 @@
+ a
+ b
+ c
+-d
++D
+ e
+ f
+ g
+@@ -20,3 +20,4 @@
+ t
+ u
++v
+ w
+`
+
+func TestSplitHunks(t *testing.T) {
+	want := []string{
+		"@@ -1,7 +1,7 @@\n a\n b\n c\n-d\n+D\n e\n f\n g\n",
+		"@@ -20,3 +20,4 @@\n t\n u\n+v\n w\n",
+	}
+	if got := SplitHunks(twoHunks); !reflect.DeepEqual(got, want) {
+		t.Errorf("SplitHunks() = %q, want %q", got, want)
+	}
+	if got := SplitHunks(""); got != nil {
+		t.Errorf("SplitHunks(\"\") = %q, want nil", got)
+	}
+}
+
+func TestTrimDiffContext(t *testing.T) {
+	tests := []struct {
+		name    string
+		unified string
+		n       int
+		want    string
+	}{
+		{
+			name:    "one line of context",
+			unified: twoHunks,
+			n:       1,
+			want:    "@@ -3,3 +3,3 @@\n c\n-d\n+D\n e\n@@ -21,2 +21,3 @@\n u\n+v\n w\n",
+		},
+		{
+			name:    "no context",
+			unified: twoHunks,
+			n:       0,
+			want:    "@@ -4,1 +4,1 @@\n-d\n+D\n@@ -21,0 +22,1 @@\n+v\n",
+		},
+		{
+			name:    "hunk split where context is dropped",
+			unified: "@@ -1,7 +1,7 @@\n-a\n+A\n b\n c\n d\n e\n-f\n+F\n",
+			n:       1,
+			want:    "@@ -1,2 +1,2 @@\n-a\n+A\n b\n@@ -5,2 +5,2 @@\n e\n-f\n+F\n",
+		},
+		{
+			name:    "created object",
+			unified: "@@ -0,0 +1,2 @@\n+a\n+b\n",
+			n:       1,
+			want:    "@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TrimDiffContext(tt.unified, tt.n); got != tt.want {
+				t.Errorf("TrimDiffContext() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
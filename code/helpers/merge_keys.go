@@ -0,0 +1,281 @@
+package helpers
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	batchv1 "k8s.io/api/batch/v1"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	schedulingv1 "k8s.io/api/scheduling/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// fallbackMergeKey identifies list elements of kinds without type information,
+// such as custom resources, when every element carries a unique value for it
+const fallbackMergeKey = "name"
+
+// fieldSchema describes a field of a built-in kind as far as list merge keys
+// are concerned. The merge keys come from the patchMergeKey struct tags that
+// strategic merge patch uses, e.g. containers by name and ports by
+// containerPort.
+type fieldSchema struct {
+	// t is the Go type of the field, nil when unknown
+	t reflect.Type
+	// mergeKey is the merge key of the list held by this field
+	mergeKey string
+	// typed is set inside built-in kinds, which never use the fallback key
+	typed bool
+	// set is set for lists of scalars whose order carries no meaning
+	set bool
+}
+
+// setStructs are types whose scalar lists are all unordered sets even though
+// they carry no patch strategy
+var setStructs = map[reflect.Type]bool{
+	reflect.TypeOf(rbacv1.PolicyRule{}):   true,
+	reflect.TypeOf(corev1.Capabilities{}): true,
+}
+
+var (
+	kindTypesOnce sync.Once
+	kindTypes     map[schema.GroupVersionKind]reflect.Type
+
+	// structFields caches the fields of each struct type by JSON name
+	structFields sync.Map
+)
+
+// schemaFor returns the schema of the kind named by the object's apiVersion
+// and kind, or an untyped schema for kinds that are not built in
+func schemaFor(objects ...map[string]any) fieldSchema {
+	kindTypesOnce.Do(loadKindTypes)
+
+	for _, obj := range objects {
+		if obj == nil {
+			continue
+		}
+		apiVersion, _ := obj["apiVersion"].(string)
+		kind, _ := obj["kind"].(string)
+		gv, err := schema.ParseGroupVersion(apiVersion)
+		if err != nil {
+			continue
+		}
+		if t, ok := kindTypes[gv.WithKind(kind)]; ok {
+			return fieldSchema{t: t, typed: true}
+		}
+	}
+	return fieldSchema{}
+}
+
+// GroupOfKind returns the API group of a built-in kind, matched ignoring
+// case; ok is false for unknown kinds and kinds served by several groups
+func GroupOfKind(kind string) (group string, ok bool) {
+	kindTypesOnce.Do(loadKindTypes)
+
+	for gvk := range kindTypes {
+		if !strings.EqualFold(gvk.Kind, kind) || gvk.Version == runtime.APIVersionInternal {
+			continue
+		}
+		if ok && gvk.Group != group {
+			return "", false
+		}
+		group, ok = gvk.Group, true
+	}
+	return group, ok
+}
+
+// loadKindTypes indexes the Go types of the built-in API groups
+func loadKindTypes() {
+	scheme := runtime.NewScheme()
+	for _, addToScheme := range []func(*runtime.Scheme) error{
+		admissionregistrationv1.AddToScheme,
+		appsv1.AddToScheme,
+		autoscalingv2.AddToScheme,
+		batchv1.AddToScheme,
+		coordinationv1.AddToScheme,
+		corev1.AddToScheme,
+		discoveryv1.AddToScheme,
+		networkingv1.AddToScheme,
+		policyv1.AddToScheme,
+		rbacv1.AddToScheme,
+		schedulingv1.AddToScheme,
+		storagev1.AddToScheme,
+	} {
+		// AddToScheme only fails on conflicting registrations
+		_ = addToScheme(scheme)
+	}
+	kindTypes = scheme.AllKnownTypes()
+}
+
+// field returns the schema of the named field of a struct, or of the values
+// of a map
+func (s fieldSchema) field(name string) fieldSchema {
+	if s.t == nil {
+		return fieldSchema{typed: s.typed}
+	}
+	switch s.t.Kind() {
+	case reflect.Map:
+		return fieldSchema{t: indirectType(s.t.Elem()), typed: true}
+	case reflect.Struct:
+		if field, ok := fieldsOf(s.t)[name]; ok {
+			return field
+		}
+	}
+	return fieldSchema{typed: true}
+}
+
+// elem returns the schema of the elements of a list
+func (s fieldSchema) elem() fieldSchema {
+	if s.t == nil || s.t.Kind() != reflect.Slice {
+		return fieldSchema{typed: s.typed}
+	}
+	return fieldSchema{t: indirectType(s.t.Elem()), typed: true}
+}
+
+// listKey returns the key identifying the elements of the two lists, if every
+// element of each list is an object with a unique scalar value for it
+func (s fieldSchema) listKey(lists ...[]any) (string, bool) {
+	key := s.mergeKey
+	if !s.typed {
+		key = fallbackMergeKey
+	}
+	if key == "" {
+		return "", false
+	}
+
+	for _, list := range lists {
+		seen := make(map[string]bool, len(list))
+		for _, elem := range list {
+			id, ok := elementKey(elem, key)
+			if !ok || seen[id] {
+				return "", false
+			}
+			seen[id] = true
+		}
+	}
+	return key, true
+}
+
+// elementKey returns the value of key in a list element as a string
+func elementKey(elem any, key string) (string, bool) {
+	obj, ok := elem.(map[string]any)
+	if !ok {
+		return "", false
+	}
+	switch v := obj[key].(type) {
+	case string, float64, int64, int, bool:
+		return fmt.Sprint(v), true
+	}
+	return "", false
+}
+
+// fieldsOf returns the fields of a struct type by JSON name, including the
+// fields of inlined structs
+func fieldsOf(t reflect.Type) map[string]fieldSchema {
+	if cached, ok := structFields.Load(t); ok {
+		return cached.(map[string]fieldSchema)
+	}
+
+	fields := make(map[string]fieldSchema)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous && (name == "" || strings.Contains(opts, "inline")) {
+			if embedded := indirectType(f.Type); embedded.Kind() == reflect.Struct {
+				for k, v := range fieldsOf(embedded) {
+					fields[k] = v
+				}
+			}
+			continue
+		}
+		if name == "" || !f.IsExported() {
+			continue
+		}
+		fieldType := indirectType(f.Type)
+		isScalarList := fieldType.Kind() == reflect.Slice && fieldType.Elem().Kind() == reflect.String
+		fields[name] = fieldSchema{
+			t:        fieldType,
+			mergeKey: f.Tag.Get("patchMergeKey"),
+			typed:    true,
+			set:      isScalarList && (strings.Contains(f.Tag.Get("patchStrategy"), "merge") || setStructs[t]),
+		}
+	}
+
+	structFields.Store(t, fields)
+	return fields
+}
+
+// indirectType strips pointers from t
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t
+}
+
+// alignLists returns a copy of newValue with the elements of keyed lists in
+// the order of the matching elements in oldValue, followed by new elements, so
+// a reordered list does not show up as a change in the line diff
+func alignLists(s fieldSchema, oldValue, newValue any) any {
+	switch newTyped := newValue.(type) {
+	case map[string]any:
+		oldMap, _ := oldValue.(map[string]any)
+		aligned := make(map[string]any, len(newTyped))
+		for key, child := range newTyped {
+			aligned[key] = alignLists(s.field(key), oldMap[key], child)
+		}
+		return aligned
+
+	case []any:
+		oldList, _ := oldValue.([]any)
+		elem := s.elem()
+		key, keyed := s.listKey(oldList, newTyped)
+		if !keyed {
+			aligned := make([]any, len(newTyped))
+			for i, child := range newTyped {
+				var oldChild any
+				if i < len(oldList) {
+					oldChild = oldList[i]
+				}
+				aligned[i] = alignLists(elem, oldChild, child)
+			}
+			return aligned
+		}
+
+		newByKey := make(map[string]any, len(newTyped))
+		for _, child := range newTyped {
+			id, _ := elementKey(child, key)
+			newByKey[id] = child
+		}
+		aligned := make([]any, 0, len(newTyped))
+		matched := make(map[string]bool, len(oldList))
+		for _, oldChild := range oldList {
+			id, _ := elementKey(oldChild, key)
+			if child, ok := newByKey[id]; ok {
+				aligned = append(aligned, alignLists(elem, oldChild, child))
+				matched[id] = true
+			}
+		}
+		for _, child := range newTyped {
+			if id, _ := elementKey(child, key); !matched[id] {
+				aligned = append(aligned, alignLists(elem, nil, child))
+			}
+		}
+		return aligned
+	}
+	return newValue
+}
@@ -0,0 +1,132 @@
+package helpers
+
+import (
+	"reflect"
+	"testing"
+)
+
+// podWith returns a Deployment whose pod template has the given containers
+func podWith(containers ...any) map[string]any {
+	return map[string]any{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"spec": map[string]any{"template": map[string]any{"spec": map[string]any{
+			"containers": containers,
+		}}},
+	}
+}
+
+// container returns a container with one port and one environment variable
+func container(name, image string, port int) map[string]any {
+	return map[string]any{
+		"name":  name,
+		"image": image,
+		"ports": []any{map[string]any{"containerPort": port}},
+		"env":   []any{map[string]any{"name": "MODE", "value": "fast"}},
+	}
+}
+
+func TestDiffObjectsMergeKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new map[string]any
+		want     []Change
+	}{
+		{
+			name: "reordered containers are not a change",
+			old:  podWith(container("app", "app:1", 80), container("proxy", "envoy:1", 9901)),
+			new:  podWith(container("proxy", "envoy:1", 9901), container("app", "app:1", 80)),
+		},
+		{
+			name: "containers by name",
+			old:  podWith(container("app", "app:1", 80), container("proxy", "envoy:1", 9901)),
+			new:  podWith(container("proxy", "envoy:1", 9901), container("app", "app:2", 80)),
+			want: []Change{{
+				Path: "spec.template.spec.containers[name=app].image", Op: ChangeReplace, OldValue: "app:1", NewValue: "app:2",
+			}},
+		},
+		{
+			name: "ports by containerPort",
+			old:  podWith(container("app", "app:1", 80)),
+			new:  podWith(container("app", "app:1", 8080)),
+			want: []Change{
+				{Path: "spec.template.spec.containers[name=app].ports[containerPort=8080]", Op: ChangeAdd, NewValue: map[string]any{"containerPort": 8080}},
+				{Path: "spec.template.spec.containers[name=app].ports[containerPort=80]", Op: ChangeRemove, OldValue: map[string]any{"containerPort": 80}},
+			},
+		},
+		{
+			name: "added and removed containers",
+			old:  podWith(container("app", "app:1", 80), container("proxy", "envoy:1", 9901)),
+			new:  podWith(container("app", "app:1", 80), container("agent", "agent:1", 8125)),
+			want: []Change{
+				{Path: "spec.template.spec.containers[name=agent]", Op: ChangeAdd, NewValue: container("agent", "agent:1", 8125)},
+				{Path: "spec.template.spec.containers[name=proxy]", Op: ChangeRemove, OldValue: container("proxy", "envoy:1", 9901)},
+			},
+		},
+		{
+			name: "lists without a merge key by index",
+			old:  podWith(map[string]any{"name": "app", "args": []any{"--a", "--b"}}),
+			new:  podWith(map[string]any{"name": "app", "args": []any{"--b", "--a"}}),
+			want: []Change{
+				{Path: "spec.template.spec.containers[name=app].args[0]", Op: ChangeReplace, OldValue: "--a", NewValue: "--b"},
+				{Path: "spec.template.spec.containers[name=app].args[1]", Op: ChangeReplace, OldValue: "--b", NewValue: "--a"},
+			},
+		},
+		{
+			name: "custom resources fall back to name",
+			old: map[string]any{"apiVersion": "example.com/v1", "kind": "Pipeline", "spec": map[string]any{"steps": []any{
+				map[string]any{"name": "build", "run": "make"}, map[string]any{"name": "test", "run": "make test"},
+			}}},
+			new: map[string]any{"apiVersion": "example.com/v1", "kind": "Pipeline", "spec": map[string]any{"steps": []any{
+				map[string]any{"name": "test", "run": "go test"}, map[string]any{"name": "build", "run": "make"},
+			}}},
+			want: []Change{{Path: "spec.steps[name=test].run", Op: ChangeReplace, OldValue: "make test", NewValue: "go test"}},
+		},
+		{
+			name: "duplicate keys fall back to index",
+			old: map[string]any{"apiVersion": "example.com/v1", "kind": "Pipeline", "spec": map[string]any{"steps": []any{
+				map[string]any{"name": "build", "run": "make"}, map[string]any{"name": "build", "run": "make all"},
+			}}},
+			new: map[string]any{"apiVersion": "example.com/v1", "kind": "Pipeline", "spec": map[string]any{"steps": []any{
+				map[string]any{"name": "build", "run": "make all"}, map[string]any{"name": "build", "run": "make"},
+			}}},
+			want: []Change{
+				{Path: "spec.steps[0].run", Op: ChangeReplace, OldValue: "make", NewValue: "make all"},
+				{Path: "spec.steps[1].run", Op: ChangeReplace, OldValue: "make all", NewValue: "make"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DiffObjects(tt.old, tt.new)
+			if err != nil {
+				t.Fatalf("DiffObjects() error = %v", err)
+			}
+			if !reflect.DeepEqual(got.Changes, tt.want) {
+				t.Errorf("Changes = %v, want %v", got.Changes, tt.want)
+			}
+			if (got.Unified == "") != (tt.want == nil) {
+				t.Errorf("Unified = %q, want a diff only when fields changed", got.Unified)
+			}
+		})
+	}
+}
+
+func TestSplitPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{".", nil},
+		{"spec.replicas", []string{"spec", "replicas"}},
+		{"spec.containers[name=app].env[0]", []string{"spec", "containers", "[name=app]", "env", "[0]"}},
+		{`metadata.annotations["example.com/owner"]`, []string{"metadata", "annotations", "example.com/owner"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := SplitPath(tt.path); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SplitPath() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
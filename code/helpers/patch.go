@@ -0,0 +1,257 @@
+package helpers
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// RedactedPrefix starts the placeholder the redaction stage writes in place
+// of a sensitive value, e.g. <redacted sha256:9f86d081884c7d65>
+const RedactedPrefix = "<redacted "
+
+// PatchOperation is one operation of an RFC 6902 JSON Patch
+type PatchOperation struct {
+	Op    string
+	Path  string
+	Value any
+}
+
+// MarshalJSON omits the value of remove operations, but keeps null, false
+// and zero values of the other operations
+func (o PatchOperation) MarshalJSON() ([]byte, error) {
+	if o.Op == "remove" {
+		return json.Marshal(struct {
+			Op   string `json:"op"`
+			Path string `json:"path"`
+		}{o.Op, o.Path})
+	}
+	return json.Marshal(struct {
+		Op    string `json:"op"`
+		Path  string `json:"path"`
+		Value any    `json:"value"`
+	}{o.Op, o.Path, o.Value})
+}
+
+// UnmarshalJSON decodes an operation written by MarshalJSON
+func (o *PatchOperation) UnmarshalJSON(data []byte) error {
+	var op struct {
+		Op    string `json:"op"`
+		Path  string `json:"path"`
+		Value any    `json:"value"`
+	}
+	if err := json.Unmarshal(data, &op); err != nil {
+		return err
+	}
+	*o = PatchOperation{Op: op.Op, Path: op.Path, Value: op.Value}
+	return nil
+}
+
+// JSONPatch returns the RFC 6902 operations that turn oldObj into newObj.
+// Lists are patched element by element where only some elements were
+// inserted, removed or changed in place, and replaced as a whole otherwise.
+func JSONPatch(oldObj, newObj map[string]any) []PatchOperation {
+	return appendPatchOperations(nil, "", oldObj, newObj)
+}
+
+func appendPatchOperations(ops []PatchOperation, path string, oldValue, newValue any) []PatchOperation {
+	oldMap, oldIsMap := oldValue.(map[string]any)
+	newMap, newIsMap := newValue.(map[string]any)
+	if oldIsMap && newIsMap {
+		for _, key := range sortedKeys(oldMap) {
+			if _, ok := newMap[key]; !ok {
+				ops = append(ops, PatchOperation{Op: "remove", Path: path + "/" + escapePointer(key)})
+			}
+		}
+		for _, key := range sortedKeys(newMap) {
+			childPath := path + "/" + escapePointer(key)
+			oldChild, ok := oldMap[key]
+			if !ok {
+				ops = append(ops, PatchOperation{Op: "add", Path: childPath, Value: newMap[key]})
+				continue
+			}
+			ops = appendPatchOperations(ops, childPath, oldChild, newMap[key])
+		}
+		return ops
+	}
+
+	oldList, oldIsList := oldValue.([]any)
+	newList, newIsList := newValue.([]any)
+	if oldIsList && newIsList {
+		return appendListOperations(ops, path, oldList, newList)
+	}
+
+	if !reflect.DeepEqual(oldValue, newValue) {
+		ops = append(ops, PatchOperation{Op: "replace", Path: path, Value: newValue})
+	}
+	return ops
+}
+
+// appendListOperations patches the part of the list between the common
+// prefix and suffix of the two lists
+func appendListOperations(ops []PatchOperation, path string, oldList, newList []any) []PatchOperation {
+	prefix := 0
+	for prefix < len(oldList) && prefix < len(newList) && reflect.DeepEqual(oldList[prefix], newList[prefix]) {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(oldList)-prefix && suffix < len(newList)-prefix &&
+		reflect.DeepEqual(oldList[len(oldList)-1-suffix], newList[len(newList)-1-suffix]) {
+		suffix++
+	}
+	oldMiddle := oldList[prefix : len(oldList)-suffix]
+	newMiddle := newList[prefix : len(newList)-suffix]
+
+	index := func(i int) string { return path + "/" + strconv.Itoa(prefix+i) }
+	switch {
+	case len(oldMiddle) == len(newMiddle):
+		for i := range newMiddle {
+			ops = appendPatchOperations(ops, index(i), oldMiddle[i], newMiddle[i])
+		}
+	case len(oldMiddle) == 0:
+		for i, elem := range newMiddle {
+			ops = append(ops, PatchOperation{Op: "add", Path: index(i), Value: elem})
+		}
+	case len(newMiddle) == 0:
+		// Remove from the end so earlier indexes stay valid
+		for i := len(oldMiddle) - 1; i >= 0; i-- {
+			ops = append(ops, PatchOperation{Op: "remove", Path: index(i)})
+		}
+	default:
+		ops = append(ops, PatchOperation{Op: "replace", Path: path, Value: newList})
+	}
+	return ops
+}
+
+// MergePatch returns the RFC 7386 merge patch that turns oldObj into newObj.
+// Removed fields are set to null and changed lists are replaced as a whole.
+func MergePatch(oldObj, newObj map[string]any) map[string]any {
+	patch := make(map[string]any)
+	for key, oldChild := range oldObj {
+		if _, ok := newObj[key]; !ok {
+			patch[key] = nil
+			continue
+		}
+		newChild := newObj[key]
+		if reflect.DeepEqual(oldChild, newChild) {
+			continue
+		}
+		oldMap, oldIsMap := oldChild.(map[string]any)
+		newMap, newIsMap := newChild.(map[string]any)
+		if oldIsMap && newIsMap {
+			patch[key] = MergePatch(oldMap, newMap)
+			continue
+		}
+		patch[key] = newChild
+	}
+	for key, newChild := range newObj {
+		if _, ok := oldObj[key]; !ok {
+			patch[key] = newChild
+		}
+	}
+	return patch
+}
+
+// replayablePatch drops the operations that would not reproduce the change
+// on the live object and returns the paths it dropped. These are operations
+// that write a redacted placeholder, and operations that write a set-like
+// list such as finalizers, which normalization has sorted, or address its
+// elements by index.
+func replayablePatch(s fieldSchema, ops []PatchOperation) ([]PatchOperation, []string) {
+	var kept []PatchOperation
+	var omitted []string
+	for _, op := range ops {
+		if containsRedacted(op.Value) || writesSet(s, op) {
+			omitted = append(omitted, op.Path)
+			continue
+		}
+		kept = append(kept, op)
+	}
+	return kept, omitted
+}
+
+// replayableMergePatch is replayablePatch for a merge patch
+func replayableMergePatch(s fieldSchema, path string, patch map[string]any) (map[string]any, []string) {
+	kept := make(map[string]any, len(patch))
+	var omitted []string
+	for _, key := range sortedKeys(patch) {
+		childPath := path + "/" + escapePointer(key)
+		child := s.field(key)
+		value := patch[key]
+		if m, ok := value.(map[string]any); ok && len(m) > 0 {
+			prunedChild, childOmitted := replayableMergePatch(child, childPath, m)
+			omitted = append(omitted, childOmitted...)
+			if len(prunedChild) > 0 {
+				kept[key] = prunedChild
+			}
+			continue
+		}
+		if containsRedacted(value) || (child.set && value != nil) {
+			omitted = append(omitted, childPath)
+			continue
+		}
+		kept[key] = value
+	}
+	return kept, omitted
+}
+
+// writesSet reports whether op writes a set-like list or one of its
+// elements. Removing the whole list is independent of its order.
+func writesSet(s fieldSchema, op PatchOperation) bool {
+	if op.Path == "" {
+		return false
+	}
+	for _, segment := range strings.Split(op.Path[1:], "/") {
+		if s.set {
+			return true
+		}
+		if s.t != nil && s.t.Kind() == reflect.Slice {
+			s = s.elem()
+		} else {
+			s = s.field(unescapePointer(segment))
+		}
+	}
+	return s.set && op.Op != "remove"
+}
+
+// containsRedacted reports whether value holds a redacted placeholder
+func containsRedacted(value any) bool {
+	switch v := value.(type) {
+	case string:
+		return strings.Contains(v, RedactedPrefix)
+	case map[string]any:
+		for _, child := range v {
+			if containsRedacted(child) {
+				return true
+			}
+		}
+	case []any:
+		for _, child := range v {
+			if containsRedacted(child) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// escapePointer escapes a key for use in a JSON Pointer (RFC 6901)
+func escapePointer(key string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
+
+// unescapePointer reverses escapePointer
+func unescapePointer(segment string) string {
+	return strings.NewReplacer("~1", "/", "~0", "~").Replace(segment)
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,180 @@
+package helpers
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// mustDecode decodes a JSON document
+func mustDecode(t *testing.T, data string) map[string]any {
+	t.Helper()
+	var obj map[string]any
+	if err := json.Unmarshal([]byte(data), &obj); err != nil {
+		t.Fatalf("failed to decode %s: %v", data, err)
+	}
+	return obj
+}
+
+func TestJSONPatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		want     string
+	}{
+		{
+			name: "fields",
+			old:  `{"spec": {"replicas": 1, "paused": true}, "metadata": {"annotations": {"a/b": "x"}}}`,
+			new:  `{"spec": {"replicas": 2, "minReadySeconds": 0}, "metadata": {"annotations": {"a/b": "y"}}}`,
+			want: `[
+				{"op": "replace", "path": "/metadata/annotations/a~1b", "value": "y"},
+				{"op": "remove", "path": "/spec/paused"},
+				{"op": "add", "path": "/spec/minReadySeconds", "value": 0},
+				{"op": "replace", "path": "/spec/replicas", "value": 2}
+			]`,
+		},
+		{
+			name: "elements inserted and removed",
+			old:  `{"args": ["a", "b", "c", "d"]}`,
+			new:  `{"args": ["a", "x", "y", "d"]}`,
+			want: `[
+				{"op": "replace", "path": "/args/1", "value": "x"},
+				{"op": "replace", "path": "/args/2", "value": "y"}
+			]`,
+		},
+		{
+			name: "elements removed from the end first",
+			old:  `{"args": ["a", "b", "c", "d"]}`,
+			new:  `{"args": ["a", "d"]}`,
+			want: `[{"op": "remove", "path": "/args/2"}, {"op": "remove", "path": "/args/1"}]`,
+		},
+		{
+			name: "list replaced as a whole",
+			old:  `{"args": ["a", "b", "c"]}`,
+			new:  `{"args": ["a", "x"]}`,
+			want: `[{"op": "replace", "path": "/args", "value": ["a", "x"]}]`,
+		},
+		{
+			name: "null values",
+			old:  `{"value": null}`,
+			new:  `{"value": false}`,
+			want: `[{"op": "replace", "path": "/value", "value": false}]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json.Marshal(JSONPatch(mustDecode(t, tt.old), mustDecode(t, tt.new)))
+			if err != nil {
+				t.Fatalf("failed to marshal patch: %v", err)
+			}
+			var gotOps, wantOps []any
+			json.Unmarshal(got, &gotOps)
+			if err := json.Unmarshal([]byte(tt.want), &wantOps); err != nil {
+				t.Fatalf("failed to decode want: %v", err)
+			}
+			if !reflect.DeepEqual(gotOps, wantOps) {
+				t.Errorf("JSONPatch() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	old := mustDecode(t, `{"spec": {"replicas": 1, "paused": true, "args": ["a"]}, "kind": "Deployment"}`)
+	new := mustDecode(t, `{"spec": {"replicas": 2, "args": ["a", "b"], "selector": {"app": "web"}}, "kind": "Deployment"}`)
+	want := mustDecode(t, `{"spec": {"replicas": 2, "paused": null, "args": ["a", "b"], "selector": {"app": "web"}}}`)
+	if got := MergePatch(old, new); !reflect.DeepEqual(got, want) {
+		t.Errorf("MergePatch() = %v, want %v", got, want)
+	}
+}
+
+func TestDiffObjectsOmitsUnreplayablePatches(t *testing.T) {
+	tests := []struct {
+		name        string
+		old, new    string
+		wantPatch   string
+		wantRevert  string
+		wantMerge   string
+		wantOmitted []string
+	}{
+		{
+			name: "redacted values",
+			old: `{"apiVersion": "v1", "kind": "Secret", "type": "Opaque",
+				"stringData": {"password": "<redacted sha256:1111111111111111>", "user": "<redacted sha256:2222222222222222>"}}`,
+			new: `{"apiVersion": "v1", "kind": "Secret", "type": "kubernetes.io/basic-auth",
+				"stringData": {"password": "<redacted sha256:3333333333333333>"}}`,
+			wantPatch:   `[{"op": "remove", "path": "/stringData/user"}, {"op": "replace", "path": "/type", "value": "kubernetes.io/basic-auth"}]`,
+			wantRevert:  `[{"op": "replace", "path": "/type", "value": "Opaque"}]`,
+			wantMerge:   `{"stringData": {"user": null}, "type": "kubernetes.io/basic-auth"}`,
+			wantOmitted: []string{"/stringData/password", "/stringData/user"},
+		},
+		{
+			name: "redacted part of an environment variable list",
+			old: `{"apiVersion": "v1", "kind": "Pod", "spec": {"containers": [{"name": "app",
+				"env": [{"name": "TOKEN", "value": "<redacted sha256:1111111111111111>"}]}]}}`,
+			new: `{"apiVersion": "v1", "kind": "Pod", "spec": {"containers": [{"name": "app",
+				"env": [{"name": "TOKEN", "value": "<redacted sha256:1111111111111111>"}, {"name": "MODE", "value": "fast"}]}]}}`,
+			wantPatch:  `[{"op": "add", "path": "/spec/containers/0/env/1", "value": {"name": "MODE", "value": "fast"}}]`,
+			wantRevert: `[{"op": "remove", "path": "/spec/containers/0/env/1"}]`,
+			// The merge patch would replace the whole list
+			wantOmitted: []string{"/spec/containers"},
+		},
+		{
+			name: "sorted set-like lists",
+			old: `{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": {"finalizers": ["a.example.com", "c.example.com"]},
+				"spec": {"replicas": 1}}`,
+			new: `{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": {"finalizers": ["a.example.com", "b.example.com", "c.example.com"]},
+				"spec": {"replicas": 2}}`,
+			wantPatch:   `[{"op": "replace", "path": "/spec/replicas", "value": 2}]`,
+			wantRevert:  `[{"op": "replace", "path": "/spec/replicas", "value": 1}]`,
+			wantMerge:   `{"spec": {"replicas": 2}}`,
+			wantOmitted: []string{"/metadata/finalizers", "/metadata/finalizers/1"},
+		},
+		{
+			name:      "removing a set-like list",
+			old:       `{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": {"finalizers": ["a.example.com"]}}`,
+			new:       `{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": {}}`,
+			wantPatch: `[{"op": "remove", "path": "/metadata/finalizers"}]`,
+			wantMerge: `{"metadata": {"finalizers": null}}`,
+			// The revert patch would add the sorted list back
+			wantOmitted: []string{"/metadata/finalizers"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DiffObjects(mustDecode(t, tt.old), mustDecode(t, tt.new))
+			if err != nil {
+				t.Fatalf("DiffObjects() error = %v", err)
+			}
+			assertJSON(t, "JSONPatch", got.JSONPatch, tt.wantPatch)
+			assertJSON(t, "RevertPatch", got.RevertPatch, tt.wantRevert)
+			assertJSON(t, "MergePatch", got.MergePatch, tt.wantMerge)
+			if !reflect.DeepEqual(got.OmittedPatchPaths, tt.wantOmitted) {
+				t.Errorf("OmittedPatchPaths = %q, want %q", got.OmittedPatchPaths, tt.wantOmitted)
+			}
+		})
+	}
+}
+
+// assertJSON compares the JSON encoding of got with want, where an empty want
+// stands for an empty or missing value
+func assertJSON(t *testing.T, name string, got any, want string) {
+	t.Helper()
+	data, err := json.Marshal(got)
+	if err != nil {
+		t.Fatalf("failed to marshal %s: %v", name, err)
+	}
+	var gotValue, wantValue any
+	json.Unmarshal(data, &gotValue)
+	if want != "" {
+		if err := json.Unmarshal([]byte(want), &wantValue); err != nil {
+			t.Fatalf("failed to decode want %s: %v", name, err)
+		}
+	}
+	if v := reflect.ValueOf(gotValue); gotValue != nil && v.Len() == 0 {
+		gotValue = nil
+	}
+	if !reflect.DeepEqual(gotValue, wantValue) {
+		t.Errorf("%s = %s, want %s", name, data, want)
+	}
+}
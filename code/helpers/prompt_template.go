@@ -0,0 +1,186 @@
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// PromptData is the data model of SYSTEM_PROMPT, USER_MESSAGE_TEMPLATE and
+// DELETE_MESSAGE_TEMPLATE
+type PromptData struct {
+	// Kind, Group and Version identify the type of the resource; Group is
+	// empty for the core group
+	Kind    string
+	Group   string
+	Version string
+
+	// Namespace is empty for cluster-scoped resources
+	Namespace string
+	Name      string
+
+	// Operation is CREATE, UPDATE or DELETE
+	Operation string
+
+	// Cluster is the configured CLUSTER_NAME
+	Cluster string
+
+	// OldObject and NewObject are the resource before and after the change as
+	// YAML, empty when it did not exist. For deletions OldObject is the final state.
+	OldObject string
+	NewObject string
+
+	// Old and New are the same objects as maps, e.g. {{.New.spec.replicas}}
+	Old map[string]any
+	New map[string]any
+
+	// GitDiff is the unified diff of the filtered objects
+	GitDiff string
+
+	// Changes lists the changed fields one per line; ChangeList holds the
+	// same changes with their path, op, oldValue and newValue
+	Changes    string
+	ChangeList []Change
+
+	// User is the requesting Kubernetes user, UserType one of Human, Service
+	// Account or System Component, and Groups the user's groups
+	User     string
+	UserType string
+	Groups   string
+
+	// Impersonator is the user who impersonated User, if known
+	Impersonator string
+
+	// Labels and Annotations are those of the new object, or of the final
+	// state for deletions
+	Labels      map[string]string
+	Annotations map[string]string
+}
+
+// PromptFuncs returns the functions available in prompt templates. redact
+// replaces a value with its redaction hash; it is nil during validation.
+func PromptFuncs(redact func(any) any) template.FuncMap {
+	if redact == nil {
+		redact = func(value any) any { return value }
+	}
+	return template.FuncMap{
+		// toYaml renders a value as YAML, e.g. {{toYaml .New.spec}}
+		"toYaml": func(value any) (string, error) {
+			if value == nil {
+				return "", nil
+			}
+			data, err := yaml.Marshal(value)
+			return strings.TrimSuffix(string(data), "\n"), err
+		},
+		// toJson renders a value as compact JSON
+		"toJson": func(value any) (string, error) {
+			data, err := json.Marshal(value)
+			return string(data), err
+		},
+		// truncate shortens text to at most n characters, e.g. {{.GitDiff | truncate 4000}}
+		"truncate": truncateText,
+		// redact hashes a value like the redaction rules do
+		"redact": redact,
+	}
+}
+
+// truncateText shortens s to n characters, marking the cut
+func truncateText(n int, s string) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:max(n, 0)]) + "\n... (truncated)"
+}
+
+// ParsePromptTemplate parses a prompt template and checks that every field it
+// reads from the top-level data exists in PromptData
+func ParsePromptTemplate(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Funcs(PromptFuncs(nil)).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if tmpl.Tree != nil {
+		if err := checkPromptFields(tmpl.Tree.Root); err != nil {
+			return nil, fmt.Errorf("template: %s: %w", name, err)
+		}
+	}
+	return tmpl, nil
+}
+
+// promptFields are the field names of PromptData
+var promptFields = func() map[string]bool {
+	fields := make(map[string]bool)
+	t := reflect.TypeOf(PromptData{})
+	for i := 0; i < t.NumField(); i++ {
+		fields[t.Field(i).Name] = true
+	}
+	return fields
+}()
+
+// checkPromptFields walks the template and reports the first unknown field
+// read from the top-level data. The bodies of range and with are skipped as
+// they change the data that fields refer to.
+func checkPromptFields(node parse.Node) error {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return nil
+		}
+		for _, child := range n.Nodes {
+			if err := checkPromptFields(child); err != nil {
+				return err
+			}
+		}
+	case *parse.ActionNode:
+		return checkPromptFields(n.Pipe)
+	case *parse.IfNode:
+		return checkPromptBranch(&n.BranchNode, true)
+	case *parse.RangeNode:
+		return checkPromptBranch(&n.BranchNode, false)
+	case *parse.WithNode:
+		return checkPromptBranch(&n.BranchNode, false)
+	case *parse.TemplateNode:
+		return checkPromptFields(n.Pipe)
+	case *parse.PipeNode:
+		if n == nil {
+			return nil
+		}
+		for _, cmd := range n.Cmds {
+			if err := checkPromptFields(cmd); err != nil {
+				return err
+			}
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			if err := checkPromptFields(arg); err != nil {
+				return err
+			}
+		}
+	case *parse.FieldNode:
+		if !promptFields[n.Ident[0]] {
+			return fmt.Errorf("unknown field .%s", n.Ident[0])
+		}
+	}
+	return nil
+}
+
+// checkPromptBranch checks the pipeline and else branch, and the body when
+// it keeps the data of its parent
+func checkPromptBranch(n *parse.BranchNode, sameData bool) error {
+	if err := checkPromptFields(n.Pipe); err != nil {
+		return err
+	}
+	if sameData {
+		if err := checkPromptFields(n.List); err != nil {
+			return err
+		}
+	}
+	return checkPromptFields(n.ElseList)
+}
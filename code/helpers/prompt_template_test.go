@@ -0,0 +1,60 @@
+package helpers
+
+import (
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestParsePromptTemplate(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		wantErr string
+	}{
+		{"fields", "{{.Kind}} {{.Namespace}}/{{.Name}} {{.New.spec.replicas}}", ""},
+		{"unknown field", "{{.Kind}} {{.Diff}}", "unknown field .Diff"},
+		{"unknown field in if", "{{if .Cluster}}{{.Clsuter}}{{end}}", "unknown field .Clsuter"},
+		{"unknown field in else", "{{with .Old}}{{.spec}}{{else}}{{.Nwe}}{{end}}", "unknown field .Nwe"},
+		{"range changes the data", "{{range .ChangeList}}{{.Path}} {{.Op}}{{end}}", ""},
+		{"functions", "{{toYaml .New.spec}} {{toJson .Labels}} {{.GitDiff | truncate 10}} {{redact .Old.data}}", ""},
+		{"syntax error", "{{.Kind", "unclosed action"},
+		{"unknown function", "{{lower .Kind}}", `function "lower" not defined`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParsePromptTemplate("prompt", tt.text)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("ParsePromptTemplate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParsePromptTemplate() error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPromptFuncs(t *testing.T) {
+	redact := func(value any) any { return "<redacted>" }
+	tmpl := template.Must(template.New("prompt").Funcs(PromptFuncs(redact)).Parse(
+		"{{toYaml .New.spec}}|{{toJson .Labels}}|{{.GitDiff | truncate 5}}|{{.User | truncate 20}}|{{redact .Old.data}}|{{toYaml .Old.missing}}"))
+
+	var b strings.Builder
+	err := tmpl.Execute(&b, PromptData{
+		New:     map[string]any{"spec": map[string]any{"replicas": 3}},
+		Old:     map[string]any{"data": map[string]any{"password": "hunter2"}},
+		Labels:  map[string]string{"app": "web"},
+		GitDiff: "ünïcödé diff",
+		User:    "alice",
+	})
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	want := "replicas: 3|{\"app\":\"web\"}|ünïcö\n... (truncated)|alice|<redacted>|"
+	if b.String() != want {
+		t.Errorf("Execute() = %q, want %q", b.String(), want)
+	}
+}
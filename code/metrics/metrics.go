@@ -0,0 +1,206 @@
+// Package metrics provides a minimal registry of counters and gauges that is
+// exposed in the Prometheus text exposition format on the /metrics endpoint.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Counter is a monotonically increasing value
+type Counter struct {
+	v atomic.Uint64
+}
+
+// Inc increments the counter by one
+func (c *Counter) Inc() {
+	c.v.Add(1)
+}
+
+// Add increments the counter by n
+func (c *Counter) Add(n uint64) {
+	c.v.Add(n)
+}
+
+// Gauge is a value that can go up and down
+type Gauge struct {
+	bits atomic.Uint64
+}
+
+// Set replaces the gauge value
+func (g *Gauge) Set(v float64) {
+	g.bits.Store(math.Float64bits(v))
+}
+
+// Add adds delta to the gauge value
+func (g *Gauge) Add(delta float64) {
+	for {
+		old := g.bits.Load()
+		if g.bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+delta)) {
+			return
+		}
+	}
+}
+
+// Inc increments the gauge by one
+func (g *Gauge) Inc() {
+	g.Add(1)
+}
+
+// Dec decrements the gauge by one
+func (g *Gauge) Dec() {
+	g.Add(-1)
+}
+
+// Value returns the current gauge value
+func (g *Gauge) Value() float64 {
+	return math.Float64frombits(g.bits.Load())
+}
+
+// CounterVec is a family of counters partitioned by the value of a single label
+type CounterVec struct {
+	label    string
+	mu       sync.Mutex
+	counters map[string]*Counter
+}
+
+// With returns the counter for the given label value, creating it if needed
+func (cv *CounterVec) With(value string) *Counter {
+	cv.mu.Lock()
+	defer cv.mu.Unlock()
+	c, ok := cv.counters[value]
+	if !ok {
+		c = &Counter{}
+		cv.counters[value] = c
+	}
+	return c
+}
+
+// GaugeVec is a family of gauges partitioned by the value of a single label
+type GaugeVec struct {
+	label  string
+	mu     sync.Mutex
+	gauges map[string]*Gauge
+}
+
+// With returns the gauge for the given label value, creating it if needed
+func (gv *GaugeVec) With(value string) *Gauge {
+	gv.mu.Lock()
+	defer gv.mu.Unlock()
+	g, ok := gv.gauges[value]
+	if !ok {
+		g = &Gauge{}
+		gv.gauges[value] = g
+	}
+	return g
+}
+
+// family is a registered metric and how to render its samples
+type family struct {
+	name    string
+	help    string
+	typ     string
+	samples func() []sample
+}
+
+type sample struct {
+	labels string
+	value  float64
+}
+
+var (
+	registryMu sync.Mutex
+	registry   []family
+)
+
+func register(f family) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry = append(registry, f)
+}
+
+// NewCounter registers and returns a counter
+func NewCounter(name, help string) *Counter {
+	c := &Counter{}
+	register(family{name: name, help: help, typ: "counter", samples: func() []sample {
+		return []sample{{value: float64(c.v.Load())}}
+	}})
+	return c
+}
+
+// NewGauge registers and returns a gauge
+func NewGauge(name, help string) *Gauge {
+	g := &Gauge{}
+	register(family{name: name, help: help, typ: "gauge", samples: func() []sample {
+		return []sample{{value: g.Value()}}
+	}})
+	return g
+}
+
+// NewCounterVec registers and returns a counter family keyed by label
+func NewCounterVec(name, help, label string) *CounterVec {
+	cv := &CounterVec{label: label, counters: map[string]*Counter{}}
+	register(family{name: name, help: help, typ: "counter", samples: func() []sample {
+		cv.mu.Lock()
+		defer cv.mu.Unlock()
+		samples := make([]sample, 0, len(cv.counters))
+		for value, c := range cv.counters {
+			samples = append(samples, sample{
+				labels: fmt.Sprintf("{%s=%q}", cv.label, value),
+				value:  float64(c.v.Load()),
+			})
+		}
+		return samples
+	}})
+	return cv
+}
+
+// NewGaugeVec registers and returns a gauge family keyed by label
+func NewGaugeVec(name, help, label string) *GaugeVec {
+	gv := &GaugeVec{label: label, gauges: map[string]*Gauge{}}
+	register(family{name: name, help: help, typ: "gauge", samples: func() []sample {
+		gv.mu.Lock()
+		defer gv.mu.Unlock()
+		samples := make([]sample, 0, len(gv.gauges))
+		for value, g := range gv.gauges {
+			samples = append(samples, sample{
+				labels: fmt.Sprintf("{%s=%q}", gv.label, value),
+				value:  g.Value(),
+			})
+		}
+		return samples
+	}})
+	return gv
+}
+
+// Write renders every registered metric in the Prometheus text format
+func Write(w io.Writer) error {
+	registryMu.Lock()
+	families := slices.Clone(registry)
+	registryMu.Unlock()
+
+	slices.SortFunc(families, func(a, b family) int {
+		return strings.Compare(a.name, b.name)
+	})
+
+	for _, f := range families {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.typ); err != nil {
+			return err
+		}
+		samples := f.samples()
+		slices.SortFunc(samples, func(a, b sample) int {
+			return strings.Compare(a.labels, b.labels)
+		})
+		for _, s := range samples {
+			if _, err := fmt.Fprintf(w, "%s%s %g\n", f.name, s.labels, s.value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	requests := NewCounterVec("test_requests_total", "Requests by result.", "result")
+	depth := NewGauge("test_queue_depth", "Queued items.")
+	dropped := NewCounter("test_dropped_total", "Dropped items.")
+	open := NewGaugeVec("test_breaker_open", "Open breakers by model.", "model")
+
+	requests.With("ok").Add(2)
+	requests.With("error").Inc()
+	depth.Set(3)
+	depth.Dec()
+	depth.Add(0.5)
+	dropped.Inc()
+	open.With("gpt").Inc()
+
+	var b strings.Builder
+	if err := Write(&b); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	want := `# HELP test_breaker_open Open breakers by model.
+# TYPE test_breaker_open gauge
+test_breaker_open{model="gpt"} 1
+# HELP test_dropped_total Dropped items.
+# TYPE test_dropped_total counter
+test_dropped_total 1
+# HELP test_queue_depth Queued items.
+# TYPE test_queue_depth gauge
+test_queue_depth 2.5
+# HELP test_requests_total Requests by result.
+# TYPE test_requests_total counter
+test_requests_total{result="error"} 1
+test_requests_total{result="ok"} 2
+`
+	if b.String() != want {
+		t.Errorf("Write() = %q, want %q", b.String(), want)
+	}
+}
+
+func TestGaugeAddConcurrently(t *testing.T) {
+	var g Gauge
+	var wg sync.WaitGroup
+	for range 100 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			g.Inc()
+		}()
+	}
+	wg.Wait()
+	if g.Value() != 100 {
+		t.Errorf("Value() = %g, want 100", g.Value())
+	}
+}
@@ -0,0 +1,150 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"channelog/config"
+)
+
+// anthropicVersion is the Messages API version the requests are written against
+const anthropicVersion = "2023-06-01"
+
+// AnthropicService talks to the Anthropic Messages API
+type AnthropicService struct {
+	client    *http.Client
+	url       string
+	apiKey    string
+	model     string
+	maxTokens int
+}
+
+// NewAnthropicService creates a new Anthropic service instance using the provided configuration
+func NewAnthropicService(cfg *config.Config) *AnthropicService {
+	log.Info().
+		Str("model", cfg.AnthropicModel).
+		Str("api_url", cfg.AnthropicApiUrl).
+		Int("max_tokens", cfg.AnthropicMaxTokens).
+		Msg("Anthropic client initialized")
+
+	return &AnthropicService{
+		client:    &http.Client{},
+		url:       strings.TrimSuffix(cfg.AnthropicApiUrl, "/") + "/v1/messages",
+		apiKey:    cfg.AnthropicApiKey,
+		model:     cfg.AnthropicModel,
+		maxTokens: cfg.AnthropicMaxTokens,
+	}
+}
+
+type anthropicMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type anthropicRequest struct {
+	Model     string             `json:"model"`
+	MaxTokens int                `json:"max_tokens"`
+	System    string             `json:"system,omitempty"`
+	Messages  []anthropicMessage `json:"messages"`
+
+	// Tools and ToolChoice force a reply matching the input schema of a tool
+	Tools      []anthropicTool      `json:"tools,omitempty"`
+	ToolChoice *anthropicToolChoice `json:"tool_choice,omitempty"`
+}
+
+type anthropicTool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	InputSchema map[string]any `json:"input_schema"`
+}
+
+type anthropicToolChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
+}
+
+type anthropicResponse struct {
+	Content []struct {
+		Type  string          `json:"type"`
+		Text  string          `json:"text"`
+		Input json.RawMessage `json:"input"`
+	} `json:"content"`
+	StopReason string `json:"stop_reason"`
+}
+
+// Complete sends the user message with the system prompt and returns the
+// text blocks of the reply
+func (s *AnthropicService) Complete(ctx context.Context, systemPrompt, userMessage string) (string, error) {
+	response, err := s.send(ctx, s.request(systemPrompt, userMessage))
+	if err != nil {
+		return "", err
+	}
+
+	var text strings.Builder
+	for _, block := range response.Content {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+		}
+	}
+	if text.Len() == 0 {
+		return "", fmt.Errorf("no text content returned (stop reason %q)", response.StopReason)
+	}
+	return text.String(), nil
+}
+
+// CompleteJSON forces the model to call a tool whose input schema is schema
+// and returns the input of the call, the Messages API having no JSON
+// response format
+func (s *AnthropicService) CompleteJSON(ctx context.Context, systemPrompt, userMessage, schemaName string, schema map[string]any) (string, error) {
+	request := s.request(systemPrompt, userMessage)
+	request.Tools = []anthropicTool{{
+		Name:        schemaName,
+		Description: "Records the changelog entry",
+		InputSchema: schema,
+	}}
+	request.ToolChoice = &anthropicToolChoice{Type: "tool", Name: schemaName}
+
+	response, err := s.send(ctx, request)
+	if err != nil {
+		return "", err
+	}
+	for _, block := range response.Content {
+		if block.Type == "tool_use" && len(block.Input) > 0 {
+			return string(block.Input), nil
+		}
+	}
+	return "", fmt.Errorf("no tool input returned (stop reason %q)", response.StopReason)
+}
+
+// request builds a Messages API request from the system prompt and the user message
+func (s *AnthropicService) request(systemPrompt, userMessage string) anthropicRequest {
+	return anthropicRequest{
+		Model:     s.model,
+		MaxTokens: s.maxTokens,
+		System:    systemPrompt,
+		Messages:  []anthropicMessage{{Role: "user", Content: userMessage}},
+	}
+}
+
+// send posts a Messages API request
+func (s *AnthropicService) send(ctx context.Context, request anthropicRequest) (*anthropicResponse, error) {
+	headers := map[string]string{
+		"x-api-key":         s.apiKey,
+		"anthropic-version": anthropicVersion,
+	}
+
+	var response anthropicResponse
+	if err := postJSON(ctx, s.client, s.url, headers, request, &response); err != nil {
+		log.Error().Err(err).Msg("Failed to create message")
+		return nil, err
+	}
+	if response.StopReason == "max_tokens" {
+		log.Warn().Int("max_tokens", s.maxTokens).Msg("Anthropic response was truncated at max_tokens")
+	}
+	return &response, nil
+}
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"channelog/config"
+)
+
+// fakeAPI serves reply as JSON and records the last request body
+func fakeAPI(t *testing.T, status int, reply string) (*httptest.Server, *map[string]any, *http.Header) {
+	t.Helper()
+	var body map[string]any
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Clone()
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if status == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "7")
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(reply))
+	}))
+	t.Cleanup(server.Close)
+	return server, &body, &header
+}
+
+func TestAnthropicServiceComplete(t *testing.T) {
+	server, body, header := fakeAPI(t, http.StatusOK,
+		`{"content": [{"type": "text", "text": "Scaled "}, {"type": "text", "text": "web"}], "stop_reason": "end_turn"}`)
+	service := NewAnthropicService(&config.Config{
+		AnthropicApiUrl: server.URL + "/", AnthropicApiKey: "key", AnthropicModel: "model", AnthropicMaxTokens: 100,
+	})
+
+	got, err := service.Complete(context.Background(), "system", "user")
+	if err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	if got != "Scaled web" {
+		t.Errorf("Complete() = %q, want %q", got, "Scaled web")
+	}
+	if header.Get("x-api-key") != "key" || header.Get("anthropic-version") != anthropicVersion {
+		t.Errorf("headers = %v, want the API key and version", *header)
+	}
+	if (*body)["system"] != "system" || (*body)["model"] != "model" || (*body)["max_tokens"] != float64(100) {
+		t.Errorf("request = %v, want system prompt, model and max_tokens", *body)
+	}
+}
+
+func TestAnthropicServiceCompleteJSON(t *testing.T) {
+	server, body, _ := fakeAPI(t, http.StatusOK,
+		`{"content": [{"type": "tool_use", "input": {"summary": "Scaled web"}}], "stop_reason": "tool_use"}`)
+	service := NewAnthropicService(&config.Config{AnthropicApiUrl: server.URL})
+
+	got, err := service.CompleteJSON(context.Background(), "system", "user", "changelog_entry", map[string]any{"type": "object"})
+	if err != nil {
+		t.Fatalf("CompleteJSON() error = %v", err)
+	}
+	if got != `{"summary": "Scaled web"}` {
+		t.Errorf("CompleteJSON() = %s, want the tool input", got)
+	}
+	choice, _ := (*body)["tool_choice"].(map[string]any)
+	if choice["type"] != "tool" || choice["name"] != "changelog_entry" {
+		t.Errorf("tool_choice = %v, want the changelog_entry tool", choice)
+	}
+}
+
+func TestAnthropicServiceErrors(t *testing.T) {
+	server, _, _ := fakeAPI(t, http.StatusTooManyRequests, `{"error": {"type": "rate_limit_error"}}`)
+	service := NewAnthropicService(&config.Config{AnthropicApiUrl: server.URL})
+
+	_, err := service.Complete(context.Background(), "", "user")
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) {
+		t.Fatalf("Complete() error = %v, want a StatusError", err)
+	}
+	if statusErr.StatusCode != http.StatusTooManyRequests || statusErr.RetryAfter.Seconds() != 7 {
+		t.Errorf("StatusError = %+v, want 429 with Retry-After 7s", statusErr)
+	}
+
+	server, _, _ = fakeAPI(t, http.StatusOK, `{"content": [], "stop_reason": "max_tokens"}`)
+	service = NewAnthropicService(&config.Config{AnthropicApiUrl: server.URL})
+	if _, err := service.Complete(context.Background(), "", "user"); err == nil {
+		t.Error("Complete() error = nil, want an error for a reply without text")
+	}
+}
@@ -0,0 +1,125 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/rs/zerolog/log"
+
+	"channelog/helpers"
+)
+
+// batchMessage introduces the changes of a release in the user message
+const batchMessage = "The following %d Kubernetes resources were changed together as part of %s. " +
+	"Write a single changelog entry for the release as a whole: what changed across the resources and why, " +
+	"and the combined impact and risk. Each change is described below as it would be on its own.\n"
+
+// batchSplitNote is added to release entries whose changes were too large to describe together
+const batchSplitNote = "The release exceeded the prompt token budget; its resources were described separately and merged into this entry."
+
+// batchPart is a change of a release with its prompt data and template
+type batchPart struct {
+	req     EntryRequest
+	data    helpers.PromptData
+	prompts promptSet
+	tmpl    *template.Template
+}
+
+// GenerateBatchEntry asks the model for one entry covering the changes of a
+// release. Every change is rendered with the template of its prompt profile
+// and the system prompt is that of the first change. Prompts over the token
+// budget leave out the full objects and then the unchanged context of the
+// diffs; when that is not enough the changes are described one by one and
+// the entries combined.
+func (s *TemplateSummarizer) GenerateBatchEntry(ctx context.Context, release string, reqs []EntryRequest) (*Entry, error) {
+	if len(reqs) == 0 {
+		return nil, fmt.Errorf("no changes to describe")
+	}
+
+	parts := make([]batchPart, len(reqs))
+	for i, req := range reqs {
+		deletion := req.Operation == "DELETE"
+		if deletion && req.OldObject == "" {
+			return nil, fmt.Errorf("finalObject of %s %s cannot be empty", req.Kind, helpers.QualifiedName(req.Namespace, req.Name))
+		}
+		data, prompts, tmpl, err := s.prepare(req, deletion)
+		if err != nil {
+			return nil, err
+		}
+		parts[i] = batchPart{req: req, data: data, prompts: prompts, tmpl: tmpl}
+	}
+
+	log.Debug().
+		Str("release", release).
+		Int("changes", len(parts)).
+		Msg("Generating release changelog entry")
+
+	for _, strategy := range []promptStrategy{strategyFull, strategyDiffOnly, strategyTrimmedContext} {
+		prompt, err := s.renderBatch(release, parts, strategy)
+		if err != nil {
+			return nil, err
+		}
+		if !s.fits(prompt) {
+			continue
+		}
+
+		entry, err := s.completeEntry(ctx, prompt)
+		if err != nil {
+			log.Error().Err(err).Str("release", release).Msg("Failed to generate release changelog entry")
+			return nil, fmt.Errorf("failed to generate release changelog entry: %w", err)
+		}
+		promptStrategyTotal.With(string(strategy)).Inc()
+		if note := budgetNote(strategy); note != "" {
+			entry.Notes = append(entry.Notes, note)
+		}
+		return entry, nil
+	}
+
+	log.Info().
+		Str("release", release).
+		Int("changes", len(parts)).
+		Int("budget", s.budget).
+		Msg("Release exceeds the token budget, describing its changes separately")
+	entries := make([]*Entry, len(parts))
+	for i, part := range parts {
+		entry, err := s.generate(ctx, part.req, part.req.Operation == "DELETE")
+		if err != nil {
+			return nil, fmt.Errorf("change %d of %d: %w", i+1, len(parts), err)
+		}
+		entries[i] = entry
+	}
+	entry := mergeEntries(entries)
+	entry.Notes = append(entry.Notes, batchSplitNote)
+	return entry, nil
+}
+
+// renderBatch renders the system prompt of the first change and a user
+// message holding every change, with the data reduced as for strategy
+func (s *TemplateSummarizer) renderBatch(release string, parts []batchPart, strategy promptStrategy) (renderedPrompt, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, batchMessage, len(parts), release)
+
+	var system string
+	for i, part := range parts {
+		data := part.data
+		if strategy != strategyFull {
+			data.OldObject, data.NewObject = "", ""
+			data.Old, data.New = nil, nil
+		}
+		if strategy == strategyTrimmedContext {
+			data.GitDiff = helpers.TrimDiffContext(data.GitDiff, trimmedContextLines)
+		}
+
+		prompt, err := s.render(part.prompts, part.tmpl, data)
+		if err != nil {
+			return renderedPrompt{}, err
+		}
+		if i == 0 {
+			system = prompt.system
+		}
+		fmt.Fprintf(&b, "\n### %d. %s %s (%s)\n\n%s\n", i+1, data.Kind, helpers.QualifiedName(data.Namespace, data.Name), data.Operation, strings.TrimSpace(prompt.user))
+	}
+	return renderedPrompt{system: system, user: b.String()}, nil
+}
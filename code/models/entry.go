@@ -0,0 +1,233 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Impact levels of an entry
+const (
+	ImpactHigh   = "high"
+	ImpactMedium = "medium"
+	ImpactLow    = "low"
+)
+
+// EntryCategories are the categories an entry may be filed under
+var EntryCategories = []string{
+	"security",
+	"access-control",
+	"networking",
+	"capacity",
+	"performance",
+	"availability",
+	"storage",
+	"configuration",
+	"deployment",
+	"other",
+}
+
+// Entry is a changelog entry with the fields of EntrySchema. Entries from
+// the rule-based summarizer only have a Summary.
+type Entry struct {
+	// Summary describes the change in Markdown
+	Summary string `json:"summary" yaml:"summary"`
+
+	// Categories are some of EntryCategories
+	Categories []string `json:"categories" yaml:"categories,omitempty"`
+
+	// Impact is high, medium or low, or empty when unknown
+	Impact string `json:"impact" yaml:"impact,omitempty"`
+
+	// Risk describes what may go wrong because of the change
+	Risk string `json:"risk" yaml:"risk,omitempty"`
+
+	SecurityNotes      []string `json:"security_notes" yaml:"security_notes,omitempty"`
+	RecommendedActions []string `json:"recommended_actions" yaml:"recommended_actions,omitempty"`
+
+	// Notes are remarks on how the entry was written, such as a fallback
+	// after the model failed; they are not part of the schema
+	Notes []string `json:"notes,omitempty" yaml:"notes,omitempty"`
+
+	// Cached is set when the entry was reused from the response cache
+	Cached bool `json:"-" yaml:"cached,omitempty"`
+}
+
+// EntrySchema is the JSON schema of the reply requested from models. All
+// properties are required and no others allowed, as strict structured
+// output modes demand.
+var EntrySchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"summary": map[string]any{
+			"type":        "string",
+			"description": "What changed and why, in Markdown, without headings",
+		},
+		"categories": map[string]any{
+			"type":  "array",
+			"items": map[string]any{"type": "string", "enum": EntryCategories},
+		},
+		"impact": map[string]any{
+			"type":        "string",
+			"enum":        []string{ImpactHigh, ImpactMedium, ImpactLow},
+			"description": "Impact on security, performance and functionality",
+		},
+		"risk": map[string]any{
+			"type":        "string",
+			"description": "What may break or go wrong because of the change",
+		},
+		"security_notes": map[string]any{
+			"type":        "array",
+			"items":       map[string]any{"type": "string"},
+			"description": "Security implications; empty when there are none",
+		},
+		"recommended_actions": map[string]any{
+			"type":        "array",
+			"items":       map[string]any{"type": "string"},
+			"description": "Follow-up actions for operators; empty when there are none",
+		},
+	},
+	"required":             []string{"summary", "categories", "impact", "risk", "security_notes", "recommended_actions"},
+	"additionalProperties": false,
+}
+
+// entrySchemaName names EntrySchema in provider requests
+const entrySchemaName = "changelog_entry"
+
+// entryInstructions is appended to the system prompt so that models without
+// a structured output mode reply with JSON as well
+var entryInstructions = func() string {
+	schema, _ := json.MarshalIndent(EntrySchema, "", "  ")
+	return "Reply with a single JSON object matching the following JSON schema, without Markdown code fences or any other text:\n" + string(schema) + "\n"
+}()
+
+// impactAliases map other impact levels models reply with
+var impactAliases = map[string]string{
+	"critical": ImpactHigh,
+	"major":    ImpactHigh,
+	"severe":   ImpactHigh,
+	"moderate": ImpactMedium,
+	"med":      ImpactMedium,
+	"minor":    ImpactLow,
+	"none":     ImpactLow,
+	"trivial":  ImpactLow,
+}
+
+// parseEntry validates the reply of a model and repairs what it can: code
+// fences and text around the object, single strings where lists are
+// expected, unknown categories and impact levels in other words. A reply
+// that is no JSON at all becomes the summary.
+func parseEntry(content string) (*Entry, error) {
+	text := strings.TrimSpace(content)
+	start, end := strings.Index(text, "{"), strings.LastIndex(text, "}")
+	if start < 0 || end < start {
+		if text == "" {
+			return nil, fmt.Errorf("empty reply")
+		}
+		return &Entry{Summary: text}, nil
+	}
+
+	var raw map[string]any
+	if err := json.Unmarshal([]byte(text[start:end+1]), &raw); err != nil {
+		// A broken object, maybe in a code fence, rather than prose mentioning braces
+		if strings.TrimPrefix(strings.Trim(text[:start], " \t\r\n`"), "json") == "" {
+			return nil, fmt.Errorf("reply is not a valid JSON object: %w", err)
+		}
+		return &Entry{Summary: text}, nil
+	}
+
+	entry := &Entry{
+		Summary:            strings.TrimSpace(entryText(raw["summary"])),
+		Risk:               strings.TrimSpace(entryText(raw["risk"])),
+		SecurityNotes:      entryList(raw["security_notes"]),
+		RecommendedActions: entryList(raw["recommended_actions"]),
+	}
+	if entry.Summary == "" {
+		return nil, fmt.Errorf("reply has no summary")
+	}
+
+	for _, category := range entryList(raw["categories"]) {
+		category = strings.ReplaceAll(strings.ToLower(category), " ", "-")
+		if !slices.Contains(EntryCategories, category) {
+			category = "other"
+		}
+		if !slices.Contains(entry.Categories, category) {
+			entry.Categories = append(entry.Categories, category)
+		}
+	}
+
+	impact := strings.ToLower(strings.TrimSpace(entryText(raw["impact"])))
+	if alias, ok := impactAliases[impact]; ok {
+		impact = alias
+	}
+	if impact == ImpactHigh || impact == ImpactMedium || impact == ImpactLow {
+		entry.Impact = impact
+	}
+	return entry, nil
+}
+
+// entryText converts a reply field to text, joining lists into lines
+func entryText(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []any:
+		return strings.Join(entryList(v), "\n")
+	case nil:
+		return ""
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+// entryList converts a reply field to a list without empty items
+func entryList(value any) []string {
+	var items []any
+	switch v := value.(type) {
+	case []any:
+		items = v
+	case nil:
+		return nil
+	default:
+		items = []any{v}
+	}
+
+	var list []string
+	for _, item := range items {
+		if text := strings.TrimSpace(entryText(item)); text != "" {
+			list = append(list, text)
+		}
+	}
+	return list
+}
+
+// mergeEntries combines entries written for parts of one change
+func mergeEntries(entries []*Entry) *Entry {
+	merged := &Entry{}
+	var summaries, risks []string
+	for _, entry := range entries {
+		summaries = append(summaries, entry.Summary)
+		if entry.Risk != "" {
+			risks = append(risks, entry.Risk)
+		}
+		for _, category := range entry.Categories {
+			if !slices.Contains(merged.Categories, category) {
+				merged.Categories = append(merged.Categories, category)
+			}
+		}
+		if impactRank(entry.Impact) > impactRank(merged.Impact) {
+			merged.Impact = entry.Impact
+		}
+		merged.SecurityNotes = append(merged.SecurityNotes, entry.SecurityNotes...)
+		merged.RecommendedActions = append(merged.RecommendedActions, entry.RecommendedActions...)
+	}
+	merged.Summary = strings.Join(summaries, "\n\n")
+	merged.Risk = strings.Join(risks, "\n\n")
+	return merged
+}
+
+// impactRank orders impact levels, unknown first
+func impactRank(impact string) int {
+	return slices.Index([]string{ImpactLow, ImpactMedium, ImpactHigh}, impact) + 1
+}
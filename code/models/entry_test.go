@@ -0,0 +1,88 @@
+package models
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseEntry(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    *Entry
+		wantErr string
+	}{
+		{
+			name: "schema reply",
+			content: `{"summary": "Scaled web to 3 replicas.", "categories": ["capacity"], "impact": "low", "risk": "",
+				"security_notes": [], "recommended_actions": ["Watch the error rate"]}`,
+			want: &Entry{Summary: "Scaled web to 3 replicas.", Categories: []string{"capacity"}, Impact: ImpactLow,
+				RecommendedActions: []string{"Watch the error rate"}},
+		},
+		{
+			name:    "code fence and surrounding text",
+			content: "Here is the entry:\n```json\n{\"summary\": \"Scaled web.\", \"impact\": \"medium\"}\n```",
+			want:    &Entry{Summary: "Scaled web.", Impact: ImpactMedium},
+		},
+		{
+			name:    "repaired fields",
+			content: `{"summary": ["Scaled web.", "Raised limits."], "categories": ["Access Control", "capacity", "billing", "capacity"], "impact": "Critical", "security_notes": "Grants exec", "risk": 3}`,
+			want: &Entry{Summary: "Scaled web.\nRaised limits.", Categories: []string{"access-control", "capacity", "other"},
+				Impact: ImpactHigh, SecurityNotes: []string{"Grants exec"}, Risk: "3"},
+		},
+		{
+			name:    "unknown impact",
+			content: `{"summary": "Scaled web.", "impact": "enormous"}`,
+			want:    &Entry{Summary: "Scaled web."},
+		},
+		{
+			name:    "prose",
+			content: "  Scaled web to 3 replicas.\n",
+			want:    &Entry{Summary: "Scaled web to 3 replicas."},
+		},
+		{
+			name:    "prose mentioning braces",
+			content: "Set {replicas} to 3 in {spec}.",
+			want:    &Entry{Summary: "Set {replicas} to 3 in {spec}."},
+		},
+		{name: "empty", content: " \n", wantErr: "empty reply"},
+		{name: "no summary", content: `{"impact": "low"}`, wantErr: "reply has no summary"},
+		{name: "broken object", content: "```json\n{\"summary\": \"Scaled\",}\n```", wantErr: "not a valid JSON object"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseEntry(tt.content)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("parseEntry() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseEntry() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseEntry() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeEntries(t *testing.T) {
+	got := mergeEntries([]*Entry{
+		{Summary: "Raised limits.", Categories: []string{"capacity"}, Impact: ImpactLow, Risk: "Higher cost"},
+		{Summary: "Granted exec.", Categories: []string{"security", "capacity"}, Impact: ImpactHigh, SecurityNotes: []string{"Exec into pods"}},
+		{Summary: "Renamed a label.", Impact: ImpactMedium},
+	})
+	want := &Entry{
+		Summary:       "Raised limits.\n\nGranted exec.\n\nRenamed a label.",
+		Categories:    []string{"capacity", "security"},
+		Impact:        ImpactHigh,
+		Risk:          "Higher cost",
+		SecurityNotes: []string{"Exec into pods"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeEntries() = %+v, want %+v", got, want)
+	}
+}
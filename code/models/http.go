@@ -0,0 +1,91 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxErrorBody bounds how much of an error response is included in errors
+const maxErrorBody = 1024
+
+// StatusError is an unsuccessful HTTP response of a model API
+type StatusError struct {
+	URL        string
+	StatusCode int
+	Message    string
+
+	// RetryAfter is the delay requested by the Retry-After header, or zero
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	status := fmt.Sprintf("POST %s: %d %s", e.URL, e.StatusCode, http.StatusText(e.StatusCode))
+	if e.Message == "" {
+		return status
+	}
+	return status + ": " + e.Message
+}
+
+// newStatusError describes an unsuccessful response
+func newStatusError(url string, resp *http.Response, message string) *StatusError {
+	return &StatusError{
+		URL:        url,
+		StatusCode: resp.StatusCode,
+		Message:    message,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+	}
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
+
+// postJSON sends body as JSON to url and decodes the JSON response into out.
+// Responses other than 2xx are returned as errors including the start of the body.
+func postJSON(ctx context.Context, client *http.Client, url string, headers map[string]string, body, out any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return newStatusError(url, resp, string(bytes.TrimSpace(message)))
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"channelog/config"
+)
+
+// OllamaService talks to the chat endpoint of a local Ollama server
+type OllamaService struct {
+	client *http.Client
+	url    string
+	model  string
+}
+
+// NewOllamaService creates a new Ollama service instance using the provided configuration
+func NewOllamaService(cfg *config.Config) *OllamaService {
+	log.Info().
+		Str("model", cfg.OllamaModel).
+		Str("api_url", cfg.OllamaApiUrl).
+		Msg("Ollama client initialized")
+
+	return &OllamaService{
+		client: &http.Client{},
+		url:    strings.TrimSuffix(cfg.OllamaApiUrl, "/") + "/api/chat",
+		model:  cfg.OllamaModel,
+	}
+}
+
+type ollamaMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type ollamaRequest struct {
+	Model    string          `json:"model"`
+	Messages []ollamaMessage `json:"messages"`
+	Stream   bool            `json:"stream"`
+
+	// Format is a JSON schema the reply is constrained to
+	Format map[string]any `json:"format,omitempty"`
+}
+
+type ollamaResponse struct {
+	Message ollamaMessage `json:"message"`
+}
+
+// Complete sends the system prompt, if any, and the user message and returns
+// the reply without streaming
+func (s *OllamaService) Complete(ctx context.Context, systemPrompt, userMessage string) (string, error) {
+	return s.chat(ctx, s.request(systemPrompt, userMessage))
+}
+
+// CompleteJSON is Complete with the reply constrained to schema
+func (s *OllamaService) CompleteJSON(ctx context.Context, systemPrompt, userMessage, _ string, schema map[string]any) (string, error) {
+	request := s.request(systemPrompt, userMessage)
+	request.Format = schema
+	return s.chat(ctx, request)
+}
+
+// request builds a chat request from the system prompt, if any, and the user message
+func (s *OllamaService) request(systemPrompt, userMessage string) ollamaRequest {
+	request := ollamaRequest{Model: s.model}
+	if systemPrompt != "" {
+		request.Messages = append(request.Messages, ollamaMessage{Role: "system", Content: systemPrompt})
+	}
+	request.Messages = append(request.Messages, ollamaMessage{Role: "user", Content: userMessage})
+	return request
+}
+
+// chat sends a chat request and returns the content of the reply
+func (s *OllamaService) chat(ctx context.Context, request ollamaRequest) (string, error) {
+	var response ollamaResponse
+	if err := postJSON(ctx, s.client, s.url, nil, request, &response); err != nil {
+		log.Error().Err(err).Msg("Failed to create chat completion")
+		return "", err
+	}
+
+	if response.Message.Content == "" {
+		return "", fmt.Errorf("no message content returned")
+	}
+	return response.Message.Content, nil
+}
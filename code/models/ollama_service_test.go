@@ -0,0 +1,42 @@
+package models
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"channelog/config"
+)
+
+func TestOllamaServiceComplete(t *testing.T) {
+	server, body, _ := fakeAPI(t, http.StatusOK, `{"message": {"role": "assistant", "content": "Scaled web"}}`)
+	service := NewOllamaService(&config.Config{OllamaApiUrl: server.URL, OllamaModel: "llama"})
+
+	got, err := service.CompleteJSON(context.Background(), "system", "user", "changelog_entry", map[string]any{"type": "object"})
+	if err != nil {
+		t.Fatalf("CompleteJSON() error = %v", err)
+	}
+	if got != "Scaled web" {
+		t.Errorf("CompleteJSON() = %q, want %q", got, "Scaled web")
+	}
+	messages, _ := (*body)["messages"].([]any)
+	if len(messages) != 2 || (*body)["stream"] != false || (*body)["format"] == nil {
+		t.Errorf("request = %v, want system and user messages, no streaming and a format", *body)
+	}
+
+	// Without a system prompt only the user message is sent
+	if _, err := service.Complete(context.Background(), "", "user"); err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	if messages, _ := (*body)["messages"].([]any); len(messages) != 1 {
+		t.Errorf("messages = %v, want only the user message", messages)
+	}
+}
+
+func TestOllamaServiceEmptyReply(t *testing.T) {
+	server, _, _ := fakeAPI(t, http.StatusOK, `{"message": {"role": "assistant", "content": ""}}`)
+	service := NewOllamaService(&config.Config{OllamaApiUrl: server.URL})
+	if _, err := service.Complete(context.Background(), "", "user"); err == nil {
+		t.Error("Complete() error = nil, want an error for an empty reply")
+	}
+}
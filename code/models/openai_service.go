@@ -2,9 +2,8 @@ package models
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"strings"
-	"time"
 
 	"github.com/openai/openai-go"
 	"github.com/openai/openai-go/option"
@@ -14,19 +13,19 @@ import (
 	"channelog/config"
 )
 
-// OpenAIService provides OpenAI client functionality
+// OpenAIService provides OpenAI client functionality for any API compatible
+// with Chat Completions
 type OpenAIService struct {
-	client              openai.Client
-	model               shared.ChatModel
-	systemPrompt        string
-	userMessageTemplate string
-	timeout             time.Duration
+	client openai.Client
+	model  shared.ChatModel
 }
 
 // NewOpenAIService creates a new OpenAI service instance using the provided configuration
 func NewOpenAIService(cfg *config.Config) *OpenAIService {
 	opts := []option.RequestOption{
 		option.WithBaseURL(cfg.OpenAIApiUrl),
+		// Retries are handled by ResilientModel, which honors Retry-After
+		option.WithMaxRetries(0),
 	}
 
 	client := openai.NewClient(opts...)
@@ -36,14 +35,12 @@ func NewOpenAIService(cfg *config.Config) *OpenAIService {
 		Str("api_url", cfg.OpenAIApiUrl).
 		Bool("has_system_prompt", cfg.SystemPrompt != "").
 		Bool("has_user_template", cfg.UserMessageTemplate != "").
+		Bool("has_delete_template", cfg.DeleteMessageTemplate != "").
 		Msg("OpenAI client initialized")
 
 	return &OpenAIService{
-		client:              client,
-		model:               shared.ChatModel(cfg.OpenAIModel),
-		systemPrompt:        cfg.SystemPrompt,
-		userMessageTemplate: cfg.UserMessageTemplate,
-		timeout:             cfg.OpenAITimeout,
+		client: client,
+		model:  shared.ChatModel(cfg.OpenAIModel),
 	}
 }
 
@@ -54,10 +51,13 @@ func (s *OpenAIService) GetClient() *openai.Client {
 
 // CreateChatCompletion creates a chat completion using the configured model
 func (s *OpenAIService) CreateChatCompletion(ctx context.Context, messages []openai.ChatCompletionMessageParamUnion) (*openai.ChatCompletion, error) {
-	response, err := s.client.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
-		Messages: messages,
-		Model:    s.model,
-	})
+	return s.createChatCompletion(ctx, openai.ChatCompletionNewParams{Messages: messages})
+}
+
+// createChatCompletion creates a chat completion with params using the configured model
+func (s *OpenAIService) createChatCompletion(ctx context.Context, params openai.ChatCompletionNewParams) (*openai.ChatCompletion, error) {
+	params.Model = s.model
+	response, err := s.client.Chat.Completions.New(ctx, params)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to create chat completion")
 		return nil, err
@@ -65,62 +65,58 @@ func (s *OpenAIService) CreateChatCompletion(ctx context.Context, messages []ope
 	return response, nil
 }
 
-// CreateChatCompletionWithSystemPrompt creates a chat completion with the configured system prompt
-func (s *OpenAIService) CreateChatCompletionWithSystemPrompt(ctx context.Context, userMessage string) (*openai.ChatCompletion, error) {
+// Complete creates a chat completion from the system prompt, if any, and the user message
+func (s *OpenAIService) Complete(ctx context.Context, systemPrompt, userMessage string) (string, error) {
+	return s.complete(ctx, openai.ChatCompletionNewParams{
+		Messages: s.messages(systemPrompt, userMessage),
+	})
+}
+
+// CompleteJSON is Complete with a strict JSON schema response format
+func (s *OpenAIService) CompleteJSON(ctx context.Context, systemPrompt, userMessage, schemaName string, schema map[string]any) (string, error) {
+	return s.complete(ctx, openai.ChatCompletionNewParams{
+		Messages: s.messages(systemPrompt, userMessage),
+		ResponseFormat: openai.ChatCompletionNewParamsResponseFormatUnion{
+			OfJSONSchema: &shared.ResponseFormatJSONSchemaParam{
+				JSONSchema: shared.ResponseFormatJSONSchemaJSONSchemaParam{
+					Name:   schemaName,
+					Schema: schema,
+					Strict: openai.Bool(true),
+				},
+			},
+		},
+	})
+}
+
+// messages builds the system prompt, if any, and the user message
+func (s *OpenAIService) messages(systemPrompt, userMessage string) []openai.ChatCompletionMessageParamUnion {
 	messages := []openai.ChatCompletionMessageParamUnion{}
 
 	// Add system prompt if configured
-	if s.systemPrompt != "" {
-		messages = append(messages, openai.SystemMessage(s.systemPrompt))
+	if systemPrompt != "" {
+		messages = append(messages, openai.SystemMessage(systemPrompt))
 	}
 
 	// Add user message
-	messages = append(messages, openai.UserMessage(userMessage))
-
-	return s.CreateChatCompletion(ctx, messages)
+	return append(messages, openai.UserMessage(userMessage))
 }
 
-// GenerateChangelogEntry generates a changelog entry using the configured templates
-// oldObject, newObject should be YAML strings of the Kubernetes resources
-// gitDiff should be the git diff string
-func (s *OpenAIService) GenerateChangelogEntry(ctx context.Context, oldObject, newObject, gitDiff string) (string, error) {
-	if s.userMessageTemplate == "" {
-		return "", fmt.Errorf("user message template not configured")
+// complete requests a chat completion and returns the content of the first choice
+func (s *OpenAIService) complete(ctx context.Context, params openai.ChatCompletionNewParams) (string, error) {
+	response, err := s.createChatCompletion(ctx, params)
+	var apiErr *openai.Error
+	if errors.As(err, &apiErr) && apiErr.Request != nil && apiErr.Response != nil {
+		return "", newStatusError(apiErr.Request.URL.String(), apiErr.Response, apiErr.RawJSON())
 	}
-
-	// Validate inputs
-	if oldObject == "" && newObject == "" {
-		return "", fmt.Errorf("both oldObject and newObject cannot be empty")
-	}
-
-	// Replace placeholders in the template
-	userMessage := s.userMessageTemplate
-	userMessage = strings.ReplaceAll(userMessage, "{{.OldObject}}", oldObject)
-	userMessage = strings.ReplaceAll(userMessage, "{{.NewObject}}", newObject)
-	userMessage = strings.ReplaceAll(userMessage, "{{.GitDiff}}", gitDiff)
-
-	log.Debug().
-		Int("template_length", len(s.userMessageTemplate)).
-		Int("final_message_length", len(userMessage)).
-		Msg("Generated user message from template")
-
-	ctx, cancel := context.WithTimeout(ctx, s.timeout)
-	defer cancel()
-
-	response, err := s.CreateChatCompletionWithSystemPrompt(ctx, userMessage)
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to generate changelog entry")
-		return "", fmt.Errorf("failed to generate changelog entry: %w", err)
+		return "", err
 	}
 
 	if len(response.Choices) == 0 {
 		return "", fmt.Errorf("no response choices returned")
 	}
-
-	content := response.Choices[0].Message.Content
-	log.Info().
-		Int("response_length", len(content)).
-		Msg("Successfully generated changelog entry")
-
-	return content, nil
+	if refusal := response.Choices[0].Message.Refusal; refusal != "" {
+		return "", fmt.Errorf("model refused to reply: %s", refusal)
+	}
+	return response.Choices[0].Message.Content, nil
 }
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"channelog/config"
+)
+
+func TestOpenAIServiceComplete(t *testing.T) {
+	server, body, _ := fakeAPI(t, http.StatusOK,
+		`{"id": "1", "object": "chat.completion", "choices": [{"index": 0, "message": {"role": "assistant", "content": "Scaled web"}}]}`)
+	service := NewOpenAIService(&config.Config{OpenAIApiUrl: server.URL, OpenAIModel: "gpt"})
+
+	got, err := service.CompleteJSON(context.Background(), "system", "user", "changelog_entry", map[string]any{"type": "object"})
+	if err != nil {
+		t.Fatalf("CompleteJSON() error = %v", err)
+	}
+	if got != "Scaled web" {
+		t.Errorf("CompleteJSON() = %q, want %q", got, "Scaled web")
+	}
+	format, _ := (*body)["response_format"].(map[string]any)
+	if (*body)["model"] != "gpt" || format["type"] != "json_schema" {
+		t.Errorf("request = %v, want the model and a JSON schema response format", *body)
+	}
+}
+
+func TestOpenAIServiceErrors(t *testing.T) {
+	server, _, _ := fakeAPI(t, http.StatusTooManyRequests, `{"error": {"message": "slow down"}}`)
+	service := NewOpenAIService(&config.Config{OpenAIApiUrl: server.URL})
+
+	_, err := service.Complete(context.Background(), "", "user")
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusTooManyRequests || statusErr.RetryAfter.Seconds() != 7 {
+		t.Errorf("Complete() error = %v, want a 429 StatusError with Retry-After 7s", err)
+	}
+
+	server, _, _ = fakeAPI(t, http.StatusOK,
+		`{"id": "1", "object": "chat.completion", "choices": [{"index": 0, "message": {"role": "assistant", "refusal": "no"}}]}`)
+	service = NewOpenAIService(&config.Config{OpenAIApiUrl: server.URL})
+	if _, err := service.Complete(context.Background(), "", "user"); err == nil {
+		t.Error("Complete() error = nil, want an error for a refusal")
+	}
+}
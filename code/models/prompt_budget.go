@@ -0,0 +1,230 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/rs/zerolog/log"
+
+	"channelog/helpers"
+	"channelog/metrics"
+)
+
+var promptStrategyTotal = metrics.NewCounterVec("channelog_llm_prompt_strategy_total", "Changelog entries by how the prompt was reduced to fit the token budget: full, diff_only, trimmed_context or hunks.", "strategy")
+
+// promptStrategy is how a prompt was reduced to fit the token budget
+type promptStrategy string
+
+const (
+	// strategyFull sends the prompt as rendered
+	strategyFull promptStrategy = "full"
+	// strategyDiffOnly leaves out the full objects and keeps the diff
+	strategyDiffOnly promptStrategy = "diff_only"
+	// strategyTrimmedContext also drops unchanged lines around the changes
+	strategyTrimmedContext promptStrategy = "trimmed_context"
+	// strategyHunks describes groups of hunks separately and merges the parts
+	strategyHunks promptStrategy = "hunks"
+)
+
+// trimmedContextLines is the context kept around changed lines by strategyTrimmedContext
+const trimmedContextLines = 1
+
+// maxPromptParts bounds the requests made for a single entry by strategyHunks
+const maxPromptParts = 8
+
+// mergeMessage asks the model to combine the entries written for the parts of a diff
+const mergeMessage = "The change to %s %s was too large to describe at once, so the diff was split into %d parts. " +
+	"Combine the changelog entries written for the parts, given as JSON below, into a single changelog entry, " +
+	"without repeating yourself or mentioning the parts.\n"
+
+// renderedPrompt is a system prompt and user message ready to send
+type renderedPrompt struct {
+	system string
+	user   string
+}
+
+// complete renders the prompts and requests the entry. Prompts over the
+// token budget are reduced step by step: the full objects are left out,
+// then the unchanged context of the diff, and finally groups of hunks are
+// described separately and merged. The returned strategy tells which step
+// was needed.
+func (s *TemplateSummarizer) complete(ctx context.Context, prompts promptSet, tmpl *template.Template, data helpers.PromptData) (*Entry, promptStrategy, error) {
+	prompt, err := s.render(prompts, tmpl, data)
+	if err != nil {
+		return nil, "", err
+	}
+	if s.fits(prompt) {
+		entry, err := s.completeEntry(ctx, prompt)
+		return entry, strategyFull, err
+	}
+	log.Info().
+		Int("estimated_tokens", s.estimate(prompt)).
+		Int("budget", s.budget).
+		Msg("Prompt exceeds the token budget, leaving out the full objects")
+
+	data.OldObject, data.NewObject = "", ""
+	data.Old, data.New = nil, nil
+	if prompt, err = s.render(prompts, tmpl, data); err != nil {
+		return nil, "", err
+	}
+	if s.fits(prompt) {
+		entry, err := s.completeEntry(ctx, prompt)
+		return entry, strategyDiffOnly, err
+	}
+
+	data.GitDiff = helpers.TrimDiffContext(data.GitDiff, trimmedContextLines)
+	if prompt, err = s.render(prompts, tmpl, data); err != nil {
+		return nil, "", err
+	}
+	if s.fits(prompt) {
+		entry, err := s.completeEntry(ctx, prompt)
+		return entry, strategyTrimmedContext, err
+	}
+
+	entry, err := s.completeHunks(ctx, prompts, tmpl, data)
+	return entry, strategyHunks, err
+}
+
+// completeHunks describes groups of hunks that fit the budget one request
+// at a time and asks the model to merge the entries. When the entries are
+// too large to merge they are combined without the model.
+func (s *TemplateSummarizer) completeHunks(ctx context.Context, prompts promptSet, tmpl *template.Template, data helpers.PromptData) (*Entry, error) {
+	diff := data.GitDiff
+	// The changed fields cover the whole diff; every part only sees its hunks
+	data.GitDiff, data.Changes, data.ChangeList = "", "", nil
+	base, err := s.render(prompts, tmpl, data)
+	if err != nil {
+		return nil, err
+	}
+	available := s.budget - s.estimate(base)
+	if available <= 0 {
+		return nil, fmt.Errorf("prompt templates alone exceed the token budget of %d", s.budget)
+	}
+
+	parts := s.groupHunks(helpers.SplitHunks(diff), available)
+	if len(parts) > maxPromptParts {
+		return nil, fmt.Errorf("diff needs %d prompts to fit the token budget of %d, more than %d", len(parts), s.budget, maxPromptParts)
+	}
+	log.Info().
+		Int("parts", len(parts)).
+		Int("budget", s.budget).
+		Msg("Prompt exceeds the token budget, describing the diff in parts")
+
+	entries := make([]*Entry, len(parts))
+	for i, part := range parts {
+		data.GitDiff = part
+		prompt, err := s.render(prompts, tmpl, data)
+		if err != nil {
+			return nil, err
+		}
+		if entries[i], err = s.completeEntry(ctx, prompt); err != nil {
+			return nil, fmt.Errorf("part %d of %d: %w", i+1, len(parts), err)
+		}
+	}
+	if len(entries) == 1 {
+		return entries[0], nil
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, mergeMessage, data.Kind, helpers.QualifiedName(data.Namespace, data.Name), len(entries))
+	for i, entry := range entries {
+		part, err := json.MarshalIndent(entry, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode part %d: %w", i+1, err)
+		}
+		fmt.Fprintf(&b, "\n### Part %d\n\n%s\n", i+1, part)
+	}
+	merge := renderedPrompt{system: base.system, user: b.String()}
+	if s.fits(merge) {
+		return s.completeEntry(ctx, merge)
+	}
+
+	log.Info().Int("parts", len(entries)).Msg("Entries for the parts exceed the token budget, combining them")
+	return mergeEntries(entries), nil
+}
+
+// completeEntry requests an entry matching EntrySchema, through the
+// structured output mode of the model when it has one, and validates it
+func (s *TemplateSummarizer) completeEntry(ctx context.Context, prompt renderedPrompt) (*Entry, error) {
+	var content string
+	var err error
+	if model, ok := s.model.(StructuredChatModel); ok {
+		content, err = model.CompleteJSON(ctx, prompt.system, prompt.user, entrySchemaName, EntrySchema)
+	} else {
+		content, err = s.model.Complete(ctx, prompt.system, prompt.user)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err := parseEntry(content)
+	if err != nil {
+		return nil, fmt.Errorf("invalid changelog entry: %w", err)
+	}
+	return entry, nil
+}
+
+// groupHunks joins consecutive hunks into parts of at most available
+// tokens. A hunk larger than that on its own is cut short.
+func (s *TemplateSummarizer) groupHunks(hunks []string, available int) []string {
+	var parts []string
+	var current strings.Builder
+	for _, hunk := range hunks {
+		if s.tokens.Estimate(hunk) > available {
+			hunk = s.tokens.truncate(hunk, available)
+		}
+		if current.Len() > 0 && s.tokens.Estimate(current.String()+hunk) > available {
+			parts = append(parts, current.String())
+			current.Reset()
+		}
+		current.WriteString(hunk)
+	}
+	if current.Len() > 0 {
+		parts = append(parts, current.String())
+	}
+	return parts
+}
+
+// render renders the system prompt, followed by the instructions for the
+// reply format, and the user message
+func (s *TemplateSummarizer) render(prompts promptSet, tmpl *template.Template, data helpers.PromptData) (renderedPrompt, error) {
+	system, err := renderTemplate(prompts.systemPrompt, data)
+	if err != nil {
+		return renderedPrompt{}, err
+	}
+	if system != "" {
+		system = strings.TrimRight(system, "\n") + "\n\n"
+	}
+	system += entryInstructions
+	user, err := renderTemplate(tmpl, data)
+	if err != nil {
+		return renderedPrompt{}, err
+	}
+	return renderedPrompt{system: system, user: user}, nil
+}
+
+// estimate returns the estimated tokens of a prompt
+func (s *TemplateSummarizer) estimate(prompt renderedPrompt) int {
+	return s.tokens.Estimate(prompt.system) + s.tokens.Estimate(prompt.user)
+}
+
+// fits reports whether a prompt is within the token budget
+func (s *TemplateSummarizer) fits(prompt renderedPrompt) bool {
+	return s.budget <= 0 || s.estimate(prompt) <= s.budget
+}
+
+// budgetNote records in an entry how its prompt was reduced
+func budgetNote(strategy promptStrategy) string {
+	switch strategy {
+	case strategyDiffOnly:
+		return "The resource exceeded the prompt token budget; this entry was written from the diff without the full objects."
+	case strategyTrimmedContext:
+		return "The resource exceeded the prompt token budget; this entry was written from the changed lines of the diff only."
+	case strategyHunks:
+		return "The change exceeded the prompt token budget; parts of the diff were described separately and merged into this entry."
+	}
+	return ""
+}
@@ -0,0 +1,171 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"channelog/helpers"
+)
+
+// largeRequest is an update of a ConfigMap with many keys of which the
+// first and the last changed, so the diff has two hunks
+func largeRequest(t *testing.T) EntryRequest {
+	t.Helper()
+	oldData, newData := map[string]any{}, map[string]any{}
+	for i := range 200 {
+		key := fmt.Sprintf("key-%03d", i)
+		oldData[key] = "value"
+		newData[key] = "value"
+	}
+	newData["key-000"], newData["key-199"] = "changed", "changed"
+	oldObj := map[string]any{"kind": "ConfigMap", "data": oldData}
+	newObj := map[string]any{"kind": "ConfigMap", "data": newData}
+
+	diff, err := helpers.DiffObjects(oldObj, newObj)
+	if err != nil {
+		t.Fatalf("DiffObjects() error = %v", err)
+	}
+	oldJSON, _ := json.Marshal(oldObj)
+	newJSON, _ := json.Marshal(newObj)
+	return EntryRequest{
+		Kind: "ConfigMap", Version: "v1", Namespace: "prod", Name: "settings", Operation: "UPDATE",
+		OldObject: string(oldJSON), NewObject: string(newJSON), Diff: diff,
+	}
+}
+
+func TestTemplateSummarizerBudgetStrategies(t *testing.T) {
+	model := &recordingModel{reply: `{"summary": "Changed two keys", "impact": "low"}`}
+	summarizer, err := NewTemplateSummarizer(testConfig("", "{{.OldObject}}{{.NewObject}}\n{{.GitDiff}}", ""), model, nil)
+	if err != nil {
+		t.Fatalf("NewTemplateSummarizer() error = %v", err)
+	}
+	data, prompts, tmpl, err := summarizer.prepare(largeRequest(t), false)
+	if err != nil {
+		t.Fatalf("prepare() error = %v", err)
+	}
+
+	// budget returns the estimated tokens of the prompt for data changed by edit
+	budget := func(edit func(*helpers.PromptData)) int {
+		d := data
+		edit(&d)
+		prompt, err := summarizer.render(prompts, tmpl, d)
+		if err != nil {
+			t.Fatalf("render() error = %v", err)
+		}
+		return summarizer.estimate(prompt)
+	}
+	withoutObjects := func(d *helpers.PromptData) { d.OldObject, d.NewObject = "", "" }
+	trimmed := func(d *helpers.PromptData) {
+		withoutObjects(d)
+		d.GitDiff = helpers.TrimDiffContext(d.GitDiff, trimmedContextLines)
+	}
+	largestHunk := func(d *helpers.PromptData) {
+		withoutObjects(d)
+		d.GitDiff = helpers.SplitHunks(d.GitDiff)[0]
+	}
+
+	tests := []struct {
+		name      string
+		budget    int
+		want      promptStrategy
+		wantCalls int
+	}{
+		{"unlimited", 0, strategyFull, 1},
+		{"objects fit", budget(func(*helpers.PromptData) {}), strategyFull, 1},
+		{"diff fits", budget(withoutObjects), strategyDiffOnly, 1},
+		{"changed lines fit", budget(trimmed), strategyTrimmedContext, 1},
+		// The entries of the parts are too large to merge within the
+		// budget, so they are combined without another request
+		{"hunks fit one at a time", budget(largestHunk), strategyHunks, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model.users = nil
+			summarizer.budget = tt.budget
+			entry, strategy, err := summarizer.complete(context.Background(), prompts, tmpl, data)
+			if err != nil {
+				t.Fatalf("complete() error = %v", err)
+			}
+			if strategy != tt.want {
+				t.Errorf("strategy = %s, want %s", strategy, tt.want)
+			}
+			if len(model.users) != tt.wantCalls {
+				t.Errorf("model calls = %d, want %d", len(model.users), tt.wantCalls)
+			}
+			if entry.Summary == "" {
+				t.Error("Summary is empty")
+			}
+			for _, user := range model.users {
+				if tt.budget > 0 && summarizer.tokens.Estimate(user) > tt.budget {
+					t.Errorf("user message of %d tokens exceeds the budget of %d", summarizer.tokens.Estimate(user), tt.budget)
+				}
+			}
+		})
+	}
+
+	for i, part := range model.users {
+		if strings.Count(part, "@@ -") != 1 {
+			t.Errorf("part %d = %q, want one hunk", i+1, part)
+		}
+	}
+
+	summarizer.budget = 10
+	if _, _, err := summarizer.complete(context.Background(), prompts, tmpl, data); err == nil {
+		t.Error("complete() error = nil, want the templates to exceed the budget")
+	}
+}
+
+func TestTokenEstimator(t *testing.T) {
+	if got := NewTokenEstimator("library/llama3.1").ratio(); got != 3.4 {
+		t.Errorf("ratio = %v, want 3.4 for a namespaced llama model", got)
+	}
+	if got := NewTokenEstimator("gpt-4o-mini").ratio(); got != 3.6 {
+		t.Errorf("ratio = %v, want 3.6 for gpt-4o", got)
+	}
+	estimator := NewTokenEstimator("unknown")
+	if got := estimator.Estimate(strings.Repeat("x", 300)); got != 101 {
+		t.Errorf("Estimate() = %d, want 101", got)
+	}
+
+	text := strings.Repeat("line of text\n", 100)
+	truncated := estimator.truncate(text, 50)
+	if estimator.Estimate(truncated) > 50 || !strings.HasSuffix(truncated, "\n... (truncated)\n") {
+		t.Errorf("truncate() = %q, want at most 50 tokens cut at a line break", truncated)
+	}
+}
+
+func TestTemplateSummarizerMergesHunkEntries(t *testing.T) {
+	// Long instructions in the user message leave room to merge the parts,
+	// as the merge request does not repeat them
+	instructions := strings.Repeat("Describe the change precisely. ", 40)
+	model := &recordingModel{reply: `{"summary": "Changed a key", "impact": "low"}`}
+	summarizer, err := NewTemplateSummarizer(testConfig("", instructions+"\n{{.OldObject}}{{.NewObject}}{{.GitDiff}}", ""), model, nil)
+	if err != nil {
+		t.Fatalf("NewTemplateSummarizer() error = %v", err)
+	}
+	data, prompts, tmpl, err := summarizer.prepare(largeRequest(t), false)
+	if err != nil {
+		t.Fatalf("prepare() error = %v", err)
+	}
+	part := data
+	part.OldObject, part.NewObject = "", ""
+	part.GitDiff = helpers.SplitHunks(data.GitDiff)[0]
+	prompt, err := summarizer.render(prompts, tmpl, part)
+	if err != nil {
+		t.Fatalf("render() error = %v", err)
+	}
+	summarizer.budget = summarizer.estimate(prompt)
+
+	if _, strategy, err := summarizer.complete(context.Background(), prompts, tmpl, data); err != nil || strategy != strategyHunks {
+		t.Fatalf("complete() = %s, %v, want the hunks strategy", strategy, err)
+	}
+	if len(model.users) != 3 {
+		t.Fatalf("model calls = %d, want two parts and a merge", len(model.users))
+	}
+	if merge := model.users[2]; !strings.Contains(merge, "split into 2 parts") || !strings.Contains(merge, "### Part 2") {
+		t.Errorf("merge message = %q, want both parts", merge)
+	}
+}
@@ -0,0 +1,374 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"channelog/metrics"
+)
+
+var (
+	attemptsTotal        = metrics.NewCounterVec("channelog_llm_attempts_total", "Model requests by outcome: success, retry or error.", "result")
+	rateLimitWaitsTotal  = metrics.NewCounterVec("channelog_llm_rate_limit_waits_total", "Model requests delayed by the client-side rate limit.", "bucket")
+	rateLimitAvailable   = metrics.NewGaugeVec("channelog_llm_rate_limit_available", "Requests or tokens left in the rate limit bucket; negative while requests wait.", "bucket")
+	circuitState         = metrics.NewGaugeVec("channelog_llm_circuit_state", "1 for the current state of the model circuit breaker: closed, open or half_open.", "state")
+	circuitRejectedTotal = metrics.NewCounter("channelog_llm_circuit_rejected_total", "Model requests rejected without an attempt because the circuit breaker was open.")
+)
+
+// ErrCircuitOpen is returned without contacting the provider while it is
+// considered degraded
+var ErrCircuitOpen = errors.New("circuit breaker open: model provider is degraded")
+
+// ResilienceOptions configure how ResilientModel calls a provider
+type ResilienceOptions struct {
+	// Timeout bounds a single attempt; zero means no limit
+	Timeout time.Duration
+
+	// MaxRetries is how many times a failed attempt is retried
+	MaxRetries int
+
+	// RetryBackoff is the delay before the first retry; it doubles per retry
+	// up to MaxRetryBackoff and is jittered. A longer Retry-After is honored
+	// unless it exceeds MaxRetryBackoff, in which case the request fails.
+	RetryBackoff    time.Duration
+	MaxRetryBackoff time.Duration
+
+	// RequestsPerMinute and TokensPerMinute limit the request rate; zero means unlimited
+	RequestsPerMinute int
+	TokensPerMinute   int
+
+	// BreakerFailures is the number of consecutive failed requests that opens
+	// the circuit; zero disables the breaker
+	BreakerFailures int
+
+	// BreakerCooldown is how long the circuit stays open before a single
+	// request probes the provider again
+	BreakerCooldown time.Duration
+
+	// Tokens estimates the tokens of prompts and replies for TokensPerMinute
+	Tokens TokenEstimator
+}
+
+// ResilientModel retries transient failures of a chat model, limits the
+// request and token rate, and stops calling a provider that keeps failing
+type ResilientModel struct {
+	model    ChatModel
+	opts     ResilienceOptions
+	requests *tokenBucket
+	tokens   *tokenBucket
+	breaker  *circuitBreaker
+}
+
+// NewResilientModel wraps model with the given retry, rate limit and circuit
+// breaker options
+func NewResilientModel(model ChatModel, opts ResilienceOptions) *ResilientModel {
+	return &ResilientModel{
+		model:    model,
+		opts:     opts,
+		requests: newTokenBucket("requests", opts.RequestsPerMinute),
+		tokens:   newTokenBucket("tokens", opts.TokensPerMinute),
+		breaker:  newCircuitBreaker(opts.BreakerFailures, opts.BreakerCooldown),
+	}
+}
+
+// Complete sends the messages to the wrapped model, retrying transient
+// failures. While the circuit is open it fails with ErrCircuitOpen.
+func (m *ResilientModel) Complete(ctx context.Context, systemPrompt, userMessage string) (string, error) {
+	return m.call(ctx, systemPrompt, userMessage, func(ctx context.Context) (string, error) {
+		return m.model.Complete(ctx, systemPrompt, userMessage)
+	})
+}
+
+// CompleteJSON is Complete with the reply constrained to schema when the
+// wrapped model supports it
+func (m *ResilientModel) CompleteJSON(ctx context.Context, systemPrompt, userMessage, schemaName string, schema map[string]any) (string, error) {
+	structured, ok := m.model.(StructuredChatModel)
+	if !ok {
+		return m.Complete(ctx, systemPrompt, userMessage)
+	}
+	return m.call(ctx, systemPrompt, userMessage, func(ctx context.Context) (string, error) {
+		return structured.CompleteJSON(ctx, systemPrompt, userMessage, schemaName, schema)
+	})
+}
+
+// call makes the request through the circuit breaker
+func (m *ResilientModel) call(ctx context.Context, systemPrompt, userMessage string, request func(context.Context) (string, error)) (string, error) {
+	if !m.breaker.allow() {
+		circuitRejectedTotal.Inc()
+		return "", ErrCircuitOpen
+	}
+
+	content, err := m.completeWithRetry(ctx, systemPrompt, userMessage, request)
+	m.breaker.record(err)
+	return content, err
+}
+
+func (m *ResilientModel) completeWithRetry(ctx context.Context, systemPrompt, userMessage string, request func(context.Context) (string, error)) (string, error) {
+	promptTokens := m.opts.Tokens.Estimate(systemPrompt) + m.opts.Tokens.Estimate(userMessage)
+	backoff := m.opts.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		if err := m.requests.wait(ctx, 1); err != nil {
+			return "", err
+		}
+		if err := m.tokens.wait(ctx, promptTokens); err != nil {
+			return "", err
+		}
+
+		content, err := m.attempt(ctx, request)
+		if err == nil {
+			attemptsTotal.With("success").Inc()
+			m.tokens.take(m.opts.Tokens.Estimate(content))
+			return content, nil
+		}
+		if !isTransient(err) || attempt >= m.opts.MaxRetries || ctx.Err() != nil {
+			attemptsTotal.With("error").Inc()
+			return "", err
+		}
+
+		delay := jitter(backoff)
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && statusErr.RetryAfter > delay {
+			if statusErr.RetryAfter > m.opts.MaxRetryBackoff {
+				attemptsTotal.With("error").Inc()
+				return "", fmt.Errorf("%w (Retry-After %s exceeds the maximum backoff)", err, statusErr.RetryAfter)
+			}
+			delay = statusErr.RetryAfter
+		}
+		attemptsTotal.With("retry").Inc()
+		log.Warn().Err(err).
+			Int("attempt", attempt+1).
+			Dur("backoff", delay).
+			Msg("model request failed, retrying")
+
+		if err := sleep(ctx, delay); err != nil {
+			return "", err
+		}
+		backoff = min(backoff*2, m.opts.MaxRetryBackoff)
+	}
+}
+
+// attempt makes a single request within the attempt timeout
+func (m *ResilientModel) attempt(ctx context.Context, request func(context.Context) (string, error)) (string, error) {
+	if m.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.opts.Timeout)
+		defer cancel()
+	}
+	return request(ctx)
+}
+
+// isTransient reports whether a failed request may succeed when repeated:
+// rate limits, server errors, timeouts and network errors
+func isTransient(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		switch statusErr.StatusCode {
+		case http.StatusRequestTimeout, http.StatusConflict, http.StatusTooManyRequests:
+			return true
+		}
+		return statusErr.StatusCode >= 500
+	}
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr)
+}
+
+// jitter returns a random delay between half of d and d
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	half := d / 2
+	return half + rand.N(d-half+1)
+}
+
+// sleep waits for d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// tokenBucket is a rate limiter refilled continuously at perMinute per
+// minute and holding at most perMinute. Callers reserve before waiting, so
+// they are served in order.
+type tokenBucket struct {
+	name     string
+	mu       sync.Mutex
+	rate     float64
+	capacity float64
+	tokens   float64
+	last     time.Time
+}
+
+// newTokenBucket creates a full bucket, or nil for an unlimited rate
+func newTokenBucket(name string, perMinute int) *tokenBucket {
+	if perMinute <= 0 {
+		return nil
+	}
+	rateLimitAvailable.With(name).Set(float64(perMinute))
+	return &tokenBucket{
+		name:     name,
+		rate:     float64(perMinute) / 60,
+		capacity: float64(perMinute),
+		tokens:   float64(perMinute),
+		last:     time.Now(),
+	}
+}
+
+// wait reserves n tokens and blocks until they are available. Requests
+// larger than the bucket wait for a full bucket.
+func (b *tokenBucket) wait(ctx context.Context, n int) error {
+	if b == nil {
+		return nil
+	}
+	need := min(float64(n), b.capacity)
+
+	b.mu.Lock()
+	b.refill()
+	b.tokens -= need
+	deficit := -b.tokens
+	rateLimitAvailable.With(b.name).Set(b.tokens)
+	b.mu.Unlock()
+
+	if deficit <= 0 {
+		return nil
+	}
+	rateLimitWaitsTotal.With(b.name).Inc()
+	if err := sleep(ctx, time.Duration(deficit/b.rate*float64(time.Second))); err != nil {
+		b.take(-int(need))
+		return err
+	}
+	return nil
+}
+
+// take removes n tokens without waiting, e.g. for the tokens of a response
+func (b *tokenBucket) take(n int) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	b.tokens -= float64(n)
+	rateLimitAvailable.With(b.name).Set(b.tokens)
+}
+
+// refill adds the tokens accrued since the last call; the caller holds mu
+func (b *tokenBucket) refill() {
+	now := time.Now()
+	b.tokens = min(b.capacity, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// breakerState is the state of a circuitBreaker
+type breakerState string
+
+const (
+	breakerClosed   breakerState = "closed"
+	breakerOpen     breakerState = "open"
+	breakerHalfOpen breakerState = "half_open"
+)
+
+// circuitBreaker opens after a number of consecutive failures and lets a
+// single probe through once the cooldown has passed
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	state     breakerState
+	failures  int
+	openedAt  time.Time
+}
+
+// newCircuitBreaker creates a closed breaker, or nil when threshold is zero
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	if threshold <= 0 {
+		return nil
+	}
+	b := &circuitBreaker{threshold: threshold, cooldown: cooldown}
+	b.setState(breakerClosed)
+	return b
+}
+
+// allow reports whether a request may be made. Once the cooldown has passed
+// the first caller probes the provider while the others are still rejected.
+func (b *circuitBreaker) allow() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerClosed:
+		return true
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.setState(breakerHalfOpen)
+		return true
+	}
+	return false
+}
+
+// record updates the breaker with the outcome of an allowed request. Only
+// transient errors count as failures, except for the probe of a half-open
+// breaker, which has to succeed to close it again.
+func (b *circuitBreaker) record(err error) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case err == nil:
+		b.failures = 0
+		b.setState(breakerClosed)
+	case b.state == breakerHalfOpen:
+		b.failures++
+		b.openedAt = time.Now()
+		b.setState(breakerOpen)
+	case isTransient(err):
+		b.failures++
+		if b.failures >= b.threshold {
+			b.openedAt = time.Now()
+			b.setState(breakerOpen)
+		}
+	}
+}
+
+// setState changes the state and its metric; the caller holds mu
+func (b *circuitBreaker) setState(state breakerState) {
+	if b.state == state {
+		return
+	}
+	if b.state != "" {
+		log.Warn().Str("from", string(b.state)).Str("to", string(state)).
+			Int("failures", b.failures).
+			Msg("model circuit breaker state changed")
+	}
+	for _, s := range []breakerState{breakerClosed, breakerOpen, breakerHalfOpen} {
+		value := 0.0
+		if s == state {
+			value = 1
+		}
+		circuitState.With(string(s)).Set(value)
+	}
+	b.state = state
+}
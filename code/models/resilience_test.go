@@ -0,0 +1,144 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// scriptedModel replies with the next of its errors, or "ok" once they are used up
+type scriptedModel struct {
+	errs  []error
+	calls int
+}
+
+func (m *scriptedModel) Complete(context.Context, string, string) (string, error) {
+	m.calls++
+	if len(m.errs) == 0 {
+		return "ok", nil
+	}
+	err := m.errs[0]
+	m.errs = m.errs[1:]
+	if err != nil {
+		return "", err
+	}
+	return "ok", nil
+}
+
+var (
+	errUnavailable = &StatusError{StatusCode: http.StatusServiceUnavailable}
+	errBadRequest  = &StatusError{StatusCode: http.StatusBadRequest}
+)
+
+func TestResilientModelRetriesTransientErrors(t *testing.T) {
+	model := &scriptedModel{errs: []error{errUnavailable, &StatusError{StatusCode: http.StatusTooManyRequests}}}
+	resilient := NewResilientModel(model, ResilienceOptions{MaxRetries: 2, RetryBackoff: time.Millisecond, MaxRetryBackoff: time.Millisecond})
+
+	got, err := resilient.Complete(context.Background(), "", "user")
+	if err != nil || got != "ok" {
+		t.Fatalf("Complete() = %q, %v, want ok", got, err)
+	}
+	if model.calls != 3 {
+		t.Errorf("calls = %d, want 3", model.calls)
+	}
+
+	// Client errors are not retried
+	model = &scriptedModel{errs: []error{errBadRequest}}
+	resilient = NewResilientModel(model, ResilienceOptions{MaxRetries: 2, RetryBackoff: time.Millisecond, MaxRetryBackoff: time.Millisecond})
+	if _, err := resilient.Complete(context.Background(), "", "user"); !errors.Is(err, errBadRequest) {
+		t.Errorf("Complete() error = %v, want %v", err, errBadRequest)
+	}
+	if model.calls != 1 {
+		t.Errorf("calls = %d, want 1", model.calls)
+	}
+}
+
+func TestResilientModelRetryAfterBeyondMaximum(t *testing.T) {
+	model := &scriptedModel{errs: []error{&StatusError{StatusCode: http.StatusTooManyRequests, RetryAfter: time.Hour}}}
+	resilient := NewResilientModel(model, ResilienceOptions{MaxRetries: 2, RetryBackoff: time.Millisecond, MaxRetryBackoff: time.Second})
+	if _, err := resilient.Complete(context.Background(), "", "user"); err == nil {
+		t.Error("Complete() error = nil, want the request to fail instead of waiting an hour")
+	}
+	if model.calls != 1 {
+		t.Errorf("calls = %d, want 1", model.calls)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	tests := []struct {
+		name      string
+		outcomes  []error
+		wantState breakerState
+	}{
+		{"transient failures open", []error{errUnavailable, errUnavailable}, breakerOpen},
+		{"a success resets the count", []error{errUnavailable, nil, errUnavailable}, breakerClosed},
+		{"client errors do not count", []error{errBadRequest, errBadRequest, errBadRequest}, breakerClosed},
+		{"client errors do not reset the count", []error{errUnavailable, errBadRequest, errUnavailable}, breakerOpen},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			breaker := newCircuitBreaker(2, time.Minute)
+			for _, err := range tt.outcomes {
+				if !breaker.allow() {
+					t.Fatal("allow() = false before the breaker opened")
+				}
+				breaker.record(err)
+			}
+			if breaker.state != tt.wantState {
+				t.Errorf("state = %s, want %s", breaker.state, tt.wantState)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerHalfOpen(t *testing.T) {
+	for _, probe := range []error{errUnavailable, errBadRequest, context.Canceled} {
+		t.Run(probe.Error(), func(t *testing.T) {
+			breaker := newCircuitBreaker(1, 10*time.Millisecond)
+			breaker.record(errUnavailable)
+			if breaker.allow() {
+				t.Fatal("allow() = true while open")
+			}
+
+			time.Sleep(20 * time.Millisecond)
+			if !breaker.allow() {
+				t.Fatal("allow() = false after the cooldown, want a probe")
+			}
+			if breaker.allow() {
+				t.Fatal("allow() = true for a second request while the probe is running")
+			}
+
+			// A failed probe of any kind reopens the breaker
+			breaker.record(probe)
+			if breaker.state != breakerOpen || breaker.allow() {
+				t.Errorf("state = %s, want open", breaker.state)
+			}
+		})
+	}
+
+	breaker := newCircuitBreaker(1, 0)
+	breaker.record(errUnavailable)
+	if !breaker.allow() {
+		t.Fatal("allow() = false after the cooldown, want a probe")
+	}
+	breaker.record(nil)
+	if breaker.state != breakerClosed {
+		t.Errorf("state = %s after a successful probe, want closed", breaker.state)
+	}
+}
+
+func TestResilientModelRejectsWhileOpen(t *testing.T) {
+	model := &scriptedModel{errs: []error{errUnavailable}}
+	resilient := NewResilientModel(model, ResilienceOptions{BreakerFailures: 1, BreakerCooldown: time.Minute})
+	if _, err := resilient.Complete(context.Background(), "", "user"); !errors.Is(err, errUnavailable) {
+		t.Fatalf("Complete() error = %v, want %v", err, errUnavailable)
+	}
+	if _, err := resilient.Complete(context.Background(), "", "user"); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Complete() error = %v, want ErrCircuitOpen", err)
+	}
+	if model.calls != 1 {
+		t.Errorf("calls = %d, want 1", model.calls)
+	}
+}
@@ -0,0 +1,310 @@
+package models
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+
+	"channelog/helpers"
+	"channelog/metrics"
+)
+
+var cacheLookupsTotal = metrics.NewCounterVec("channelog_llm_cache_lookups_total", "Changelog entry cache lookups by result: memory, disk or miss.", "result")
+
+// cachedNote is added to entries reused from the cache
+const cachedNote = "An identical change was described before; this entry was reused from the response cache."
+
+// cacheKeyVersion is bumped when cached entries change shape, so that files
+// left on disk by earlier versions are not reused
+const cacheKeyVersion = 2
+
+// Placeholders stand for the names of the object and of the actor in cached
+// entries, so that an entry written for one object can be reused for others
+const (
+	namePlaceholder      = "<<name>>"
+	namespacePlaceholder = "<<namespace>>"
+	userPlaceholder      = "<<user>>"
+)
+
+// ResponseCache keeps changelog entries by a hash of the model, the prompts
+// and the normalized diff they were written for, so that the same change
+// applied to many objects is described once. Recently used entries are held
+// in memory; with a directory every entry is also kept on disk and survives
+// restarts. Entries are stored with placeholders for the names of the object
+// and the actor; see entryIdentity.
+type ResponseCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+
+	// dir holds one JSON file per entry, or is empty
+	dir string
+}
+
+// cacheItem is an element of the LRU list
+type cacheItem struct {
+	key   string
+	entry *Entry
+}
+
+// NewResponseCache creates a cache holding up to size entries in memory and,
+// when dir is not empty, all entries on disk
+func NewResponseCache(size int, dir string) (*ResponseCache, error) {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create cache directory: %w", err)
+		}
+	}
+	return &ResponseCache{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+		dir:     dir,
+	}, nil
+}
+
+// Get returns a copy of the entry stored under key
+func (c *ResponseCache) Get(key string) (*Entry, bool) {
+	c.mu.Lock()
+	if elem, ok := c.entries[key]; ok {
+		c.order.MoveToFront(elem)
+		entry := elem.Value.(*cacheItem).entry
+		c.mu.Unlock()
+		cacheLookupsTotal.With("memory").Inc()
+		return cloneEntry(entry), true
+	}
+	c.mu.Unlock()
+
+	if entry, ok := c.read(key); ok {
+		cacheLookupsTotal.With("disk").Inc()
+		c.remember(key, entry)
+		return cloneEntry(entry), true
+	}
+	cacheLookupsTotal.With("miss").Inc()
+	return nil, false
+}
+
+// Put stores a copy of entry under key
+func (c *ResponseCache) Put(key string, entry *Entry) {
+	entry = cloneEntry(entry)
+	c.remember(key, entry)
+	if err := c.write(key, entry); err != nil {
+		log.Warn().Err(err).Str("key", key).Msg("Failed to write cached changelog entry")
+	}
+}
+
+// remember adds an entry to the memory tier, evicting the least recently used
+func (c *ResponseCache) remember(key string, entry *Entry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.size <= 0 {
+		return
+	}
+	if elem, ok := c.entries[key]; ok {
+		elem.Value.(*cacheItem).entry = entry
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&cacheItem{key: key, entry: entry})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheItem).key)
+	}
+}
+
+// read loads an entry from the disk tier
+func (c *ResponseCache) read(key string) (*Entry, bool) {
+	if c.dir == "" {
+		return nil, false
+	}
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warn().Err(err).Str("key", key).Msg("Failed to read cached changelog entry")
+		}
+		return nil, false
+	}
+	var entry Entry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		log.Warn().Err(err).Str("key", key).Msg("Ignoring corrupt cached changelog entry")
+		return nil, false
+	}
+	return &entry, true
+}
+
+// write stores an entry in the disk tier atomically
+func (c *ResponseCache) write(key string, entry *Entry) error {
+	if c.dir == "" {
+		return nil
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode entry: %w", err)
+	}
+
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create cache file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write cache file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close cache file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to commit cache file: %w", err)
+	}
+	return nil
+}
+
+// path returns the file of an entry, spread over subdirectories by the
+// first byte of the key
+func (c *ResponseCache) path(key string) string {
+	return filepath.Join(c.dir, key[:2], key+".json")
+}
+
+// entryCacheKey hashes everything an entry is written from except the names
+// of the resource and the actor: the model, the prompts, the kind and
+// operation, and the normalized changes. The names are replaced with
+// placeholders in cached entries instead.
+func entryCacheKey(model string, prompts promptSet, kind, operation string, changes []helpers.Change) (string, error) {
+	data, err := json.Marshal(struct {
+		Version   int              `json:"version"`
+		Model     string           `json:"model"`
+		Profile   string           `json:"profile"`
+		Prompts   string           `json:"prompts"`
+		Kind      string           `json:"kind"`
+		Operation string           `json:"operation"`
+		Changes   []helpers.Change `json:"changes"`
+	}{cacheKeyVersion, model, prompts.name, prompts.digest, kind, operation, changes})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode cache key: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// entryIdentity holds the names an entry may mention that are not part of
+// its cache key
+type entryIdentity struct {
+	namespace string
+	name      string
+	user      string
+}
+
+// identityOf returns the names of the object and the actor of a request
+func identityOf(req EntryRequest) entryIdentity {
+	return entryIdentity{namespace: req.Namespace, name: req.Name, user: req.Actor.Username}
+}
+
+// strip returns a copy of entry with the names replaced by placeholders.
+// Names are replaced where they stand alone, not inside longer names; the
+// namespace only next to the word "namespace" or before "/name", as it is
+// often a common word such as "default".
+func (id entryIdentity) strip(entry *Entry) *Entry {
+	return mapEntryText(entry, func(s string) string {
+		if id.namespace != "" && id.name != "" {
+			s = replaceName(s, id.namespace+"/"+id.name, namespacePlaceholder+"/"+namePlaceholder)
+		}
+		if id.user != "" {
+			s = replaceName(s, id.user, userPlaceholder)
+		}
+		if id.namespace != "" {
+			s = replaceNamespace(s, id.namespace)
+		}
+		if id.name != "" {
+			s = replaceName(s, id.name, namePlaceholder)
+		}
+		return s
+	})
+}
+
+// fill returns a copy of entry with the placeholders replaced by the names
+func (id entryIdentity) fill(entry *Entry) *Entry {
+	r := strings.NewReplacer(namePlaceholder, id.name, namespacePlaceholder, id.namespace, userPlaceholder, id.user)
+	return mapEntryText(entry, r.Replace)
+}
+
+// mapEntryText returns a copy of entry with f applied to its text fields
+func mapEntryText(entry *Entry, f func(string) string) *Entry {
+	entry = cloneEntry(entry)
+	entry.Summary = f(entry.Summary)
+	entry.Risk = f(entry.Risk)
+	for i := range entry.SecurityNotes {
+		entry.SecurityNotes[i] = f(entry.SecurityNotes[i])
+	}
+	for i := range entry.RecommendedActions {
+		entry.RecommendedActions[i] = f(entry.RecommendedActions[i])
+	}
+	return entry
+}
+
+// nameByte reports whether c may be part of a Kubernetes or user name
+func nameByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == ':' || c == '@'
+}
+
+// replaceName replaces the occurrences of name in s that are not part of a
+// longer name
+func replaceName(s, name, placeholder string) string {
+	var b strings.Builder
+	for {
+		i := strings.Index(s, name)
+		if i < 0 {
+			b.WriteString(s)
+			return b.String()
+		}
+		end := i + len(name)
+		// A trailing dot or colon ends a sentence or a label rather than the name
+		standalone := (i == 0 || !nameByte(s[i-1])) &&
+			(end == len(s) || !nameByte(s[end]) || (s[end] == '.' || s[end] == ':') && (end+1 == len(s) || !nameByte(s[end+1])))
+		b.WriteString(s[:i])
+		if standalone {
+			b.WriteString(placeholder)
+		} else {
+			b.WriteString(name)
+		}
+		s = s[end:]
+	}
+}
+
+// replaceNamespace replaces namespace where it is named as one, such as in
+// "namespace prod" or "the `prod` namespace"
+func replaceNamespace(s, namespace string) string {
+	quoted := regexp.QuoteMeta(namespace)
+	before := regexp.MustCompile("(?i)(namespace[\\s:\"'`]+)" + quoted + "([^A-Za-z0-9_-]|$)")
+	after := regexp.MustCompile("(?i)(^|[^A-Za-z0-9_-])" + quoted + "([\\s\"'`]+namespace)")
+	s = before.ReplaceAllString(s, "${1}"+namespacePlaceholder+"${2}")
+	return after.ReplaceAllString(s, "${1}"+namespacePlaceholder+"${2}")
+}
+
+// cloneEntry copies an entry so that callers cannot change cached ones
+func cloneEntry(entry *Entry) *Entry {
+	clone := *entry
+	clone.Categories = slices.Clone(entry.Categories)
+	clone.SecurityNotes = slices.Clone(entry.SecurityNotes)
+	clone.RecommendedActions = slices.Clone(entry.RecommendedActions)
+	clone.Notes = slices.Clone(entry.Notes)
+	return &clone
+}
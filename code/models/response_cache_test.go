@@ -0,0 +1,185 @@
+package models
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"channelog/helpers"
+)
+
+func TestResponseCache(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := NewResponseCache(1, dir)
+	if err != nil {
+		t.Fatalf("NewResponseCache() error = %v", err)
+	}
+
+	first := &Entry{Summary: "First", Categories: []string{"capacity"}}
+	cache.Put("aa01", first)
+	cache.Put("bb02", &Entry{Summary: "Second"})
+
+	// Changing a stored or returned entry does not change the cached one
+	first.Categories[0] = "changed"
+	got, ok := cache.Get("aa01")
+	if !ok || got.Summary != "First" || got.Categories[0] != "capacity" {
+		t.Fatalf("Get() = %+v, %v, want the first entry from disk", got, ok)
+	}
+	got.Summary = "changed"
+	if got, _ := cache.Get("aa01"); got.Summary != "First" {
+		t.Errorf("Get() = %+v after changing a returned entry", got)
+	}
+	if _, ok := cache.Get("cc03"); ok {
+		t.Error("Get() found an entry that was never stored")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "bb", "bb02.json")); err != nil {
+		t.Errorf("entry file: %v", err)
+	}
+
+	// A new cache on the same directory reads entries from disk
+	restarted, err := NewResponseCache(0, dir)
+	if err != nil {
+		t.Fatalf("NewResponseCache() error = %v", err)
+	}
+	if got, ok := restarted.Get("bb02"); !ok || got.Summary != "Second" {
+		t.Errorf("Get() after restart = %+v, %v", got, ok)
+	}
+
+	// Without a directory evicted entries are gone
+	memory, _ := NewResponseCache(1, "")
+	memory.Put("aa01", &Entry{Summary: "First"})
+	memory.Put("bb02", &Entry{Summary: "Second"})
+	if _, ok := memory.Get("aa01"); ok {
+		t.Error("Get() found an evicted entry")
+	}
+}
+
+func TestEntryCacheKey(t *testing.T) {
+	prompts := promptSet{name: "default", digest: "abc"}
+	changes := []helpers.Change{{Path: "spec.replicas", Op: helpers.ChangeReplace, OldValue: float64(2), NewValue: float64(3)}}
+	key, err := entryCacheKey("gpt", prompts, "Deployment", "UPDATE", changes)
+	if err != nil {
+		t.Fatalf("entryCacheKey() error = %v", err)
+	}
+	if again, _ := entryCacheKey("gpt", prompts, "Deployment", "UPDATE", changes); again != key {
+		t.Errorf("entryCacheKey() = %s, then %s", key, again)
+	}
+
+	other := []helpers.Change{{Path: "spec.replicas", Op: helpers.ChangeReplace, OldValue: float64(2), NewValue: float64(4)}}
+	for name, k := range map[string][]any{
+		"model":     {"llama", prompts, "Deployment", "UPDATE", changes},
+		"profile":   {"gpt", promptSet{name: "apps", digest: "abc"}, "Deployment", "UPDATE", changes},
+		"templates": {"gpt", promptSet{name: "default", digest: "def"}, "Deployment", "UPDATE", changes},
+		"kind":      {"gpt", prompts, "StatefulSet", "UPDATE", changes},
+		"changes":   {"gpt", prompts, "Deployment", "UPDATE", other},
+	} {
+		got, _ := entryCacheKey(k[0].(string), k[1].(promptSet), k[2].(string), k[3].(string), k[4].([]helpers.Change))
+		if got == key {
+			t.Errorf("entryCacheKey() ignores the %s", name)
+		}
+	}
+}
+
+func TestEntryIdentity(t *testing.T) {
+	tests := []struct {
+		name string
+		id   entryIdentity
+		text string
+		want string
+	}{
+		{
+			name: "qualified name",
+			id:   entryIdentity{namespace: "prod", name: "web"},
+			text: "Scaled prod/web to 3 replicas.",
+			want: "Scaled <<namespace>>/<<name>> to 3 replicas.",
+		},
+		{
+			name: "standalone names only",
+			id:   entryIdentity{namespace: "prod", name: "web"},
+			text: "Scaled `web` (not web-api or webhook) in the prod namespace; web.",
+			want: "Scaled `<<name>>` (not web-api or webhook) in the <<namespace>> namespace; <<name>>.",
+		},
+		{
+			name: "namespace as a common word",
+			id:   entryIdentity{namespace: "default", name: "web"},
+			text: "Restored the default replicas of web in namespace default.",
+			want: "Restored the default replicas of <<name>> in namespace <<namespace>>.",
+		},
+		{
+			name: "same namespace and name",
+			id:   entryIdentity{namespace: "web", name: "web"},
+			text: "Scaled web in namespace web.",
+			want: "Scaled <<name>> in namespace <<namespace>>.",
+		},
+		{
+			name: "user",
+			id:   entryIdentity{namespace: "ci", name: "web", user: "system:serviceaccount:ci:deployer"},
+			text: "system:serviceaccount:ci:deployer scaled web.",
+			want: "<<user>> scaled <<name>>.",
+		},
+		{
+			name: "cluster-scoped",
+			id:   entryIdentity{name: "admin"},
+			text: "Granted admin to the admins group.",
+			want: "Granted <<name>> to the admins group.",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := &Entry{Summary: tt.text, Risk: tt.text, SecurityNotes: []string{tt.text}, RecommendedActions: []string{tt.text}}
+			stripped := tt.id.strip(entry)
+			want := &Entry{Summary: tt.want, Risk: tt.want, SecurityNotes: []string{tt.want}, RecommendedActions: []string{tt.want}}
+			if !reflect.DeepEqual(stripped, want) {
+				t.Errorf("strip() = %+v, want %+v", stripped, want)
+			}
+			if entry.Summary != tt.text || entry.SecurityNotes[0] != tt.text {
+				t.Errorf("strip() changed its argument to %+v", entry)
+			}
+			if filled := tt.id.fill(stripped); !reflect.DeepEqual(filled, entry) {
+				t.Errorf("fill() = %+v, want %+v", filled, entry)
+			}
+		})
+	}
+}
+
+func TestTemplateSummarizerReusesCachedEntries(t *testing.T) {
+	model := &recordingModel{reply: `{"summary": "Scaled prod/web to 3 replicas.", "security_notes": ["alice can scale web"]}`}
+	summarizer, err := NewTemplateSummarizer(testConfig("", "{{.Changes}}", ""), model, nil)
+	if err != nil {
+		t.Fatalf("NewTemplateSummarizer() error = %v", err)
+	}
+	summarizer.cache, _ = NewResponseCache(10, "")
+
+	if _, err := summarizer.GenerateChangelogEntry(context.Background(), scaleRequest()); err != nil {
+		t.Fatalf("GenerateChangelogEntry() error = %v", err)
+	}
+
+	// The same change to another object by another user reuses the entry
+	// with their names
+	req := scaleRequest()
+	req.Namespace, req.Name, req.Actor.Username = "staging", "api", "bob"
+	entry, err := summarizer.GenerateChangelogEntry(context.Background(), req)
+	if err != nil {
+		t.Fatalf("GenerateChangelogEntry() error = %v", err)
+	}
+	if len(model.users) != 1 {
+		t.Errorf("model requests = %d, want 1", len(model.users))
+	}
+	if !entry.Cached || entry.Summary != "Scaled staging/api to 3 replicas." || entry.SecurityNotes[0] != "bob can scale api" {
+		t.Errorf("entry = %+v, want the cached entry for staging/api by bob", entry)
+	}
+	if len(entry.Notes) != 1 || entry.Notes[0] != cachedNote {
+		t.Errorf("notes = %q, want the cached note", entry.Notes)
+	}
+
+	// Deletions are never cached
+	req.Operation, req.NewObject = "DELETE", ""
+	if _, err := summarizer.GenerateDeletionEntry(context.Background(), req); err != nil {
+		t.Fatalf("GenerateDeletionEntry() error = %v", err)
+	}
+	if len(model.users) != 2 {
+		t.Errorf("model requests = %d, want 2", len(model.users))
+	}
+}
@@ -0,0 +1,312 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"channelog/helpers"
+)
+
+// maxRuleBullets bounds the number of bullet points in a rule-based entry
+const maxRuleBullets = 50
+
+// maxRuleValueLength bounds how much of a value a bullet point shows
+const maxRuleValueLength = 80
+
+// dataKinds are kinds whose data values are not shown, only their keys
+var dataKinds = []string{"ConfigMap", "Secret"}
+
+// dataFields hold the keys of ConfigMaps and Secrets
+var dataFields = []string{"data", "stringData", "binaryData"}
+
+// RuleSummarizer describes changes as bullet points derived from the
+// structured diff, without a language model. The same change always yields
+// the same entry.
+type RuleSummarizer struct{}
+
+// NewRuleSummarizer creates a rule-based summarizer
+func NewRuleSummarizer() *RuleSummarizer {
+	return &RuleSummarizer{}
+}
+
+// GenerateChangelogEntry lists the changed fields of an updated resource, or
+// the containers and replicas of a created one
+func (s *RuleSummarizer) GenerateChangelogEntry(_ context.Context, req EntryRequest) (*Entry, error) {
+	if req.OldObject == "" {
+		newObj, err := decodeObject(req.NewObject)
+		if err != nil {
+			return nil, err
+		}
+		return &Entry{Summary: formatBullets(fmt.Sprintf("Created %s.", describeResource(req)), describeObject(req.Kind, newObj))}, nil
+	}
+
+	var bullets []string
+	for _, change := range req.Diff.Changes {
+		bullets = append(bullets, describeChange(req.Kind, change))
+	}
+	if len(bullets) == 0 {
+		return &Entry{Summary: fmt.Sprintf("Updated %s without changes to the tracked fields.\n", describeResource(req))}, nil
+	}
+	return &Entry{Summary: formatBullets(fmt.Sprintf("Updated %s:", describeResource(req)), bullets)}, nil
+}
+
+// GenerateDeletionEntry describes the final state of a deleted resource
+func (s *RuleSummarizer) GenerateDeletionEntry(_ context.Context, req EntryRequest) (*Entry, error) {
+	finalObj, err := decodeObject(req.OldObject)
+	if err != nil {
+		return nil, err
+	}
+	return &Entry{Summary: formatBullets(fmt.Sprintf("Deleted %s.", describeResource(req)), describeObject(req.Kind, finalObj))}, nil
+}
+
+// GenerateBatchEntry lists the changes of every resource under one headline
+func (s *RuleSummarizer) GenerateBatchEntry(ctx context.Context, release string, reqs []EntryRequest) (*Entry, error) {
+	entries := make([]*Entry, 0, len(reqs)+1)
+	entries = append(entries, &Entry{Summary: fmt.Sprintf("Changed %d resources of %s.", len(reqs), release)})
+	for _, req := range reqs {
+		generate := s.GenerateChangelogEntry
+		if req.Operation == "DELETE" {
+			generate = s.GenerateDeletionEntry
+		}
+		entry, err := generate(ctx, req)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", describeResource(req), err)
+		}
+		entries = append(entries, entry)
+	}
+	return mergeEntries(entries), nil
+}
+
+// describeResource names the resource, e.g. Deployment prod/web
+func describeResource(req EntryRequest) string {
+	if req.Namespace == "" {
+		return fmt.Sprintf("%s %s", req.Kind, req.Name)
+	}
+	return fmt.Sprintf("%s %s/%s", req.Kind, req.Namespace, req.Name)
+}
+
+// describeObject lists the replicas and container images of an object
+func describeObject(kind string, obj map[string]any) []string {
+	var bullets []string
+	if spec, ok := obj["spec"].(map[string]any); ok {
+		if replicas, ok := spec["replicas"]; ok {
+			bullets = append(bullets, fmt.Sprintf("%s replicas %s", kind, formatRuleValue(replicas)))
+		}
+	}
+	for _, container := range findContainers(obj) {
+		bullets = append(bullets, fmt.Sprintf("Container %s image %s", container[0], container[1]))
+	}
+	if slices.Contains(dataKinds, kind) {
+		for _, key := range dataFields {
+			if data, ok := obj[key].(map[string]any); ok && len(data) > 0 {
+				bullets = append(bullets, fmt.Sprintf("Keys %s", strings.Join(slices.Sorted(maps.Keys(data)), ", ")))
+			}
+		}
+	}
+	return bullets
+}
+
+// findContainers returns the name and image of every container below value
+func findContainers(value any) [][2]string {
+	var containers [][2]string
+	switch v := value.(type) {
+	case map[string]any:
+		for _, key := range slices.Sorted(maps.Keys(v)) {
+			if list, ok := v[key].([]any); ok && (key == "containers" || key == "initContainers") {
+				for _, elem := range list {
+					container, _ := elem.(map[string]any)
+					name, _ := container["name"].(string)
+					image, _ := container["image"].(string)
+					if name != "" && image != "" {
+						containers = append(containers, [2]string{name, image})
+					}
+				}
+				continue
+			}
+			containers = append(containers, findContainers(v[key])...)
+		}
+	case []any:
+		for _, elem := range v {
+			containers = append(containers, findContainers(elem)...)
+		}
+	}
+	return containers
+}
+
+// describeChange renders a single change as a bullet point, using the wording
+// of the first rule matching its path
+func describeChange(kind string, change helpers.Change) string {
+	segments := helpers.SplitPath(change.Path)
+
+	if i := containerIndex(segments); i >= 0 {
+		return describeContainerChange(selectorValue(segments[i+1]), segments[i+2:], change)
+	}
+
+	switch {
+	case len(segments) == 2 && segments[0] == "spec" && segments[1] == "replicas":
+		return describeValueChange(kind+" replicas", change)
+	case len(segments) == 3 && segments[0] == "metadata" && segments[1] == "labels":
+		return describeMapEntry("label", segments[2], change)
+	case len(segments) == 3 && segments[0] == "metadata" && segments[1] == "annotations":
+		return describeMapEntry("annotation", segments[2], change)
+	case len(segments) == 2 && slices.Contains(dataKinds, kind) && slices.Contains(dataFields, segments[0]):
+		// Values of ConfigMap and Secret keys may be large or sensitive
+		return describeKey(segments[1], change)
+	}
+	return describeValueChange("`"+change.Path+"`", change)
+}
+
+// containerIndex returns the index of the containers list in a path that
+// addresses a container by name, or -1
+func containerIndex(segments []string) int {
+	for i := 0; i+1 < len(segments); i++ {
+		if (segments[i] == "containers" || segments[i] == "initContainers") && strings.HasPrefix(segments[i+1], "[name=") {
+			return i
+		}
+	}
+	return -1
+}
+
+// describeContainerChange renders a change below a named container
+func describeContainerChange(container string, rest []string, change helpers.Change) string {
+	switch {
+	case len(rest) == 0 && change.Op == helpers.ChangeAdd:
+		if obj, ok := change.NewValue.(map[string]any); ok {
+			if image, ok := obj["image"].(string); ok {
+				return fmt.Sprintf("Added container %s with image %s", container, image)
+			}
+		}
+		return fmt.Sprintf("Added container %s", container)
+	case len(rest) == 0 && change.Op == helpers.ChangeRemove:
+		return fmt.Sprintf("Removed container %s", container)
+	case len(rest) == 1 && rest[0] == "image":
+		return describeValueChange("container "+container+" image", change)
+	case len(rest) >= 2 && rest[0] == "env" && strings.HasPrefix(rest[1], "[name="):
+		name := selectorValue(rest[1])
+		switch {
+		case len(rest) == 2 && change.Op == helpers.ChangeAdd:
+			return fmt.Sprintf("Added env var %s to container %s", name, container)
+		case len(rest) == 2 && change.Op == helpers.ChangeRemove:
+			return fmt.Sprintf("Removed env var %s from container %s", name, container)
+		}
+		return fmt.Sprintf("Changed env var %s in container %s", name, container)
+	case len(rest) == 3 && rest[0] == "resources" && (rest[1] == "limits" || rest[1] == "requests"):
+		kind := strings.TrimSuffix(rest[1], "s")
+		return describeValueChange(fmt.Sprintf("container %s %s %s", container, rest[2], kind), change)
+	}
+	return describeValueChange(fmt.Sprintf("container %s `%s`", container, joinSegments(rest)), change)
+}
+
+// joinSegments joins path segments with dots, except before list selectors
+func joinSegments(segments []string) string {
+	var b strings.Builder
+	for i, segment := range segments {
+		if i > 0 && !strings.HasPrefix(segment, "[") {
+			b.WriteByte('.')
+		}
+		b.WriteString(segment)
+	}
+	return b.String()
+}
+
+// describeValueChange renders a change of the field named subject
+func describeValueChange(subject string, change helpers.Change) string {
+	switch change.Op {
+	case helpers.ChangeAdd:
+		return fmt.Sprintf("Set %s to %s", subject, formatRuleValue(change.NewValue))
+	case helpers.ChangeRemove:
+		return fmt.Sprintf("Removed %s (was %s)", subject, formatRuleValue(change.OldValue))
+	}
+	return fmt.Sprintf("%s %s → %s", subject, formatRuleValue(change.OldValue), formatRuleValue(change.NewValue))
+}
+
+// describeMapEntry renders a change of a label or annotation
+func describeMapEntry(noun, key string, change helpers.Change) string {
+	switch change.Op {
+	case helpers.ChangeAdd:
+		return fmt.Sprintf("Added %s %s=%s", noun, key, formatRuleValue(change.NewValue))
+	case helpers.ChangeRemove:
+		return fmt.Sprintf("Removed %s %s", noun, key)
+	}
+	return fmt.Sprintf("Changed %s %s: %s → %s", noun, key, formatRuleValue(change.OldValue), formatRuleValue(change.NewValue))
+}
+
+// describeKey renders a change of a ConfigMap or Secret key without its value
+func describeKey(key string, change helpers.Change) string {
+	switch change.Op {
+	case helpers.ChangeAdd:
+		return fmt.Sprintf("Added key %s", key)
+	case helpers.ChangeRemove:
+		return fmt.Sprintf("Removed key %s", key)
+	}
+	return fmt.Sprintf("Changed the value of key %s", key)
+}
+
+// selectorValue returns the value of a list selector such as [name=app]
+func selectorValue(segment string) string {
+	_, value, _ := strings.Cut(strings.Trim(segment, "[]"), "=")
+	return value
+}
+
+// formatRuleValue renders a value for a bullet point, shortening long values
+func formatRuleValue(value any) string {
+	var text string
+	switch v := value.(type) {
+	case string:
+		text = v
+	case map[string]any:
+		return fmt.Sprintf("{%d fields}", len(v))
+	case []any:
+		return fmt.Sprintf("[%d items]", len(v))
+	default:
+		data, _ := json.Marshal(v)
+		text = string(data)
+	}
+	if utf8.RuneCountInString(text) > maxRuleValueLength {
+		text = string([]rune(text)[:maxRuleValueLength]) + "…"
+	}
+	return text
+}
+
+// formatBullets renders the headline followed by at most maxRuleBullets
+// bullet points, each starting with a capital letter
+func formatBullets(headline string, bullets []string) string {
+	var b strings.Builder
+	b.WriteString(headline)
+	b.WriteString("\n")
+	if len(bullets) > 0 {
+		b.WriteString("\n")
+	}
+	for i, bullet := range bullets {
+		if i == maxRuleBullets {
+			fmt.Fprintf(&b, "- … and %d more changes\n", len(bullets)-i)
+			break
+		}
+		fmt.Fprintf(&b, "- %s\n", capitalize(bullet))
+	}
+	return b.String()
+}
+
+// capitalize upper-cases the first letter of s
+func capitalize(s string) string {
+	first, size := utf8.DecodeRuneInString(s)
+	if size == 0 {
+		return s
+	}
+	return string(unicode.ToUpper(first)) + s[size:]
+}
+
+// decodeObject parses the JSON of a resource
+func decodeObject(data string) (map[string]any, error) {
+	var obj map[string]any
+	if err := json.Unmarshal([]byte(data), &obj); err != nil {
+		return nil, fmt.Errorf("failed to decode object: %w", err)
+	}
+	return obj, nil
+}
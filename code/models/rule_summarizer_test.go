@@ -0,0 +1,95 @@
+package models
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"channelog/helpers"
+)
+
+func TestDescribeChange(t *testing.T) {
+	tests := []struct {
+		kind   string
+		change helpers.Change
+		want   string
+	}{
+		{"Deployment", helpers.Change{Path: "spec.replicas", Op: helpers.ChangeReplace, OldValue: float64(2), NewValue: float64(3)}, "Deployment replicas 2 → 3"},
+		{"Deployment", helpers.Change{Path: "metadata.labels.team", Op: helpers.ChangeAdd, NewValue: "web"}, "Added label team=web"},
+		{"Deployment", helpers.Change{Path: `metadata.annotations["example.com/owner"]`, Op: helpers.ChangeRemove, OldValue: "bob"}, "Removed annotation example.com/owner"},
+		{"ConfigMap", helpers.Change{Path: "data.mode", Op: helpers.ChangeReplace, OldValue: "fast", NewValue: "slow"}, "Changed the value of key mode"},
+		{"Deployment", helpers.Change{Path: "spec.template.spec.containers[name=app].image", Op: helpers.ChangeReplace, OldValue: "app:1", NewValue: "app:2"}, "container app image app:1 → app:2"},
+		{"Deployment", helpers.Change{Path: "spec.template.spec.containers[name=app].env[name=MODE].value", Op: helpers.ChangeReplace}, "Changed env var MODE in container app"},
+		{"Deployment", helpers.Change{Path: "spec.template.spec.containers[name=agent]", Op: helpers.ChangeAdd, NewValue: map[string]any{"image": "agent:1"}}, "Added container agent with image agent:1"},
+		{"Deployment", helpers.Change{Path: "spec.paused", Op: helpers.ChangeAdd, NewValue: true}, "Set `spec.paused` to true"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.change.Path, func(t *testing.T) {
+			if got := describeChange(tt.kind, tt.change); got != tt.want {
+				t.Errorf("describeChange() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatRuleValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		value any
+		want  string
+	}{
+		{"string", "app:1", "app:1"},
+		{"number", float64(3), "3"},
+		{"map", map[string]any{"a": 1}, "{1 fields}"},
+		{"list", []any{1, 2}, "[2 items]"},
+		{"long ASCII", strings.Repeat("a", 100), strings.Repeat("a", maxRuleValueLength) + "…"},
+		// A byte index would cut "é" in half
+		{"long UTF-8", "x" + strings.Repeat("é", 100), "x" + strings.Repeat("é", maxRuleValueLength-1) + "…"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatRuleValue(tt.value); got != tt.want {
+				t.Errorf("formatRuleValue() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatBullets(t *testing.T) {
+	got := formatBullets("Updated ConfigMap prod/settings:", []string{"élan changed", "added key", ""})
+	want := "Updated ConfigMap prod/settings:\n\n- Élan changed\n- Added key\n- \n"
+	if got != want {
+		t.Errorf("formatBullets() = %q, want %q", got, want)
+	}
+
+	bullets := make([]string, maxRuleBullets+2)
+	for i := range bullets {
+		bullets[i] = "change"
+	}
+	if got := formatBullets("Updated:", bullets); !strings.HasSuffix(got, "- … and 2 more changes\n") {
+		t.Errorf("formatBullets() = %q, want the remaining changes counted", got)
+	}
+}
+
+func TestRuleSummarizerIsDeterministic(t *testing.T) {
+	req := EntryRequest{
+		Kind: "Deployment", Namespace: "prod", Name: "web", Operation: "UPDATE",
+		OldObject: `{"spec": {"replicas": 2}}`,
+		NewObject: `{"spec": {"replicas": 3}}`,
+		Diff: &helpers.Diff{Changes: []helpers.Change{
+			{Path: "spec.replicas", Op: helpers.ChangeReplace, OldValue: float64(2), NewValue: float64(3)},
+		}},
+	}
+	first, err := NewRuleSummarizer().GenerateChangelogEntry(context.Background(), req)
+	if err != nil {
+		t.Fatalf("GenerateChangelogEntry() error = %v", err)
+	}
+	want := "Updated Deployment prod/web:\n\n- Deployment replicas 2 → 3\n"
+	if first.Summary != want {
+		t.Errorf("Summary = %q, want %q", first.Summary, want)
+	}
+	second, _ := NewRuleSummarizer().GenerateChangelogEntry(context.Background(), req)
+	if second.Summary != first.Summary {
+		t.Errorf("Summary = %q, then %q", first.Summary, second.Summary)
+	}
+}
@@ -0,0 +1,167 @@
+package models
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+
+	"channelog/config"
+	"channelog/helpers"
+)
+
+// EntryRequest is a change of a single resource to describe
+type EntryRequest struct {
+	Kind      string
+	Group     string
+	Version   string
+	Namespace string
+	Name      string
+
+	// Operation is CREATE, UPDATE or DELETE
+	Operation string
+
+	// OldObject and NewObject are the JSON of the resource before and after
+	// the change, empty when it did not exist. For deletions OldObject is the
+	// final state.
+	OldObject string
+	NewObject string
+
+	// Diff is the filtered difference between the two objects, never nil
+	Diff *helpers.Diff
+
+	// Actor is the user who made the change
+	Actor helpers.Actor
+}
+
+// Summarizer generates changelog entries for changed and deleted resources
+type Summarizer interface {
+	// GenerateChangelogEntry describes a created or updated resource
+	GenerateChangelogEntry(ctx context.Context, req EntryRequest) (*Entry, error)
+
+	// GenerateDeletionEntry describes a deleted resource from its final state
+	GenerateDeletionEntry(ctx context.Context, req EntryRequest) (*Entry, error)
+
+	// GenerateBatchEntry describes changes to several resources made together,
+	// such as by one Helm upgrade, in a single entry. release names what the
+	// changes belong to, e.g. Helm release prod/web.
+	GenerateBatchEntry(ctx context.Context, release string, reqs []EntryRequest) (*Entry, error)
+}
+
+// ChatModel sends a single system prompt and user message to a model and
+// returns the text of its reply
+type ChatModel interface {
+	Complete(ctx context.Context, systemPrompt, userMessage string) (string, error)
+}
+
+// StructuredChatModel is a ChatModel whose provider can constrain the reply
+// to a JSON schema
+type StructuredChatModel interface {
+	ChatModel
+	CompleteJSON(ctx context.Context, systemPrompt, userMessage, schemaName string, schema map[string]any) (string, error)
+}
+
+// fallbackNote is added to entries written by the fallback summarizer
+const fallbackNote = "The language model was unavailable; this entry was generated from the diff."
+
+// NewSummarizer creates the summarizer for the configured LLM provider. With
+// LLMFallback set, entries the model fails to write are generated by rules.
+// redact backs the redact template function.
+func NewSummarizer(cfg *config.Config, redact func(any) any) (Summarizer, error) {
+	var model ChatModel
+	switch cfg.LLMProvider {
+	case config.ProviderRules:
+		return NewRuleSummarizer(), nil
+	case config.ProviderOpenAI:
+		model = NewOpenAIService(cfg)
+	case config.ProviderAnthropic:
+		model = NewAnthropicService(cfg)
+	case config.ProviderOllama:
+		model = NewOllamaService(cfg)
+	default:
+		return nil, fmt.Errorf("unknown LLM provider %q", cfg.LLMProvider)
+	}
+
+	model = NewResilientModel(model, ResilienceOptions{
+		Timeout:           cfg.OpenAITimeout,
+		MaxRetries:        cfg.LLMMaxRetries,
+		RetryBackoff:      cfg.LLMRetryBackoff,
+		MaxRetryBackoff:   cfg.LLMMaxRetryBackoff,
+		RequestsPerMinute: cfg.LLMRequestsPerMinute,
+		TokensPerMinute:   cfg.LLMTokensPerMinute,
+		BreakerFailures:   cfg.LLMBreakerFailures,
+		BreakerCooldown:   cfg.LLMBreakerCooldown,
+		Tokens:            NewTokenEstimator(modelName(cfg)),
+	})
+
+	summarizer, err := NewTemplateSummarizer(cfg, model, redact)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.LLMFallback {
+		return NewFallbackSummarizer(summarizer, NewRuleSummarizer()), nil
+	}
+	return summarizer, nil
+}
+
+// modelName returns the model of the configured provider
+func modelName(cfg *config.Config) string {
+	switch cfg.LLMProvider {
+	case config.ProviderAnthropic:
+		return cfg.AnthropicModel
+	case config.ProviderOllama:
+		return cfg.OllamaModel
+	}
+	return cfg.OpenAIModel
+}
+
+// FallbackSummarizer asks a second summarizer when the first one fails
+type FallbackSummarizer struct {
+	primary  Summarizer
+	fallback Summarizer
+}
+
+// NewFallbackSummarizer creates a summarizer that uses fallback whenever
+// primary returns an error
+func NewFallbackSummarizer(primary, fallback Summarizer) *FallbackSummarizer {
+	return &FallbackSummarizer{primary: primary, fallback: fallback}
+}
+
+// GenerateChangelogEntry describes a created or updated resource
+func (s *FallbackSummarizer) GenerateChangelogEntry(ctx context.Context, req EntryRequest) (*Entry, error) {
+	entry, err := s.primary.GenerateChangelogEntry(ctx, req)
+	if err == nil {
+		return entry, nil
+	}
+	log.Warn().Err(err).Msg("Falling back to rule-based changelog entry")
+	return s.withNotice(s.fallback.GenerateChangelogEntry(ctx, req))
+}
+
+// GenerateDeletionEntry describes a deleted resource from its final state
+func (s *FallbackSummarizer) GenerateDeletionEntry(ctx context.Context, req EntryRequest) (*Entry, error) {
+	entry, err := s.primary.GenerateDeletionEntry(ctx, req)
+	if err == nil {
+		return entry, nil
+	}
+	log.Warn().Err(err).Msg("Falling back to rule-based changelog entry")
+	return s.withNotice(s.fallback.GenerateDeletionEntry(ctx, req))
+}
+
+// GenerateBatchEntry describes changes to several resources made together
+func (s *FallbackSummarizer) GenerateBatchEntry(ctx context.Context, release string, reqs []EntryRequest) (*Entry, error) {
+	entry, err := s.primary.GenerateBatchEntry(ctx, release, reqs)
+	if err == nil {
+		return entry, nil
+	}
+	log.Warn().Err(err).Msg("Falling back to rule-based changelog entry")
+	return s.withNotice(s.fallback.GenerateBatchEntry(ctx, release, reqs))
+}
+
+// withNotice marks an entry written by the fallback
+func (s *FallbackSummarizer) withNotice(entry *Entry, err error) (*Entry, error) {
+	if err != nil {
+		return nil, err
+	}
+	entry.Notes = append(entry.Notes, fallbackNote)
+	return entry, nil
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"channelog/config"
+	"channelog/helpers"
+)
+
+// failingSummarizer fails every request
+type failingSummarizer struct{}
+
+func (failingSummarizer) GenerateChangelogEntry(context.Context, EntryRequest) (*Entry, error) {
+	return nil, errors.New("model unavailable")
+}
+
+func (failingSummarizer) GenerateDeletionEntry(context.Context, EntryRequest) (*Entry, error) {
+	return nil, errors.New("model unavailable")
+}
+
+func (failingSummarizer) GenerateBatchEntry(context.Context, string, []EntryRequest) (*Entry, error) {
+	return nil, errors.New("model unavailable")
+}
+
+func TestFallbackSummarizer(t *testing.T) {
+	summarizer := NewFallbackSummarizer(failingSummarizer{}, NewRuleSummarizer())
+	req := EntryRequest{Kind: "ConfigMap", Namespace: "prod", Name: "settings", Operation: "DELETE",
+		OldObject: `{"kind": "ConfigMap", "data": {"mode": "fast"}}`, Diff: &helpers.Diff{}}
+
+	entry, err := summarizer.GenerateDeletionEntry(context.Background(), req)
+	if err != nil {
+		t.Fatalf("GenerateDeletionEntry() error = %v", err)
+	}
+	if !slices.Contains(entry.Notes, fallbackNote) {
+		t.Errorf("Notes = %q, want the fallback note", entry.Notes)
+	}
+}
+
+func TestNewSummarizer(t *testing.T) {
+	summarizer, err := NewSummarizer(&config.Config{LLMProvider: config.ProviderRules}, nil)
+	if err != nil {
+		t.Fatalf("NewSummarizer() error = %v", err)
+	}
+	if _, ok := summarizer.(*RuleSummarizer); !ok {
+		t.Errorf("NewSummarizer() = %T, want *RuleSummarizer", summarizer)
+	}
+
+	if _, err := NewSummarizer(&config.Config{LLMProvider: "gemini"}, nil); err == nil {
+		t.Error("NewSummarizer() error = nil, want an error for an unknown provider")
+	}
+}
@@ -0,0 +1,342 @@
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+
+	"channelog/config"
+	"channelog/helpers"
+)
+
+// TemplateSummarizer renders the configured prompt templates and asks a chat
+// model for the changelog entry
+type TemplateSummarizer struct {
+	model    ChatModel
+	cluster  string
+	prompts  promptSet
+	profiles []promptProfile
+
+	// tokens estimates prompt sizes for budget, the maximum estimated
+	// tokens of a prompt; zero means unlimited
+	tokens TokenEstimator
+	budget int
+
+	// cache reuses entries written by modelName for identical changes, or is nil
+	modelName string
+	cache     *ResponseCache
+}
+
+// promptSet holds the parsed templates of the default prompts or a profile
+type promptSet struct {
+	name string
+	// digest hashes the template texts, so that cached entries are not
+	// reused after the prompts changed
+	digest                string
+	systemPrompt          *template.Template
+	userMessageTemplate   *template.Template
+	deleteMessageTemplate *template.Template
+}
+
+// promptProfile is a configured profile with its parsed templates
+type promptProfile struct {
+	config.PromptProfile
+	prompts promptSet
+}
+
+// NewTemplateSummarizer creates a summarizer that prompts model with the
+// templates from the configuration. redact backs the redact template
+// function; without it values are left as they are.
+func NewTemplateSummarizer(cfg *config.Config, model ChatModel, redact func(any) any) (*TemplateSummarizer, error) {
+	s := &TemplateSummarizer{
+		model:     model,
+		cluster:   cfg.ClusterName,
+		tokens:    NewTokenEstimator(modelName(cfg)),
+		budget:    cfg.LLMPromptTokenBudget,
+		modelName: modelName(cfg),
+	}
+	if cfg.LLMCacheSize > 0 || cfg.LLMCacheDir != "" {
+		cache, err := NewResponseCache(cfg.LLMCacheSize, cfg.LLMCacheDir)
+		if err != nil {
+			return nil, err
+		}
+		s.cache = cache
+	}
+
+	defaults, err := parsePromptSet("default", promptSet{}, redact,
+		cfg.SystemPrompt, cfg.UserMessageTemplate, cfg.DeleteMessageTemplate)
+	if err != nil {
+		return nil, err
+	}
+	s.prompts = defaults
+
+	for _, profile := range cfg.PromptProfiles {
+		prompts, err := parsePromptSet(profile.Name, defaults, redact,
+			profile.SystemPrompt, profile.UserMessageTemplate, profile.DeleteMessageTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("prompt profile %q: %w", profile.Name, err)
+		}
+		s.profiles = append(s.profiles, promptProfile{PromptProfile: profile, prompts: prompts})
+	}
+	return s, nil
+}
+
+// parsePromptSet parses the given templates; empty ones are taken from base
+func parsePromptSet(name string, base promptSet, redact func(any) any, systemPrompt, userMessageTemplate, deleteMessageTemplate string) (promptSet, error) {
+	set := base
+	set.name = name
+	digest := sha256.New()
+	digest.Write([]byte(base.digest))
+	for _, prompt := range []struct {
+		name, text string
+		tmpl       **template.Template
+	}{
+		{"SYSTEM_PROMPT", systemPrompt, &set.systemPrompt},
+		{"USER_MESSAGE_TEMPLATE", userMessageTemplate, &set.userMessageTemplate},
+		{"DELETE_MESSAGE_TEMPLATE", deleteMessageTemplate, &set.deleteMessageTemplate},
+	} {
+		fmt.Fprintf(digest, "%s=%q\n", prompt.name, prompt.text)
+		if prompt.text == "" {
+			continue
+		}
+		tmpl, err := helpers.ParsePromptTemplate(prompt.name, prompt.text)
+		if err != nil {
+			return set, fmt.Errorf("invalid %s: %w", prompt.name, err)
+		}
+		*prompt.tmpl = tmpl.Funcs(helpers.PromptFuncs(redact))
+	}
+	set.digest = hex.EncodeToString(digest.Sum(nil))
+	return set, nil
+}
+
+// GenerateChangelogEntry generates a changelog entry using the templates of
+// the matching prompt profile
+func (s *TemplateSummarizer) GenerateChangelogEntry(ctx context.Context, req EntryRequest) (*Entry, error) {
+	// Validate inputs
+	if req.OldObject == "" && req.NewObject == "" {
+		return nil, fmt.Errorf("both oldObject and newObject cannot be empty")
+	}
+
+	return s.generate(ctx, req, false)
+}
+
+// GenerateDeletionEntry generates a changelog entry for a deleted resource.
+// The delete message template is used when configured, otherwise the user
+// message template with an empty NewObject.
+func (s *TemplateSummarizer) GenerateDeletionEntry(ctx context.Context, req EntryRequest) (*Entry, error) {
+	if req.OldObject == "" {
+		return nil, fmt.Errorf("finalObject cannot be empty")
+	}
+
+	return s.generate(ctx, req, true)
+}
+
+// generate renders the system prompt and the user message of the matching
+// profile and requests the entry
+func (s *TemplateSummarizer) generate(ctx context.Context, req EntryRequest, deletion bool) (*Entry, error) {
+	data, prompts, tmpl, err := s.prepare(req, deletion)
+	if err != nil {
+		return nil, err
+	}
+
+	// Deletions list no changes, so their entries depend on the whole final state
+	var cacheKey string
+	if s.cache != nil && !deletion && len(req.Diff.Changes) > 0 {
+		if cacheKey, err = entryCacheKey(s.modelName, prompts, req.Kind, req.Operation, req.Diff.Changes); err != nil {
+			return nil, err
+		}
+		if entry, ok := s.cache.Get(cacheKey); ok {
+			log.Info().
+				Str("profile", prompts.name).
+				Str("key", cacheKey).
+				Msg("Reusing cached changelog entry")
+			entry = identityOf(req).fill(entry)
+			entry.Cached = true
+			entry.Notes = append(entry.Notes, cachedNote)
+			return entry, nil
+		}
+	}
+
+	log.Debug().
+		Str("profile", prompts.name).
+		Str("template", tmpl.Name()).
+		Msg("Generating changelog entry from template")
+
+	entry, strategy, err := s.complete(ctx, prompts, tmpl, data)
+	if err != nil {
+		log.Error().Err(err).Str("strategy", string(strategy)).Msg("Failed to generate changelog entry")
+		return nil, fmt.Errorf("failed to generate changelog entry: %w", err)
+	}
+	promptStrategyTotal.With(string(strategy)).Inc()
+
+	log.Info().
+		Int("summary_length", len(entry.Summary)).
+		Str("impact", entry.Impact).
+		Str("strategy", string(strategy)).
+		Msg("Successfully generated changelog entry")
+
+	if note := budgetNote(strategy); note != "" {
+		entry.Notes = append(entry.Notes, note)
+	}
+	if cacheKey != "" {
+		s.cache.Put(cacheKey, identityOf(req).strip(entry))
+	}
+	return entry, nil
+}
+
+// prepare builds the template data of a request and selects the prompts
+// and the user message template for it
+func (s *TemplateSummarizer) prepare(req EntryRequest, deletion bool) (helpers.PromptData, promptSet, *template.Template, error) {
+	data, err := s.promptData(req, deletion)
+	if err != nil {
+		return data, promptSet{}, nil, err
+	}
+
+	prompts := s.selectPrompts(data)
+	tmpl := prompts.userMessageTemplate
+	if deletion && prompts.deleteMessageTemplate != nil {
+		tmpl = prompts.deleteMessageTemplate
+	}
+	if tmpl == nil {
+		if deletion {
+			return data, prompts, nil, fmt.Errorf("delete message template not configured")
+		}
+		return data, prompts, nil, fmt.Errorf("user message template not configured")
+	}
+	return data, prompts, tmpl, nil
+}
+
+// selectPrompts returns the prompts of the first profile matching the
+// resource, or the default prompts
+func (s *TemplateSummarizer) selectPrompts(data helpers.PromptData) promptSet {
+	for _, profile := range s.profiles {
+		if profile.matches(data) {
+			return profile.prompts
+		}
+	}
+	return s.prompts
+}
+
+// matches reports whether every criterion set on the profile matches the resource
+func (p promptProfile) matches(data helpers.PromptData) bool {
+	if len(p.Kinds) > 0 && !slices.ContainsFunc(p.Kinds, func(kind string) bool {
+		return matchesKind(kind, data)
+	}) {
+		return false
+	}
+	if len(p.Namespaces) > 0 && !slices.ContainsFunc(p.Namespaces, func(pattern string) bool {
+		ok, _ := path.Match(pattern, data.Namespace)
+		return ok
+	}) {
+		return false
+	}
+	for key, value := range p.Labels {
+		if v, ok := data.Labels[key]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesKind matches Kind, group/Kind or group/version/Kind; the core group
+// is written as an empty group, e.g. /v1/ConfigMap
+func matchesKind(kind string, data helpers.PromptData) bool {
+	parts := strings.Split(kind, "/")
+	switch len(parts) {
+	case 1:
+		return parts[0] == data.Kind
+	case 2:
+		return parts[0] == data.Group && parts[1] == data.Kind
+	case 3:
+		return parts[0] == data.Group && parts[1] == data.Version && parts[2] == data.Kind
+	}
+	return false
+}
+
+// promptData builds the template data of a request. Deletions list no changes.
+func (s *TemplateSummarizer) promptData(req EntryRequest, deletion bool) (helpers.PromptData, error) {
+	data := helpers.PromptData{
+		Kind:      req.Kind,
+		Group:     req.Group,
+		Version:   req.Version,
+		Namespace: req.Namespace,
+		Name:      req.Name,
+		Operation: req.Operation,
+		Cluster:   s.cluster,
+		GitDiff:   req.Diff.String(),
+		User:      req.Actor.Username,
+		UserType:  req.Actor.TypeLabel(),
+		Groups:    req.Actor.GroupList(),
+
+		Impersonator: req.Actor.Impersonator,
+	}
+	if !deletion {
+		data.Changes = helpers.SummarizeChanges(req.Diff.Changes)
+		data.ChangeList = req.Diff.Changes
+	}
+
+	var err error
+	if data.Old, data.OldObject, err = decodePromptObject(req.OldObject); err != nil {
+		return data, err
+	}
+	if data.New, data.NewObject, err = decodePromptObject(req.NewObject); err != nil {
+		return data, err
+	}
+
+	current := data.New
+	if current == nil {
+		current = data.Old
+	}
+	metadata, _ := current["metadata"].(map[string]any)
+	data.Labels = stringMap(metadata["labels"])
+	data.Annotations = stringMap(metadata["annotations"])
+	return data, nil
+}
+
+// decodePromptObject parses the JSON of a resource and renders it as YAML
+func decodePromptObject(raw string) (map[string]any, string, error) {
+	if raw == "" {
+		return nil, "", nil
+	}
+	obj, err := decodeObject(raw)
+	if err != nil {
+		return nil, "", err
+	}
+	text, err := yaml.Marshal(obj)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to marshal object to YAML: %w", err)
+	}
+	return obj, string(text), nil
+}
+
+// stringMap converts a decoded labels or annotations map
+func stringMap(value any) map[string]string {
+	m, _ := value.(map[string]any)
+	result := make(map[string]string, len(m))
+	for key, v := range m {
+		if s, ok := v.(string); ok {
+			result[key] = s
+		}
+	}
+	return result
+}
+
+// renderTemplate executes a prompt template; a nil template renders as empty
+func renderTemplate(tmpl *template.Template, data helpers.PromptData) (string, error) {
+	if tmpl == nil {
+		return "", nil
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("failed to render %s: %w", tmpl.Name(), err)
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,204 @@
+package models
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"channelog/config"
+	"channelog/helpers"
+)
+
+// recordingModel records the prompts it receives and replies with reply
+type recordingModel struct {
+	reply   string
+	systems []string
+	users   []string
+}
+
+func (m *recordingModel) Complete(_ context.Context, systemPrompt, userMessage string) (string, error) {
+	m.systems = append(m.systems, systemPrompt)
+	m.users = append(m.users, userMessage)
+	return m.reply, nil
+}
+
+// testConfig returns a configuration with the given templates
+func testConfig(systemPrompt, userMessageTemplate, deleteMessageTemplate string) *config.Config {
+	return &config.Config{
+		ClusterName:           "prod-eu",
+		SystemPrompt:          systemPrompt,
+		UserMessageTemplate:   userMessageTemplate,
+		DeleteMessageTemplate: deleteMessageTemplate,
+	}
+}
+
+// scaleRequest is an update of Deployment prod/web from 2 to 3 replicas
+func scaleRequest() EntryRequest {
+	return EntryRequest{
+		Kind: "Deployment", Group: "apps", Version: "v1", Namespace: "prod", Name: "web", Operation: "UPDATE",
+		OldObject: `{"metadata": {"labels": {"team": "web"}}, "spec": {"replicas": 2}}`,
+		NewObject: `{"metadata": {"labels": {"team": "web"}}, "spec": {"replicas": 3}}`,
+		Diff: &helpers.Diff{
+			Unified: "-replicas: 2\n+replicas: 3\n",
+			Changes: []helpers.Change{{Path: "spec.replicas", Op: helpers.ChangeReplace, OldValue: float64(2), NewValue: float64(3)}},
+		},
+		Actor: helpers.Actor{Username: "alice", Type: helpers.ActorHuman},
+	}
+}
+
+func TestTemplateSummarizerRendersTemplates(t *testing.T) {
+	model := &recordingModel{reply: `{"summary": "Scaled web", "impact": "low"}`}
+	summarizer, err := NewTemplateSummarizer(testConfig(
+		"You describe changes to {{.Cluster}}.",
+		"{{.Kind}} {{.Namespace}}/{{.Name}} by {{.User}} ({{.UserType}}): {{.Old.spec.replicas}} -> {{.New.spec.replicas}}, team {{.Labels.team}}\n{{.Changes}}{{range .ChangeList}}[{{.Path}}]{{end}}",
+		"",
+	), model, nil)
+	if err != nil {
+		t.Fatalf("NewTemplateSummarizer() error = %v", err)
+	}
+
+	entry, err := summarizer.GenerateChangelogEntry(context.Background(), scaleRequest())
+	if err != nil {
+		t.Fatalf("GenerateChangelogEntry() error = %v", err)
+	}
+	if entry.Summary != "Scaled web" || entry.Impact != ImpactLow {
+		t.Errorf("entry = %+v, want the parsed reply", entry)
+	}
+	if want := "You describe changes to prod-eu.\n\n" + entryInstructions; model.systems[0] != want {
+		t.Errorf("system prompt = %q, want %q", model.systems[0], want)
+	}
+	want := "Deployment prod/web by alice (Human): 2 -> 3, team web\nspec.replicas changed: 2 -> 3\n[spec.replicas]"
+	if model.users[0] != want {
+		t.Errorf("user message = %q, want %q", model.users[0], want)
+	}
+}
+
+func TestTemplateSummarizerDeletionTemplate(t *testing.T) {
+	req := scaleRequest()
+	req.Operation, req.NewObject = "DELETE", ""
+
+	// Without a delete template the user template sees no new object and no changes
+	model := &recordingModel{reply: `{"summary": "Deleted web"}`}
+	summarizer, err := NewTemplateSummarizer(testConfig("", "{{.Operation}} new={{.NewObject}} changes={{.Changes}}", ""), model, nil)
+	if err != nil {
+		t.Fatalf("NewTemplateSummarizer() error = %v", err)
+	}
+	if _, err := summarizer.GenerateDeletionEntry(context.Background(), req); err != nil {
+		t.Fatalf("GenerateDeletionEntry() error = %v", err)
+	}
+	if want := "DELETE new= changes="; model.users[0] != want {
+		t.Errorf("user message = %q, want %q", model.users[0], want)
+	}
+
+	summarizer, err = NewTemplateSummarizer(testConfig("", "{{.Operation}}", "final replicas {{.Old.spec.replicas}}"), model, nil)
+	if err != nil {
+		t.Fatalf("NewTemplateSummarizer() error = %v", err)
+	}
+	if _, err := summarizer.GenerateDeletionEntry(context.Background(), req); err != nil {
+		t.Fatalf("GenerateDeletionEntry() error = %v", err)
+	}
+	if want := "final replicas 2"; model.users[1] != want {
+		t.Errorf("user message = %q, want %q", model.users[1], want)
+	}
+}
+
+func TestNewTemplateSummarizerRejectsInvalidTemplates(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     *config.Config
+		wantErr string
+	}{
+		{"syntax", testConfig("", "{{.Kind", ""), "invalid USER_MESSAGE_TEMPLATE"},
+		{"unknown field", testConfig("{{.Clustr}}", "{{.Kind}}", ""), "invalid SYSTEM_PROMPT: template: SYSTEM_PROMPT: unknown field .Clustr"},
+		{"delete template", testConfig("", "{{.Kind}}", "{{.OldObjects}}"), "invalid DELETE_MESSAGE_TEMPLATE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewTemplateSummarizer(tt.cfg, &recordingModel{}, nil)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("NewTemplateSummarizer() error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTemplateSummarizerRedact(t *testing.T) {
+	model := &recordingModel{reply: `{"summary": "Rotated"}`}
+	redact := func(value any) any { return "<redacted>" }
+	summarizer, err := NewTemplateSummarizer(testConfig("", "{{redact .New.spec.replicas}}", ""), model, redact)
+	if err != nil {
+		t.Fatalf("NewTemplateSummarizer() error = %v", err)
+	}
+	if _, err := summarizer.GenerateChangelogEntry(context.Background(), scaleRequest()); err != nil {
+		t.Fatalf("GenerateChangelogEntry() error = %v", err)
+	}
+	if model.users[0] != "<redacted>" {
+		t.Errorf("user message = %q, want the redacted value", model.users[0])
+	}
+}
+
+func TestTemplateSummarizerSelectsProfiles(t *testing.T) {
+	cfg := testConfig("default system", "default {{.Kind}}", "")
+	cfg.PromptProfiles = []config.PromptProfile{
+		{Name: "rbac", Kinds: []string{"rbac.authorization.k8s.io/ClusterRoleBinding"}, SystemPrompt: "rbac system"},
+		{Name: "core", Kinds: []string{"/v1/ConfigMap"}, UserMessageTemplate: "core {{.Name}}"},
+		{Name: "payments", Namespaces: []string{"payments-*"}, Labels: map[string]string{"tier": "critical"}, UserMessageTemplate: "payments {{.Name}}"},
+	}
+	summarizer, err := NewTemplateSummarizer(cfg, &recordingModel{}, nil)
+	if err != nil {
+		t.Fatalf("NewTemplateSummarizer() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		data       helpers.PromptData
+		wantSystem string
+		wantUser   string
+	}{
+		{
+			name:       "group and kind",
+			data:       helpers.PromptData{Kind: "ClusterRoleBinding", Group: "rbac.authorization.k8s.io", Version: "v1"},
+			wantSystem: "rbac system",
+			wantUser:   "default ClusterRoleBinding",
+		},
+		{
+			name:       "kind of another group",
+			data:       helpers.PromptData{Kind: "ClusterRoleBinding", Group: "example.com", Version: "v1"},
+			wantSystem: "default system",
+			wantUser:   "default ClusterRoleBinding",
+		},
+		{
+			name:       "core group",
+			data:       helpers.PromptData{Kind: "ConfigMap", Version: "v1", Name: "settings"},
+			wantSystem: "default system",
+			wantUser:   "core settings",
+		},
+		{
+			name:       "namespace pattern and labels",
+			data:       helpers.PromptData{Kind: "Deployment", Namespace: "payments-eu", Name: "api", Labels: map[string]string{"tier": "critical"}},
+			wantSystem: "default system",
+			wantUser:   "payments api",
+		},
+		{
+			name:       "labels missing",
+			data:       helpers.PromptData{Kind: "Deployment", Namespace: "payments-eu", Name: "api"},
+			wantSystem: "default system",
+			wantUser:   "default Deployment",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prompts := summarizer.selectPrompts(tt.data)
+			system, _ := renderTemplate(prompts.systemPrompt, tt.data)
+			user, _ := renderTemplate(prompts.userMessageTemplate, tt.data)
+			if system != tt.wantSystem || user != tt.wantUser {
+				t.Errorf("prompts = %q, %q, want %q, %q", system, user, tt.wantSystem, tt.wantUser)
+			}
+		})
+	}
+
+	// Profiles have their own digest, so cached entries are not shared
+	if summarizer.profiles[0].prompts.digest == summarizer.prompts.digest {
+		t.Error("profile digest equals the default digest")
+	}
+}
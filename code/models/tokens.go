@@ -0,0 +1,84 @@
+package models
+
+import "strings"
+
+// TokenEstimator approximates how many tokens a model reads for a text. The
+// prompts are mostly YAML and diffs, which tokenize denser than prose, so
+// the ratios err on the side of more tokens.
+type TokenEstimator struct {
+	bytesPerToken float64
+}
+
+// modelBytesPerToken lists the bytes per token of model families by name
+// prefix; the first match is used
+var modelBytesPerToken = []struct {
+	prefix string
+	ratio  float64
+}{
+	// o200k_base tokenizer
+	{"gpt-4o", 3.6},
+	{"gpt-4.1", 3.6},
+	{"gpt-5", 3.6},
+	{"o1", 3.6},
+	{"o3", 3.6},
+	{"o4", 3.6},
+	// cl100k_base tokenizer
+	{"gpt-", 3.3},
+	{"claude", 3.0},
+	{"llama", 3.4},
+	{"mistral", 3.0},
+	{"qwen", 3.2},
+	{"gemma", 3.4},
+}
+
+// defaultBytesPerToken is used for unknown models
+const defaultBytesPerToken = 3.0
+
+// NewTokenEstimator creates the estimator for a model name such as gpt-4o,
+// claude-sonnet-4-5 or llama3.1
+func NewTokenEstimator(model string) TokenEstimator {
+	name := strings.ToLower(model)
+	// Ollama and proxies prefix the model with a namespace, e.g. library/llama3.1
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	for _, family := range modelBytesPerToken {
+		if strings.HasPrefix(name, family.prefix) {
+			return TokenEstimator{bytesPerToken: family.ratio}
+		}
+	}
+	return TokenEstimator{bytesPerToken: defaultBytesPerToken}
+}
+
+// Estimate returns the approximate number of tokens in text
+func (e TokenEstimator) Estimate(text string) int {
+	if text == "" {
+		return 0
+	}
+	return int(float64(len(text))/e.ratio()) + 1
+}
+
+// truncate cuts text at a line break so that it fits in about tokens tokens
+func (e TokenEstimator) truncate(text string, tokens int) string {
+	const marker = "... (truncated)\n"
+	size := int(float64(tokens-1)*e.ratio()) - len(marker)
+	if size >= len(text) {
+		return text
+	}
+	if size <= 0 {
+		return marker
+	}
+	cut := text[:size]
+	if i := strings.LastIndexByte(cut, '\n'); i >= 0 {
+		cut = cut[:i+1]
+	}
+	return strings.ToValidUTF8(cut, "") + marker
+}
+
+// ratio returns the bytes per token, also for the zero estimator
+func (e TokenEstimator) ratio() float64 {
+	if e.bytesPerToken <= 0 {
+		return defaultBytesPerToken
+	}
+	return e.bytesPerToken
+}
@@ -0,0 +1,598 @@
+// Package queue provides a durable, directory-backed work queue that sits
+// between the admission handler and changelog generation. Every admitted
+// change is written to disk before the webhook responds, drained by a bounded
+// pool of workers with retries, moved to a dead-letter directory once retries
+// are exhausted, and replayed on startup so nothing is lost across restarts.
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	admissionv1 "k8s.io/api/admission/v1"
+
+	"channelog/helpers"
+	"channelog/metrics"
+)
+
+const (
+	pendingDir = "pending"
+	deadDir    = "dead"
+
+	// maxRetryBackoff caps the exponential delay between attempts of one item
+	maxRetryBackoff = 10 * time.Minute
+)
+
+// OverflowPolicy decides what happens to a new change when the queue is full
+type OverflowPolicy string
+
+const (
+	// DropNewest rejects the incoming change
+	DropNewest OverflowPolicy = "drop-newest"
+	// DropOldest discards the oldest change that is still waiting for a worker
+	DropOldest OverflowPolicy = "drop-oldest"
+	// Coalesce merges the incoming change into a waiting change for the same
+	// object, falling back to DropNewest when there is none
+	Coalesce OverflowPolicy = "coalesce"
+)
+
+// ErrQueueFull is returned by Enqueue when the change was dropped by the overflow policy
+var ErrQueueFull = errors.New("changelog queue is full")
+
+// ErrCancelled is returned by a MergeFunc when two changes cancel each other
+// out, such as a CREATE followed by a DELETE; both are dropped
+var ErrCancelled = errors.New("changes cancel out")
+
+var (
+	depthGauge     = metrics.NewGauge("channelog_queue_depth", "Changes held by the changelog queue, including in-flight and scheduled retries.")
+	capacityGauge  = metrics.NewGauge("channelog_queue_capacity", "Maximum number of changes the changelog queue holds.")
+	inFlightGauge  = metrics.NewGauge("channelog_queue_in_flight", "Changes currently being processed by a worker.")
+	enqueuedTotal  = metrics.NewCounter("channelog_queue_enqueued_total", "Changes accepted into the changelog queue.")
+	droppedTotal   = metrics.NewCounterVec("channelog_queue_dropped_total", "Changes discarded because the changelog queue was full.", "policy")
+	coalescedTotal = metrics.NewCounter("channelog_queue_coalesced_total", "Changes merged into a waiting change for the same object.")
+	processedTotal = metrics.NewCounterVec("channelog_queue_processed_total", "Processing attempts by outcome.", "result")
+	batchesTotal   = metrics.NewCounter("channelog_queue_batches_total", "Batches of several correlated changes handed to the handler together.")
+	batchSizeTotal = metrics.NewCounter("channelog_queue_batched_items_total", "Changes handed to the handler as part of a batch.")
+)
+
+// Item is a single admitted change persisted in the queue
+type Item struct {
+	ID         string                      `json:"id"`
+	Review     admissionv1.AdmissionReview `json:"review"`
+	Diff       *helpers.Diff               `json:"diff"`
+	Attempts   int                         `json:"attempts"`
+	EnqueuedAt time.Time                   `json:"enqueuedAt"`
+	LastError  string                      `json:"lastError,omitempty"`
+}
+
+// Key identifies the object an item refers to, used for coalescing
+func (i Item) Key() string {
+	if i.Review.Request == nil {
+		return ""
+	}
+	r := i.Review.Request
+	return fmt.Sprintf("%s/%s/%s/%s", r.Kind.Group, r.Kind.Kind, r.Namespace, r.Name)
+}
+
+// Handler processes a batch of items, a single one unless batching is
+// enabled; a non-nil error schedules a retry of every item
+type Handler func(items []Item) error
+
+// MergeFunc combines a waiting item with a newer change to the same object
+type MergeFunc func(older, newer Item) (Item, error)
+
+// BatchKeyFunc returns the key of the batch an item belongs to, or an empty
+// string for an item that is processed on its own
+type BatchKeyFunc func(item Item) string
+
+// Options tunes the queue behaviour
+type Options struct {
+	// Capacity is the maximum number of items held, in-flight included
+	Capacity int
+	// Overflow is applied when an item is enqueued into a full queue
+	Overflow OverflowPolicy
+	// Merge is required by the Coalesce policy
+	Merge MergeFunc
+	// MaxAttempts before an item is dead-lettered
+	MaxAttempts int
+	// RetryBackoff is the delay before the first retry; it doubles per attempt
+	RetryBackoff time.Duration
+	// BatchWindow is how long a worker waits for more items with the same
+	// batch key before handing them over together; zero disables batching
+	BatchWindow time.Duration
+	// BatchKey is required when BatchWindow is set
+	BatchKey BatchKeyFunc
+	// BatchMax bounds the items handed over together; zero means unlimited
+	BatchMax int
+}
+
+// entry is a waiting item in the in-memory index
+type entry struct {
+	id    string
+	key   string
+	batch string
+}
+
+// Queue is a durable, bounded FIFO of Items backed by one JSON file per item
+type Queue struct {
+	dir     string
+	handler Handler
+	opts    Options
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	ready   []entry
+	size    int
+	stopped bool
+
+	// batching holds the batch keys a worker is collecting items for; their
+	// items are left to that worker
+	batching map[string]bool
+
+	seq atomic.Uint64
+	wg  sync.WaitGroup
+}
+
+// New creates a queue rooted at dir, creating its pending and dead-letter
+// directories if needed. Items are handed to handler by the workers started
+// with Start.
+func New(dir string, handler Handler, opts Options) (*Queue, error) {
+	if opts.Overflow == Coalesce && opts.Merge == nil {
+		return nil, fmt.Errorf("overflow policy %q requires a merge function", Coalesce)
+	}
+	if opts.BatchWindow > 0 && opts.BatchKey == nil {
+		return nil, fmt.Errorf("batch window requires a batch key function")
+	}
+
+	for _, sub := range []string{pendingDir, deadDir} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create queue directory %s: %w", sub, err)
+		}
+	}
+
+	q := &Queue{
+		dir:      dir,
+		handler:  handler,
+		opts:     opts,
+		batching: make(map[string]bool),
+	}
+	q.cond = sync.NewCond(&q.mu)
+	capacityGauge.Set(float64(opts.Capacity))
+	return q, nil
+}
+
+// Start replays items left over from a previous run and starts the workers.
+// Replayed items are kept even if they exceed the capacity.
+func (q *Queue) Start(workers int) error {
+	entries, err := os.ReadDir(filepath.Join(q.dir, pendingDir))
+	if err != nil {
+		return fmt.Errorf("failed to read pending queue: %w", err)
+	}
+
+	q.mu.Lock()
+	known := make(map[string]bool, len(q.ready))
+	for _, e := range q.ready {
+		known[e.id] = true
+	}
+	q.mu.Unlock()
+
+	var replayed []entry
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		id := strings.TrimSuffix(name, ".json")
+		if known[id] {
+			// Enqueued by this process before Start
+			continue
+		}
+		var key, batch string
+		if item, err := q.read(id); err == nil {
+			key, batch = item.Key(), q.batchKey(item)
+		}
+		replayed = append(replayed, entry{id: id, key: key, batch: batch})
+	}
+	// IDs start with a zero-padded timestamp, so lexical order is arrival order
+	slices.SortFunc(replayed, func(a, b entry) int {
+		return strings.Compare(a.id, b.id)
+	})
+
+	q.mu.Lock()
+	q.ready = append(replayed, q.ready...)
+	q.size += len(replayed)
+	depthGauge.Set(float64(q.size))
+	q.mu.Unlock()
+
+	if len(replayed) > 0 {
+		log.Info().Int("items", len(replayed)).Msg("Replaying pending changelog queue")
+	}
+
+	for range workers {
+		q.wg.Add(1)
+		go q.work()
+	}
+
+	log.Info().
+		Str("dir", q.dir).
+		Int("workers", workers).
+		Int("capacity", q.opts.Capacity).
+		Str("overflow", string(q.opts.Overflow)).
+		Dur("batch_window", q.opts.BatchWindow).
+		Msg("Changelog queue started")
+
+	return nil
+}
+
+// Stop lets in-flight items finish and stops the workers. Items still waiting
+// stay on disk and are replayed by the next Start.
+func (q *Queue) Stop() {
+	q.mu.Lock()
+	q.stopped = true
+	q.cond.Broadcast()
+	q.mu.Unlock()
+	q.wg.Wait()
+}
+
+// Enqueue durably stores the review and its computed diff. When Enqueue
+// returns nil the item survives a crash of the process. When the queue is
+// full the overflow policy is applied and ErrQueueFull is returned if the
+// incoming change was dropped.
+func (q *Queue) Enqueue(review admissionv1.AdmissionReview, diff *helpers.Diff) error {
+	now := time.Now().UTC()
+	item := Item{
+		ID:         fmt.Sprintf("%020d-%06d-%s", now.UnixNano(), q.seq.Add(1)%1e6, review.Request.UID),
+		Review:     review,
+		Diff:       diff,
+		EnqueuedAt: now,
+	}
+	key, batch := item.Key(), q.batchKey(item)
+
+	q.mu.Lock()
+	if q.size >= q.opts.Capacity {
+		switch q.opts.Overflow {
+		case DropOldest:
+			// The incoming item takes over the slot of the victim, so that
+			// concurrent enqueues never push the size past the capacity
+			if victim, ok := q.takeReady(func(entry) bool { return true }); ok {
+				q.mu.Unlock()
+				q.discard(victim.id)
+				return q.persist(item, entry{id: item.ID, key: key, batch: batch})
+			}
+		case Coalesce:
+			if older, ok := q.takeReady(func(e entry) bool { return e.key == key }); ok {
+				q.mu.Unlock()
+				return q.coalesce(older, item, entry{id: item.ID, key: key, batch: batch})
+			}
+		}
+		q.mu.Unlock()
+
+		droppedTotal.With(string(DropNewest)).Inc()
+		log.Warn().
+			Str("key", key).
+			Int("capacity", q.opts.Capacity).
+			Msg("Changelog queue full, dropping incoming change")
+		return ErrQueueFull
+	}
+	q.size++
+	depthGauge.Set(float64(q.size))
+	q.mu.Unlock()
+
+	return q.persist(item, entry{id: item.ID, key: key, batch: batch})
+}
+
+// batchKey returns the batch key of an item, or an empty string when
+// batching is disabled
+func (q *Queue) batchKey(item Item) string {
+	if q.opts.BatchWindow <= 0 || item.Review.Request == nil {
+		return ""
+	}
+	return q.opts.BatchKey(item)
+}
+
+// persist writes an item whose slot is already reserved and hands it to the
+// workers, freeing the slot when the write fails
+func (q *Queue) persist(item Item, e entry) error {
+	if err := q.write(item); err != nil {
+		q.release()
+		return err
+	}
+	enqueuedTotal.Inc()
+	q.push(e)
+	return nil
+}
+
+// coalesce merges a waiting item, already taken out of the ready list, with a
+// newer change to the same object and queues the result in its slot
+func (q *Queue) coalesce(waiting entry, newer Item, e entry) error {
+	older, err := q.read(waiting.id)
+	if err != nil {
+		log.Error().Err(err).Str("id", waiting.id).Msg("Failed to read item to coalesce, dropping it")
+		if err := os.Remove(q.pendingPath(waiting.id)); err != nil && !os.IsNotExist(err) {
+			log.Error().Err(err).Str("id", waiting.id).Msg("Failed to remove unreadable item")
+		}
+		return q.persist(newer, e)
+	}
+
+	merged, err := q.opts.Merge(older, newer)
+	if errors.Is(err, ErrCancelled) {
+		if err := os.Remove(q.pendingPath(waiting.id)); err != nil {
+			log.Error().Err(err).Str("id", waiting.id).Msg("Failed to remove cancelled item")
+		}
+		q.release()
+		coalescedTotal.Inc()
+		log.Debug().
+			Str("key", e.key).
+			Str("older", waiting.id).
+			Msg("Dropped waiting item cancelled out by a newer change")
+		return nil
+	}
+	if err != nil {
+		// Leave the waiting item alone and reject the newcomer
+		q.push(waiting)
+		droppedTotal.With(string(DropNewest)).Inc()
+		return fmt.Errorf("%w: failed to coalesce: %v", ErrQueueFull, err)
+	}
+	merged.ID = newer.ID
+	merged.EnqueuedAt = older.EnqueuedAt
+
+	if err := q.write(merged); err != nil {
+		q.push(waiting)
+		return err
+	}
+	if err := os.Remove(q.pendingPath(waiting.id)); err != nil {
+		log.Error().Err(err).Str("id", waiting.id).Msg("Failed to remove coalesced item")
+	}
+
+	coalescedTotal.Inc()
+	log.Debug().
+		Str("key", e.key).
+		Str("older", waiting.id).
+		Str("merged", merged.ID).
+		Msg("Coalesced change into waiting item")
+	e.id = merged.ID
+	q.push(e)
+	return nil
+}
+
+// takeReady removes and returns the oldest waiting entry matching match.
+// The caller must hold q.mu.
+func (q *Queue) takeReady(match func(entry) bool) (entry, bool) {
+	i := slices.IndexFunc(q.ready, match)
+	if i < 0 {
+		return entry{}, false
+	}
+	e := q.ready[i]
+	q.ready = slices.Delete(q.ready, i, i+1)
+	return e, true
+}
+
+// discard deletes a waiting item that was evicted by DropOldest. Its slot
+// is kept for the incoming item.
+func (q *Queue) discard(id string) {
+	if err := os.Remove(q.pendingPath(id)); err != nil {
+		log.Error().Err(err).Str("id", id).Msg("Failed to remove evicted item")
+	}
+	droppedTotal.With(string(DropOldest)).Inc()
+	log.Warn().Str("id", id).Msg("Changelog queue full, dropped oldest waiting change")
+}
+
+// release frees the slot of an item that left the queue
+func (q *Queue) release() {
+	q.mu.Lock()
+	q.size--
+	depthGauge.Set(float64(q.size))
+	q.mu.Unlock()
+}
+
+// push makes an already persisted item available to the workers
+func (q *Queue) push(e entry) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.ready = append(q.ready, e)
+	q.cond.Signal()
+}
+
+// pop blocks until an item is ready; ok is false once the queue is stopped.
+// Items of a batch another worker is collecting are skipped, and the batch
+// key of the returned item is claimed until collect releases it.
+func (q *Queue) pop() (e entry, ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for {
+		if q.stopped {
+			return entry{}, false
+		}
+		if e, ok := q.takeReady(func(e entry) bool { return !q.batching[e.batch] }); ok {
+			if e.batch != "" {
+				q.batching[e.batch] = true
+			}
+			return e, true
+		}
+		q.cond.Wait()
+	}
+}
+
+// collect waits for the batch window and returns first together with the
+// items of its batch that arrived meanwhile, releasing the batch key
+func (q *Queue) collect(first entry) []entry {
+	batch := []entry{first}
+	if first.batch == "" {
+		return batch
+	}
+	time.Sleep(q.opts.BatchWindow)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.opts.BatchMax <= 0 || len(batch) < q.opts.BatchMax {
+		e, ok := q.takeReady(func(e entry) bool { return e.batch == first.batch })
+		if !ok {
+			break
+		}
+		batch = append(batch, e)
+	}
+	delete(q.batching, first.batch)
+	// Items of the batch beyond BatchMax are free for other workers again
+	q.cond.Broadcast()
+	return batch
+}
+
+// work is the loop run by every worker goroutine
+func (q *Queue) work() {
+	defer q.wg.Done()
+	for {
+		e, ok := q.pop()
+		if !ok {
+			return
+		}
+		batch := q.collect(e)
+		inFlightGauge.Add(float64(len(batch)))
+		q.process(batch)
+		inFlightGauge.Add(-float64(len(batch)))
+	}
+}
+
+// process runs the handler for a batch and acknowledges, retries or
+// dead-letters its items
+func (q *Queue) process(batch []entry) {
+	var entries []entry
+	var items []Item
+	for _, e := range batch {
+		item, err := q.read(e.id)
+		if err != nil {
+			log.Error().Err(err).Str("id", e.id).Msg("Failed to read queued item, moving to dead letter")
+			q.deadLetter(e.id)
+			continue
+		}
+		entries = append(entries, e)
+		items = append(items, item)
+	}
+	if len(items) == 0 {
+		return
+	}
+	if len(items) > 1 {
+		batchSizeTotal.Add(uint64(len(items)))
+		batchesTotal.Inc()
+	}
+
+	err := q.handler(items)
+	for i, item := range items {
+		q.finish(entries[i], item, err)
+	}
+}
+
+// finish acknowledges an item after the handler succeeded, or schedules a
+// retry or dead-letters it after the handler failed with err
+func (q *Queue) finish(e entry, item Item, err error) {
+	id := e.id
+	if err == nil {
+		if err := os.Remove(q.pendingPath(id)); err != nil {
+			log.Error().Err(err).Str("id", id).Msg("Failed to acknowledge queued item")
+		}
+		q.release()
+		processedTotal.With("success").Inc()
+		return
+	}
+
+	item.Attempts++
+	item.LastError = err.Error()
+	if err := q.write(item); err != nil {
+		log.Error().Err(err).Str("id", id).Msg("Failed to record failed attempt")
+	}
+
+	if item.Attempts >= q.opts.MaxAttempts {
+		log.Error().
+			Str("id", id).
+			Int("attempts", item.Attempts).
+			Str("last_error", item.LastError).
+			Msg("Changelog item exhausted its retries, moving to dead letter")
+		q.deadLetter(id)
+		return
+	}
+
+	processedTotal.With("retry").Inc()
+	backoff := min(q.opts.RetryBackoff<<(item.Attempts-1), maxRetryBackoff)
+	log.Warn().
+		Err(err).
+		Str("id", id).
+		Int("attempt", item.Attempts).
+		Dur("backoff", backoff).
+		Msg("Changelog item failed, scheduling retry")
+	time.AfterFunc(backoff, func() { q.push(e) })
+}
+
+// deadLetter moves an item out of the pending directory for manual inspection
+func (q *Queue) deadLetter(id string) {
+	if err := os.Rename(q.pendingPath(id), filepath.Join(q.dir, deadDir, id+".json")); err != nil {
+		log.Error().Err(err).Str("id", id).Msg("Failed to move item to dead letter")
+	}
+	q.release()
+	processedTotal.With("dead_letter").Inc()
+}
+
+// read loads a pending item from disk
+func (q *Queue) read(id string) (Item, error) {
+	var item Item
+	data, err := os.ReadFile(q.pendingPath(id))
+	if err != nil {
+		return item, fmt.Errorf("failed to read queued item: %w", err)
+	}
+	if err := json.Unmarshal(data, &item); err != nil {
+		return item, fmt.Errorf("failed to decode queued item: %w", err)
+	}
+	return item, nil
+}
+
+// write persists an item atomically: it is written to a temporary file,
+// synced, and renamed over the pending path
+func (q *Queue) write(item Item) error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return fmt.Errorf("failed to encode queued item: %w", err)
+	}
+
+	dir := filepath.Join(q.dir, pendingDir)
+	tmp, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create queue file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write queue file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync queue file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close queue file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), q.pendingPath(item.ID)); err != nil {
+		return fmt.Errorf("failed to commit queue file: %w", err)
+	}
+
+	// Sync the directory so the rename itself is durable
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+
+	return nil
+}
+
+// pendingPath returns the on-disk location of a pending item
+func (q *Queue) pendingPath(id string) string {
+	return filepath.Join(q.dir, pendingDir, id+".json")
+}
@@ -0,0 +1,317 @@
+package queue
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"channelog/helpers"
+)
+
+// testReview returns a review of a change to the ConfigMap name
+func testReview(uid, name string, op admissionv1.Operation) admissionv1.AdmissionReview {
+	return admissionv1.AdmissionReview{
+		Request: &admissionv1.AdmissionRequest{
+			UID:       types.UID(uid),
+			Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "ConfigMap"},
+			Namespace: "prod",
+			Name:      name,
+			Operation: op,
+		},
+	}
+}
+
+// recorder is a Handler that records the batches it was given
+type recorder struct {
+	mu      sync.Mutex
+	batches [][]Item
+	err     error
+}
+
+func (r *recorder) handle(items []Item) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.batches = append(r.batches, items)
+	return r.err
+}
+
+// uids returns the UIDs of the recorded batches
+func (r *recorder) uids() [][]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var uids [][]string
+	for _, batch := range r.batches {
+		var ids []string
+		for _, item := range batch {
+			ids = append(ids, string(item.Review.Request.UID))
+		}
+		uids = append(uids, ids)
+	}
+	return uids
+}
+
+func defaultOptions() Options {
+	return Options{
+		Capacity:     10,
+		Overflow:     DropNewest,
+		MaxAttempts:  3,
+		RetryBackoff: time.Millisecond,
+	}
+}
+
+// files returns the item files in a queue subdirectory
+func files(t *testing.T, dir, sub string) []string {
+	t.Helper()
+	names, err := filepath.Glob(filepath.Join(dir, sub, "*.json"))
+	if err != nil {
+		t.Fatalf("failed to list %s: %v", sub, err)
+	}
+	return names
+}
+
+// waitFor polls cond until it holds or the test times out
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestQueueProcessesAndAcknowledges(t *testing.T) {
+	dir := t.TempDir()
+	rec := &recorder{}
+	q, err := New(dir, rec.handle, defaultOptions())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := q.Start(1); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer q.Stop()
+
+	diff := &helpers.Diff{Unified: "-a\n+b\n"}
+	if err := q.Enqueue(testReview("1", "settings", admissionv1.Update), diff); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+
+	waitFor(t, "the item to be acknowledged", func() bool {
+		return len(rec.uids()) == 1 && len(files(t, dir, pendingDir)) == 0
+	})
+	rec.mu.Lock()
+	item := rec.batches[0][0]
+	rec.mu.Unlock()
+	if item.Diff == nil || item.Diff.Unified != diff.Unified {
+		t.Errorf("handled diff = %+v, want %+v", item.Diff, diff)
+	}
+}
+
+func TestQueueRetriesThenDeadLetters(t *testing.T) {
+	dir := t.TempDir()
+	rec := &recorder{err: errors.New("model unavailable")}
+	opts := defaultOptions()
+	opts.MaxAttempts = 2
+	q, err := New(dir, rec.handle, opts)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := q.Start(1); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer q.Stop()
+
+	if err := q.Enqueue(testReview("1", "settings", admissionv1.Update), nil); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+
+	waitFor(t, "the item to be dead-lettered", func() bool {
+		return len(files(t, dir, deadDir)) == 1
+	})
+	if got := len(rec.uids()); got != 2 {
+		t.Errorf("handler calls = %d, want 2", got)
+	}
+	if got := len(files(t, dir, pendingDir)); got != 0 {
+		t.Errorf("pending items = %d, want 0", got)
+	}
+}
+
+func TestQueueReplaysPendingItemsOnStart(t *testing.T) {
+	dir := t.TempDir()
+	first, err := New(dir, (&recorder{}).handle, defaultOptions())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	// The process stops before any worker ran
+	for _, uid := range []string{"1", "2"} {
+		if err := first.Enqueue(testReview(uid, "settings-"+uid, admissionv1.Update), nil); err != nil {
+			t.Fatalf("Enqueue() error = %v", err)
+		}
+	}
+
+	rec := &recorder{}
+	second, err := New(dir, rec.handle, defaultOptions())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := second.Start(1); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer second.Stop()
+
+	waitFor(t, "the replayed items", func() bool { return len(rec.uids()) == 2 })
+	if got := rec.uids(); got[0][0] != "1" || got[1][0] != "2" {
+		t.Errorf("replayed order = %v, want arrival order", got)
+	}
+}
+
+func TestQueueDropsCancelledChanges(t *testing.T) {
+	dir := t.TempDir()
+	opts := defaultOptions()
+	opts.Capacity = 1
+	opts.Overflow = Coalesce
+	opts.Merge = func(older, newer Item) (Item, error) {
+		return Item{}, ErrCancelled
+	}
+	q, err := New(dir, (&recorder{}).handle, opts)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	if err := q.Enqueue(testReview("1", "settings", admissionv1.Create), nil); err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	if err := q.Enqueue(testReview("2", "settings", admissionv1.Delete), nil); err != nil {
+		t.Fatalf("Enqueue() of the cancelling change error = %v", err)
+	}
+	if got := len(files(t, dir, pendingDir)); got != 0 {
+		t.Errorf("pending items = %d, want both changes dropped", got)
+	}
+	// The slots of both changes are free again
+	if err := q.Enqueue(testReview("3", "other", admissionv1.Update), nil); err != nil {
+		t.Errorf("Enqueue() after cancellation error = %v", err)
+	}
+}
+
+// fullQueue returns a queue of capacity 2 holding changes to a and b, with no
+// workers running
+func fullQueue(t *testing.T, policy OverflowPolicy, merge MergeFunc) (*Queue, string) {
+	t.Helper()
+	dir := t.TempDir()
+	opts := defaultOptions()
+	opts.Capacity = 2
+	opts.Overflow = policy
+	opts.Merge = merge
+	q, err := New(dir, (&recorder{}).handle, opts)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	for _, uid := range []string{"a", "b"} {
+		if err := q.Enqueue(testReview(uid, uid, admissionv1.Update), nil); err != nil {
+			t.Fatalf("Enqueue(%s) error = %v", uid, err)
+		}
+	}
+	return q, dir
+}
+
+// waitingUIDs returns the UIDs of the waiting items in order
+func waitingUIDs(t *testing.T, q *Queue) []string {
+	t.Helper()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var uids []string
+	for _, e := range q.ready {
+		item, err := q.read(e.id)
+		if err != nil {
+			t.Fatalf("read(%s) error = %v", e.id, err)
+		}
+		uids = append(uids, string(item.Review.Request.UID))
+	}
+	return uids
+}
+
+func TestQueueOverflowPolicies(t *testing.T) {
+	mergeUIDs := func(older, newer Item) (Item, error) {
+		newer.Review.Request.UID = older.Review.Request.UID + "+" + newer.Review.Request.UID
+		return newer, nil
+	}
+
+	tests := []struct {
+		name     string
+		policy   OverflowPolicy
+		incoming admissionv1.AdmissionReview
+		wantErr  error
+		want     []string
+	}{
+		{"drop-newest rejects the incoming change", DropNewest, testReview("c", "c", admissionv1.Update), ErrQueueFull, []string{"a", "b"}},
+		{"drop-oldest evicts the oldest change", DropOldest, testReview("c", "c", admissionv1.Update), nil, []string{"b", "c"}},
+		{"coalesce merges into the change to the same object", Coalesce, testReview("c", "a", admissionv1.Update), nil, []string{"b", "a+c"}},
+		{"coalesce without a change to the same object drops", Coalesce, testReview("c", "c", admissionv1.Update), ErrQueueFull, []string{"a", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, dir := fullQueue(t, tt.policy, mergeUIDs)
+			err := q.Enqueue(tt.incoming, nil)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Enqueue() error = %v, want %v", err, tt.wantErr)
+			}
+			if got := waitingUIDs(t, q); !slices.Equal(got, tt.want) {
+				t.Errorf("waiting = %v, want %v", got, tt.want)
+			}
+			if got := len(files(t, dir, pendingDir)); got != len(tt.want) {
+				t.Errorf("pending files = %d, want %d", got, len(tt.want))
+			}
+			if q.size != 2 {
+				t.Errorf("size = %d, want 2", q.size)
+			}
+		})
+	}
+}
+
+func TestQueueDropOldestKeepsCapacityUnderConcurrentEnqueues(t *testing.T) {
+	q, dir := fullQueue(t, DropOldest, nil)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 50)
+	for i := range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			uid := string(rune('c' + i))
+			errs <- q.Enqueue(testReview(uid, uid, admissionv1.Update), nil)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	// A change finding every slot taken by changes still being written is
+	// dropped, as there is nothing waiting to evict
+	for err := range errs {
+		if err != nil && !errors.Is(err, ErrQueueFull) {
+			t.Errorf("Enqueue() error = %v", err)
+		}
+	}
+
+	if q.size != 2 || len(q.ready) != 2 {
+		t.Errorf("size = %d with %d waiting, want the capacity of 2", q.size, len(q.ready))
+	}
+	if got := len(files(t, dir, pendingDir)); got != 2 {
+		t.Errorf("pending files = %d, want 2", got)
+	}
+}
+
+func TestNewRequiresMergeForCoalesce(t *testing.T) {
+	opts := defaultOptions()
+	opts.Overflow = Coalesce
+	if _, err := New(t.TempDir(), (&recorder{}).handle, opts); err == nil {
+		t.Error("New() without a merge function succeeded, want an error")
+	}
+}
@@ -2,47 +2,76 @@ package service
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
 	admissionv1 "k8s.io/api/admission/v1"
 
 	"channelog/config"
+	"channelog/filters"
 	"channelog/helpers"
 	"channelog/models"
+	"channelog/queue"
 )
 
+// deletedWithoutStateSummary is the entry for a DELETE whose final state was not sent by the API server
+const deletedWithoutStateSummary = "The resource was removed from the cluster. The API server did not provide its final state."
+
 // ChangelogService handles changelog generation and git operations
 type ChangelogService struct {
 	cfg          *config.Config
-	modelService *models.OpenAIService
+	modelService models.Summarizer
 	gitService   *GitService
+	authors      *AuthorMapper
+
+	// rules describes the single resources of a batch
+	rules models.Summarizer
+
+	// manifests filters the manifests stored next to the entries, or is nil
+	// when manifests are not stored
+	manifests *filters.FilterConditions
 }
 
-// NewChangelogService creates a new ChangelogService instance
-func NewChangelogService(cfg *config.Config, modelService *models.OpenAIService) *ChangelogService {
-	return &ChangelogService{
+// NewChangelogService creates a new ChangelogService instance.
+// The gitService is shared across all requests and serializes their commits.
+// The filter rules apply to the stored manifests.
+func NewChangelogService(cfg *config.Config, modelService models.Summarizer, gitService *GitService, rules *filters.Rules) *ChangelogService {
+	cs := &ChangelogService{
 		cfg:          cfg,
 		modelService: modelService,
-		gitService:   NewGitService(cfg),
+		gitService:   gitService,
+		authors:      NewAuthorMapper(cfg),
+		rules:        models.NewRuleSummarizer(),
+	}
+	if cfg.StoreManifests {
+		cs.manifests = filters.NewFilterConditions(rules)
 	}
+	return cs
 }
 
-// ProcessAndCommit handles the complete changelog process: generation and commit
-func (cs *ChangelogService) ProcessAndCommit(review admissionv1.AdmissionReview) error {
+// ProcessAndCommit handles the complete changelog process: generation and commit.
+// objectDiff is the filtered diff computed when the request was admitted.
+func (cs *ChangelogService) ProcessAndCommit(review admissionv1.AdmissionReview, objectDiff *helpers.Diff) error {
+	if objectDiff == nil {
+		objectDiff = &helpers.Diff{}
+	}
+
 	// Log the admission request for observability
 	cs.logAdmissionRequest(review)
 
 	// Generate changelog entry
-	changelogEntry, err := cs.generateChangelogEntry(review)
+	changelogEntry, err := cs.generateChangelogEntry(review, objectDiff)
 	if err != nil {
 		log.Error().Err(err).Msg("failed to generate changelog entry")
 		return err
 	}
 
 	// Commit the changelog entry
-	if err := cs.commitChangelogEntry(review, changelogEntry); err != nil {
+	if err := cs.commitChangelogEntry(review, changelogEntry, objectDiff); err != nil {
 		log.Error().Err(err).Msg("failed to commit changelog entry")
 		return err
 	}
@@ -50,60 +79,188 @@ func (cs *ChangelogService) ProcessAndCommit(review admissionv1.AdmissionReview)
 	return nil
 }
 
+// ProcessBatch records changes to several resources of one release, made by
+// one user, in a single commit. The model writes one entry for the release,
+// which is committed next to a rule-based entry for every resource.
+func (cs *ChangelogService) ProcessBatch(items []queue.Item) error {
+	if len(items) == 1 {
+		return cs.ProcessAndCommit(items[0].Review, items[0].Diff)
+	}
+
+	first := items[0].Review
+	release, _ := releaseOf(first)
+	log.Info().
+		Str("release", release.String()).
+		Int("changes", len(items)).
+		Str("user", first.Request.UserInfo.Username).
+		Msg("received batch of correlated changes")
+
+	ctx := context.Background()
+	var reqs []models.EntryRequest
+	entries := make([]*models.Entry, len(items))
+	for i := range items {
+		if items[i].Diff == nil {
+			items[i].Diff = &helpers.Diff{}
+		}
+		review := items[i].Review
+		cs.logAdmissionRequest(review)
+
+		req, hasState, err := entryRequest(review, items[i].Diff)
+		if err != nil {
+			return err
+		}
+		if !hasState {
+			entries[i] = &models.Entry{Summary: deletedWithoutStateSummary}
+			continue
+		}
+		reqs = append(reqs, req)
+
+		generate := cs.rules.GenerateChangelogEntry
+		if review.Request.Operation == admissionv1.Delete {
+			generate = cs.rules.GenerateDeletionEntry
+		}
+		if entries[i], err = generate(ctx, req); err != nil {
+			return fmt.Errorf("failed to describe %s/%s: %w", review.Request.Kind.Kind, review.Request.Name, err)
+		}
+	}
+
+	releaseEntry := &models.Entry{Summary: fmt.Sprintf("Changed %d resources of %s.", len(items), release)}
+	if len(reqs) > 0 {
+		var err error
+		if releaseEntry, err = cs.modelService.GenerateBatchEntry(ctx, release.String(), reqs); err != nil {
+			log.Error().Err(err).Str("release", release.String()).Msg("failed to generate release changelog entry")
+			return err
+		}
+	}
+
+	releaseFile := cs.gitService.ReleaseFile(release.Namespace, release.Name, cs.formatReleaseContent(release, items, releaseEntry))
+	files := []CommitFile{releaseFile}
+	for i, item := range items {
+		r := item.Review.Request
+		entry := entries[i]
+		entry.Notes = append(entry.Notes, fmt.Sprintf("Recorded together with %d other changes of %s, described in %s.", len(items)-1, release, releaseFile.Name))
+		files = append(files, cs.gitService.EntryFile(r.Namespace, r.Kind.Group, r.Kind.Kind, r.Name,
+			cs.formatChangelogContent(item.Review, entry, item.Diff)))
+		if cs.manifests != nil {
+			manifest, err := cs.manifestFile(item.Review)
+			if err != nil {
+				return err
+			}
+			files = append(files, manifest)
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Add changelog for %s (%d changes)\n\n", release, len(items))
+	for _, item := range items {
+		fmt.Fprintf(&b, "- %s/%s (%s)\n", item.Review.Request.Kind.Kind, item.Review.Request.Name, item.Review.Request.Operation)
+	}
+	actor := helpers.NewActor(first.Request.UserInfo)
+	gitCommitMessage := b.String() + "\n" + commitTrailers(actor)
+
+	if err := cs.gitService.CreateCommitFiles(files, gitCommitMessage, cs.authors.Author(actor)); err != nil {
+		log.Error().Err(err).Str("release", release.String()).Msg("failed to commit release changelog")
+		return fmt.Errorf("failed to create git commit for %s: %w", releaseFile.Name, err)
+	}
+
+	log.Info().
+		Str("release", release.String()).
+		Str("filename", releaseFile.Name).
+		Int("files", len(files)).
+		Msg("successfully created release changelog and committed to git")
+
+	return nil
+}
+
 // generateChangelogEntry processes the admission review and generates a changelog entry
-func (cs *ChangelogService) generateChangelogEntry(review admissionv1.AdmissionReview) (string, error) {
-	// Get json objects from the request
-	oldObject, newObject, err := getOldNewObjects(review)
+func (cs *ChangelogService) generateChangelogEntry(review admissionv1.AdmissionReview, objectDiff *helpers.Diff) (*models.Entry, error) {
+	req, hasState, err := entryRequest(review, objectDiff)
 	if err != nil {
-		return "", fmt.Errorf("failed to get old and new objects: %w", err)
+		return nil, err
 	}
 
-	// Generate a diff between the old and new objects
-	objectDiff, err := helpers.ObjectDiff(oldObject, newObject)
+	// Use the summarizer to generate the changelog entry
+	ctx := context.Background()
+	if review.Request.Operation == admissionv1.Delete {
+		// The old object is the final state of the resource
+		if !hasState {
+			return &models.Entry{Summary: deletedWithoutStateSummary}, nil
+		}
+		return cs.modelService.GenerateDeletionEntry(ctx, req)
+	}
+	return cs.modelService.GenerateChangelogEntry(ctx, req)
+}
+
+// entryRequest builds the summarizer request of an admission review.
+// hasState is false for a DELETE whose final state was not sent.
+func entryRequest(review admissionv1.AdmissionReview, objectDiff *helpers.Diff) (models.EntryRequest, bool, error) {
+	// Get json objects from the request
+	oldObject, newObject, err := getOldNewObjects(review)
 	if err != nil {
-		log.Error().Err(err).Msg("failed to generate object diff")
-		return "", err
+		return models.EntryRequest{}, false, fmt.Errorf("failed to get old and new objects: %w", err)
 	}
 
 	// Convert the jsons to string
-	var oldObjectStr, newObjectStr string
+	req := models.EntryRequest{
+		Kind:      review.Request.Kind.Kind,
+		Group:     review.Request.Kind.Group,
+		Version:   review.Request.Kind.Version,
+		Namespace: review.Request.Namespace,
+		Name:      review.Request.Name,
+		Operation: string(review.Request.Operation),
+		Diff:      objectDiff,
+		Actor:     helpers.NewActor(review.Request.UserInfo),
+	}
 	if oldObject != nil {
-		oldObjectStr = string(review.Request.OldObject.Raw)
+		req.OldObject = string(review.Request.OldObject.Raw)
 	}
 	if newObject != nil {
-		newObjectStr = string(review.Request.Object.Raw)
+		req.NewObject = string(review.Request.Object.Raw)
 	}
 
-	// Use the OpenAI service to generate a commit message
-	ctx := context.Background()
-	return cs.modelService.GenerateChangelogEntry(ctx, oldObjectStr, newObjectStr, objectDiff)
+	hasState := review.Request.Operation != admissionv1.Delete || oldObject != nil
+	return req, hasState, nil
 }
 
 // commitChangelogEntry creates and commits the changelog entry to git
-func (cs *ChangelogService) commitChangelogEntry(review admissionv1.AdmissionReview, changelogEntry string) error {
-	// Generate filename based on resource information
-	fileName := cs.gitService.GenerateFileName(
+func (cs *ChangelogService) commitChangelogEntry(review admissionv1.AdmissionReview, changelogEntry *models.Entry, objectDiff *helpers.Diff) error {
+	// Format the changelog entry with metadata
+	changelogContent := cs.formatChangelogContent(review, changelogEntry, objectDiff)
+
+	// Choose the file based on resource information and the configured layout
+	file := cs.gitService.EntryFile(
 		review.Request.Namespace,
-		review.Request.Name,
+		review.Request.Kind.Group,
 		review.Request.Kind.Kind,
+		review.Request.Name,
+		changelogContent,
 	)
 
-	// Format the changelog entry with metadata
-	changelogContent := cs.formatChangelogContent(review, changelogEntry)
-
-	// Create git commit with the changelog entry
-	gitCommitMessage := fmt.Sprintf("Add changelog for %s/%s (%s)",
+	// Create git commit with the changelog entry, with the Kubernetes actor as trailers
+	actor := helpers.NewActor(review.Request.UserInfo)
+	gitCommitMessage := fmt.Sprintf("Add changelog for %s/%s (%s)\n\n%s",
 		review.Request.Kind.Kind,
 		review.Request.Name,
 		review.Request.Operation,
+		commitTrailers(actor),
 	)
 
-	if err := cs.gitService.CreateCommit(fileName, changelogContent, gitCommitMessage); err != nil {
-		return fmt.Errorf("failed to create git commit for %s: %w", fileName, err)
+	files := []CommitFile{file}
+	if cs.manifests != nil {
+		manifest, err := cs.manifestFile(review)
+		if err != nil {
+			return err
+		}
+		files = append(files, manifest)
+	}
+
+	author := cs.authors.Author(actor)
+	if err := cs.gitService.CreateCommitFiles(files, gitCommitMessage, author); err != nil {
+		return fmt.Errorf("failed to create git commit for %s: %w", file.Name, err)
 	}
 
 	log.Info().
-		Str("filename", fileName).
+		Str("filename", file.Name).
 		Str("commit_message", gitCommitMessage).
 		Str("changelogContent", changelogContent).
 		Msg("successfully created changelog entry and committed to git")
@@ -111,6 +268,39 @@ func (cs *ChangelogService) commitChangelogEntry(review admissionv1.AdmissionRev
 	return nil
 }
 
+// manifestFile returns the change to the stored manifest of the resource in a
+// review: the filtered object, which is already redacted, or the removal of
+// the manifest on DELETE
+func (cs *ChangelogService) manifestFile(review admissionv1.AdmissionReview) (CommitFile, error) {
+	r := review.Request
+	name := cs.gitService.GenerateManifestFileName(r.Namespace, r.Kind.Group, r.Kind.Kind, r.Name)
+	if r.Operation == admissionv1.Delete {
+		return CommitFile{Name: name, Delete: true}, nil
+	}
+
+	_, newObject, err := getOldNewObjects(review)
+	if err != nil {
+		return CommitFile{}, fmt.Errorf("failed to get manifest of %s/%s: %w", r.Kind.Kind, r.Name, err)
+	}
+	data, err := yaml.Marshal(cs.manifests.ApplyAll(newObject))
+	if err != nil {
+		return CommitFile{}, fmt.Errorf("failed to marshal manifest of %s/%s: %w", r.Kind.Kind, r.Name, err)
+	}
+	return CommitFile{Name: name, Content: string(data)}, nil
+}
+
+// commitTrailers renders the Kubernetes actor as git trailers
+func commitTrailers(actor helpers.Actor) string {
+	trailers := fmt.Sprintf("Kubernetes-User: %s\nKubernetes-User-Type: %s\n", actor.Username, actor.Type)
+	if actor.Impersonator != "" {
+		trailers += fmt.Sprintf("Kubernetes-Impersonator: %s\n", actor.Impersonator)
+	}
+	if len(actor.Groups) > 0 {
+		trailers += fmt.Sprintf("Kubernetes-Groups: %s\n", actor.GroupList())
+	}
+	return trailers
+}
+
 // logAdmissionRequest logs key fields from the AdmissionRequest for observability
 func (cs *ChangelogService) logAdmissionRequest(review admissionv1.AdmissionReview) {
 	log.Info().
@@ -120,38 +310,260 @@ func (cs *ChangelogService) logAdmissionRequest(review admissionv1.AdmissionRevi
 		Str("name", review.Request.Name).
 		Str("namespace", review.Request.Namespace).
 		Str("operation", string(review.Request.Operation)).
+		Str("user", review.Request.UserInfo.Username).
 		Msg("received AdmissionReview")
 }
 
-// formatChangelogContent formats the changelog entry with metadata
-func (cs *ChangelogService) formatChangelogContent(review admissionv1.AdmissionReview, changelogEntry string) string {
+// changelogRecord is the YAML front matter of a changelog file, holding the
+// structured fields of the entry for querying
+type changelogRecord struct {
+	Kind         string `yaml:"kind"`
+	Group        string `yaml:"group,omitempty"`
+	Version      string `yaml:"version"`
+	Namespace    string `yaml:"namespace,omitempty"`
+	Name         string `yaml:"name"`
+	Operation    string `yaml:"operation"`
+	Timestamp    string `yaml:"timestamp"`
+	UID          string `yaml:"uid"`
+	User         string `yaml:"user"`
+	Impersonator string `yaml:"impersonator,omitempty"`
+	models.Entry `yaml:",inline"`
+}
+
+// formatChangelogContent formats the changelog entry with metadata. The
+// structured fields of the entry precede the Markdown as YAML front matter.
+func (cs *ChangelogService) formatChangelogContent(review admissionv1.AdmissionReview, changelogEntry *models.Entry, objectDiff *helpers.Diff) string {
 	ist, err := time.LoadLocation("Asia/Kolkata")
 	if err != nil {
 		// Fallback to UTC if Asia/Kolkata timezone cannot be loaded
 		ist = time.UTC
 	}
-	timestamp := time.Now().In(ist).Format(time.RFC1123)
-	return fmt.Sprintf(`# Changelog Entry
+	now := time.Now().In(ist)
+	timestamp := now.Format(time.RFC1123)
+	return fmt.Sprintf(`%s# Changelog Entry
 
 **Resource:** %s/%s  
 **Namespace:** %s  
 **Operation:** %s  
 **Timestamp:** %s  
 **UID:** %s  
-
+%s
 ## Change Summary
 
 %s
-
+%s
 ---
 *Generated automatically by Channelog*
 `,
+		formatFrontMatter(review, changelogEntry, now),
 		review.Request.Kind.Kind,
 		review.Request.Name,
 		review.Request.Namespace,
 		review.Request.Operation,
 		timestamp,
 		review.Request.UID,
-		changelogEntry,
+		formatActor(helpers.NewActor(review.Request.UserInfo)),
+		formatEntry(changelogEntry),
+		formatPatches(objectDiff),
 	)
 }
+
+// releaseRecord is the YAML front matter of a release changelog file
+type releaseRecord struct {
+	Release      string   `yaml:"release"`
+	Source       string   `yaml:"source"`
+	Namespace    string   `yaml:"namespace,omitempty"`
+	Name         string   `yaml:"name"`
+	Timestamp    string   `yaml:"timestamp"`
+	User         string   `yaml:"user"`
+	Impersonator string   `yaml:"impersonator,omitempty"`
+	Resources    []string `yaml:"resources"`
+	models.Entry `yaml:",inline"`
+}
+
+// formatReleaseContent formats the entry of a release with the list of its
+// changed resources
+func (cs *ChangelogService) formatReleaseContent(release Release, items []queue.Item, entry *models.Entry) string {
+	ist, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		// Fallback to UTC if Asia/Kolkata timezone cannot be loaded
+		ist = time.UTC
+	}
+	now := time.Now().In(ist)
+	first := items[0].Review
+
+	var resources strings.Builder
+	record := releaseRecord{
+		Release:      release.String(),
+		Source:       release.Source,
+		Namespace:    release.Namespace,
+		Name:         release.Name,
+		Timestamp:    now.Format(time.RFC3339),
+		User:         first.Request.UserInfo.Username,
+		Impersonator: helpers.NewActor(first.Request.UserInfo).Impersonator,
+		Entry:        *entry,
+	}
+	for _, item := range items {
+		r := item.Review.Request
+		resource := fmt.Sprintf("%s %s (%s)", r.Kind.Kind, helpers.QualifiedName(r.Namespace, r.Name), r.Operation)
+		record.Resources = append(record.Resources, resource)
+		fmt.Fprintf(&resources, "- %s\n", resource)
+	}
+
+	frontMatter := ""
+	if data, err := yaml.Marshal(record); err != nil {
+		log.Error().Err(err).Msg("failed to marshal release front matter")
+	} else {
+		frontMatter = "---\n" + string(data) + "---\n\n"
+	}
+
+	return fmt.Sprintf(`%s# Release Changelog Entry
+
+**Release:** %s  
+**Changes:** %d  
+**Timestamp:** %s  
+%s
+## Changed Resources
+
+%s
+## Change Summary
+
+%s
+---
+*Generated automatically by Channelog*
+`,
+		frontMatter,
+		release,
+		len(items),
+		now.Format(time.RFC1123),
+		formatActor(helpers.NewActor(first.Request.UserInfo)),
+		resources.String(),
+		formatEntry(entry),
+	)
+}
+
+// formatFrontMatter renders the resource and the structured fields of the
+// entry as YAML front matter
+func formatFrontMatter(review admissionv1.AdmissionReview, entry *models.Entry, now time.Time) string {
+	record := changelogRecord{
+		Kind:         review.Request.Kind.Kind,
+		Group:        review.Request.Kind.Group,
+		Version:      review.Request.Kind.Version,
+		Namespace:    review.Request.Namespace,
+		Name:         review.Request.Name,
+		Operation:    string(review.Request.Operation),
+		Timestamp:    now.Format(time.RFC3339),
+		UID:          string(review.Request.UID),
+		User:         review.Request.UserInfo.Username,
+		Impersonator: helpers.NewActor(review.Request.UserInfo).Impersonator,
+		Entry:        *entry,
+	}
+	data, err := yaml.Marshal(record)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to marshal changelog front matter")
+		return ""
+	}
+	return "---\n" + string(data) + "---\n\n"
+}
+
+// formatEntry renders the fields of an entry as Markdown; fields the
+// summarizer left empty are omitted
+func formatEntry(entry *models.Entry) string {
+	var b strings.Builder
+	b.WriteString(strings.TrimSpace(entry.Summary))
+	b.WriteString("\n")
+
+	if entry.Impact != "" || len(entry.Categories) > 0 {
+		b.WriteString("\n")
+	}
+	if entry.Impact != "" {
+		fmt.Fprintf(&b, "**Impact:** %s  \n", strings.ToUpper(entry.Impact[:1])+entry.Impact[1:])
+	}
+	if len(entry.Categories) > 0 {
+		fmt.Fprintf(&b, "**Categories:** %s  \n", strings.Join(entry.Categories, ", "))
+	}
+
+	if entry.Risk != "" {
+		fmt.Fprintf(&b, "\n### Risk\n\n%s\n", strings.TrimSpace(entry.Risk))
+	}
+	for _, section := range []struct {
+		title string
+		items []string
+	}{
+		{"Security Notes", entry.SecurityNotes},
+		{"Recommended Actions", entry.RecommendedActions},
+	} {
+		if len(section.items) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n### %s\n\n", section.title)
+		for _, item := range section.items {
+			fmt.Fprintf(&b, "- %s\n", item)
+		}
+	}
+
+	for _, note := range entry.Notes {
+		fmt.Fprintf(&b, "\n*%s*\n", note)
+	}
+	return b.String()
+}
+
+// formatPatches renders the patches between the filtered objects as JSON
+// blocks for tooling that replays or reverts the change. Fields removed by the
+// filter rules are not part of the patches; changes to redacted values and
+// sorted set-like lists are left out and listed instead, as the patches could
+// not reproduce them on the live object.
+func formatPatches(objectDiff *helpers.Diff) string {
+	if len(objectDiff.JSONPatch) == 0 && len(objectDiff.OmittedPatchPaths) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("\n## Patches\n")
+	for _, block := range []struct {
+		title string
+		patch any
+		empty bool
+	}{
+		{"JSON Patch (RFC 6902)", objectDiff.JSONPatch, len(objectDiff.JSONPatch) == 0},
+		{"Revert JSON Patch (RFC 6902)", objectDiff.RevertPatch, len(objectDiff.RevertPatch) == 0},
+		{"JSON Merge Patch (RFC 7386)", objectDiff.MergePatch, len(objectDiff.MergePatch) == 0},
+	} {
+		if block.empty {
+			continue
+		}
+		data, err := json.MarshalIndent(block.patch, "", "  ")
+		if err != nil {
+			log.Error().Err(err).Str("patch", block.title).Msg("failed to marshal patch")
+			continue
+		}
+		fmt.Fprintf(&b, "\n### %s\n\n```json\n%s\n```\n", block.title, data)
+	}
+	if len(objectDiff.OmittedPatchPaths) > 0 {
+		b.WriteString("\nLeft out of the patches because the recorded values are redacted or normalized:\n\n")
+		for _, path := range objectDiff.OmittedPatchPaths {
+			fmt.Fprintf(&b, "- `%s`\n", path)
+		}
+	}
+	return b.String()
+}
+
+// formatActor renders the user who made the change as changelog metadata lines
+func formatActor(actor helpers.Actor) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "**Requested By:** %s  \n", actor.Username)
+	if actor.Impersonator != "" {
+		fmt.Fprintf(&b, "**Impersonated By:** %s  \n", actor.Impersonator)
+	}
+	fmt.Fprintf(&b, "**Actor Type:** %s  \n", actor.TypeLabel())
+	if actor.Type == helpers.ActorServiceAccount {
+		fmt.Fprintf(&b, "**Service Account:** %s/%s  \n", actor.ServiceAccountNamespace, actor.ServiceAccountName)
+	}
+	if len(actor.Groups) > 0 {
+		fmt.Fprintf(&b, "**Groups:** %s  \n", actor.GroupList())
+	}
+	if len(actor.Extra) > 0 {
+		fmt.Fprintf(&b, "**User Extra:** %s  \n", actor.ExtraList())
+	}
+	return b.String()
+}
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+
+	"channelog/filters"
+	"channelog/helpers"
+	"channelog/models"
+)
+
+// fakeSummarizer records the requests it was asked to describe
+type fakeSummarizer struct {
+	changes, deletions []models.EntryRequest
+	batches            [][]models.EntryRequest
+}
+
+func (f *fakeSummarizer) GenerateChangelogEntry(_ context.Context, req models.EntryRequest) (*models.Entry, error) {
+	f.changes = append(f.changes, req)
+	return &models.Entry{Summary: "changed"}, nil
+}
+
+func (f *fakeSummarizer) GenerateDeletionEntry(_ context.Context, req models.EntryRequest) (*models.Entry, error) {
+	f.deletions = append(f.deletions, req)
+	return &models.Entry{Summary: "deleted"}, nil
+}
+
+func (f *fakeSummarizer) GenerateBatchEntry(_ context.Context, _ string, reqs []models.EntryRequest) (*models.Entry, error) {
+	f.batches = append(f.batches, reqs)
+	return &models.Entry{Summary: "released"}, nil
+}
+
+func TestGenerateChangelogEntryForDeletes(t *testing.T) {
+	summarizer := &fakeSummarizer{}
+	cs := &ChangelogService{modelService: summarizer}
+
+	final := configMap("one")
+	entry, err := cs.generateChangelogEntry(testReview(t, admissionv1.Delete, final, nil), &helpers.Diff{})
+	if err != nil {
+		t.Fatalf("generateChangelogEntry() error = %v", err)
+	}
+	if entry.Summary != "deleted" || len(summarizer.deletions) != 1 || len(summarizer.changes) != 0 {
+		t.Fatalf("entry = %q after %d deletion and %d change requests, want one deletion request",
+			entry.Summary, len(summarizer.deletions), len(summarizer.changes))
+	}
+	req := summarizer.deletions[0]
+	if req.OldObject == "" || req.NewObject != "" || req.Operation != "DELETE" {
+		t.Errorf("request = %+v, want the final state as OldObject", req)
+	}
+
+	// The API server may leave out the final state
+	entry, err = cs.generateChangelogEntry(testReview(t, admissionv1.Delete, nil, nil), &helpers.Diff{})
+	if err != nil {
+		t.Fatalf("generateChangelogEntry() error = %v", err)
+	}
+	if entry.Summary != deletedWithoutStateSummary || len(summarizer.deletions) != 1 {
+		t.Errorf("entry = %q, want %q without asking the summarizer", entry.Summary, deletedWithoutStateSummary)
+	}
+}
+
+func TestActorRendering(t *testing.T) {
+	actor := helpers.NewActor(authenticationv1.UserInfo{
+		Username: "deployer",
+		Groups:   []string{"system:authenticated"},
+		Extra: map[string]authenticationv1.ExtraValue{
+			"impersonator": {"bob"},
+			"authentication.kubernetes.io/credential-id": {"JTI=5f2c"},
+		},
+	})
+
+	rendered := formatActor(actor)
+	if !strings.Contains(rendered, "**Impersonated By:** bob") {
+		t.Errorf("formatActor() = %q, want the impersonator", rendered)
+	}
+	if strings.Contains(rendered, "credential-id") || strings.Contains(rendered, "JTI") {
+		t.Errorf("formatActor() = %q, want credential metadata left out", rendered)
+	}
+
+	trailers := commitTrailers(actor)
+	want := "Kubernetes-User: deployer\nKubernetes-User-Type: human\nKubernetes-Impersonator: bob\nKubernetes-Groups: system:authenticated\n"
+	if trailers != want {
+		t.Errorf("commitTrailers() = %q, want %q", trailers, want)
+	}
+}
+
+func TestFormatPatches(t *testing.T) {
+	secret := func(password, kind string) map[string]any {
+		return map[string]any{
+			"apiVersion": "v1",
+			"kind":       "Secret",
+			"type":       kind,
+			"stringData": map[string]any{"password": password},
+		}
+	}
+
+	diff, err := helpers.DiffObjects(
+		secret("<redacted sha256:1111111111111111>", "Opaque"),
+		secret("<redacted sha256:2222222222222222>", "kubernetes.io/basic-auth"))
+	if err != nil {
+		t.Fatalf("DiffObjects() error = %v", err)
+	}
+	got := formatPatches(diff)
+	for _, want := range []string{
+		`"path": "/type"`,
+		"Left out of the patches because the recorded values are redacted or normalized:\n\n- `/stringData/password`\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("formatPatches() = %s, want it to contain %q", got, want)
+		}
+	}
+	if strings.Contains(got, "<redacted") {
+		t.Errorf("formatPatches() = %s, want no redacted placeholders", got)
+	}
+
+	// Only the password changed: nothing is replayable
+	diff, err = helpers.DiffObjects(
+		secret("<redacted sha256:1111111111111111>", "Opaque"),
+		secret("<redacted sha256:2222222222222222>", "Opaque"))
+	if err != nil {
+		t.Fatalf("DiffObjects() error = %v", err)
+	}
+	got = formatPatches(diff)
+	if strings.Contains(got, "```json") || !strings.Contains(got, "- `/stringData/password`") {
+		t.Errorf("formatPatches() = %s, want only the omitted path", got)
+	}
+}
+
+func TestManifestFile(t *testing.T) {
+	cs := &ChangelogService{gitService: &GitService{}, manifests: filters.NewFilterConditions(&filters.Rules{})}
+
+	object := configMap("two")
+	object["metadata"].(map[string]any)["resourceVersion"] = "42"
+	object["status"] = map[string]any{"phase": "Active"}
+	file, err := cs.manifestFile(testReview(t, admissionv1.Update, configMap("one"), object))
+	if err != nil {
+		t.Fatalf("manifestFile() error = %v", err)
+	}
+	want := "apiVersion: v1\ndata:\n    mode: two\nkind: ConfigMap\nmetadata:\n    name: settings\n    namespace: prod\n"
+	if file.Name != "prod/core/configmap/settings.yaml" || file.Content != want || file.Delete || file.Append {
+		t.Errorf("manifestFile() = %+v, want the filtered object in prod/core/configmap/settings.yaml", file)
+	}
+
+	file, err = cs.manifestFile(testReview(t, admissionv1.Delete, configMap("two"), nil))
+	if err != nil {
+		t.Fatalf("manifestFile() error = %v", err)
+	}
+	if file.Name != "prod/core/configmap/settings.yaml" || !file.Delete {
+		t.Errorf("manifestFile() = %+v, want the manifest removed", file)
+	}
+}
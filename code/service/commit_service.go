@@ -5,6 +5,7 @@ package service
 
 import (
 	"encoding/json"
+	"fmt"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/rs/zerolog/log"
@@ -13,20 +14,25 @@ import (
 	"channelog/config"
 	"channelog/filters"
 	"channelog/helpers"
-	"channelog/models"
+	"channelog/queue"
 )
 
 // CommitService handles AdmissionReview requests and records changelog entries.
 // It skips requests that filters.ValidateValidRequest reports should be
-// ignored, such as Pod objects.
+// ignored according to the filter rules, such as Pod objects. Sensitive values
+// are redacted before the change is diffed, queued or sent to the model.
 //
-//	c            - Fiber context wrapping the HTTP request/response.
-//	cfg          - Application configuration.
-//	modelService - OpenAI client for generating text responses.
+//	c              - Fiber context wrapping the HTTP request/response.
+//	cfg            - Application configuration.
+//	rules          - Declarative filter rules loaded at startup.
+//	redaction      - Redaction stage applied to both objects of the request.
+//	changelogQueue - Durable queue drained by the changelog workers.
 func CommitService(
 	c *fiber.Ctx,
 	cfg *config.Config,
-	modelService *models.OpenAIService,
+	rules *filters.Rules,
+	redaction *filters.RedactionFilterCondition,
+	changelogQueue *queue.Queue,
 ) error {
 	var review admissionv1.AdmissionReview
 	if err := json.Unmarshal(c.Body(), &review); err != nil {
@@ -43,28 +49,24 @@ func CommitService(
 		UID:     review.Request.UID,
 	}
 
-	shouldSkip := filters.ValidateValidRequest(review)
+	shouldSkip := filters.ValidateValidRequest(review, rules)
 	if shouldSkip {
 		return c.
 			Status(fiber.StatusOK).
 			JSON(review)
 	}
 
-	// Check for meaningful differences before launching goroutine
-	oldObject, newObject, err := getOldNewObjects(review)
+	// Nothing past this point sees the unredacted objects
+	recorded, err := redactReview(review, redaction)
 	if err != nil {
-		log.Error().Err(err).Msg("failed to get old and new objects")
+		log.Error().Err(err).Msg("failed to redact admission request")
 		return c.
 			Status(fiber.StatusOK).
 			JSON(review)
 	}
 
-	// Apply filter conditions to check for meaningful changes
-	filterConditions := filters.NewFilterConditions()
-	filteredOld := filterConditions.ApplyAll(oldObject)
-	filteredNew := filterConditions.ApplyAll(newObject)
-
-	objectDiff, err := helpers.ObjectDiff(filteredOld, filteredNew)
+	// Check for meaningful differences before queueing
+	objectDiff, err := filteredObjectDiff(recorded, rules)
 	if err != nil {
 		log.Error().Err(err).Msg("failed to generate object diff")
 		return c.
@@ -72,8 +74,9 @@ func CommitService(
 			JSON(review)
 	}
 
-	// Early exit if no meaningful changes detected
-	if objectDiff == "No differences found" {
+	// Early exit if no meaningful changes detected. A DELETE is always recorded
+	// so the history of the resource ends with its removal.
+	if objectDiff.Unified == "" && review.Request.Operation != admissionv1.Delete {
 		log.Debug().
 			Str("uid", string(review.Request.UID)).
 			Str("kind", review.Request.Kind.String()).
@@ -86,17 +89,96 @@ func CommitService(
 			JSON(review)
 	}
 
-	reviewCopy := review.DeepCopy()
-
-	// Create changelog service and process the request in a goroutine
-	changelogService := NewChangelogService(cfg, modelService)
-	go changelogService.ProcessAndCommit(*reviewCopy)
+	// Persist the change before responding so it survives restarts; the queue
+	// workers generate and commit the changelog entry asynchronously
+	if err := changelogQueue.Enqueue(recorded, objectDiff); err != nil {
+		log.Error().
+			Err(err).
+			Str("uid", string(review.Request.UID)).
+			Str("kind", review.Request.Kind.String()).
+			Str("name", review.Request.Name).
+			Str("namespace", review.Request.Namespace).
+			Msg("failed to enqueue changelog entry")
+	}
 
 	return c.
 		Status(fiber.StatusOK).
 		JSON(review)
 }
 
+// redactReview returns a copy of the review whose old and new objects have
+// been passed through the redaction stage
+func redactReview(review admissionv1.AdmissionReview, redaction *filters.RedactionFilterCondition) (admissionv1.AdmissionReview, error) {
+	redacted := *review.DeepCopy()
+	for _, raw := range []*[]byte{&redacted.Request.Object.Raw, &redacted.Request.OldObject.Raw} {
+		if *raw == nil {
+			continue
+		}
+		var obj map[string]any
+		if err := json.Unmarshal(*raw, &obj); err != nil {
+			return admissionv1.AdmissionReview{}, err
+		}
+		data, err := json.Marshal(redaction.Apply(obj))
+		if err != nil {
+			return admissionv1.AdmissionReview{}, err
+		}
+		*raw = data
+	}
+	return redacted, nil
+}
+
+// filteredObjectDiff diffs the old and new objects of the review after applying
+// the filter conditions, so only meaningful changes show up
+func filteredObjectDiff(review admissionv1.AdmissionReview, rules *filters.Rules) (*helpers.Diff, error) {
+	oldObject, newObject, err := getOldNewObjects(review)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get old and new objects: %w", err)
+	}
+
+	filterConditions := filters.NewFilterConditions(rules)
+	filteredOld := filterConditions.ApplyAll(oldObject)
+	filteredNew := filterConditions.ApplyAll(newObject)
+
+	return helpers.DiffObjects(filteredOld, filteredNew)
+}
+
+// NewItemCoalescer returns a queue.MergeFunc that merges a queued change still
+// waiting for a worker with a newer change to the same object. The result spans
+// from the older item's previous state to the newer item's state, so one
+// changelog entry covers both.
+func NewItemCoalescer(rules *filters.Rules) queue.MergeFunc {
+	return func(older, newer queue.Item) (queue.Item, error) {
+		return coalesceItems(older, newer, rules)
+	}
+}
+
+// coalesceItems merges older into newer and recomputes the filtered diff.
+// A DELETE keeps its own final state, and a CREATE followed by a DELETE
+// cancels out.
+func coalesceItems(older, newer queue.Item, rules *filters.Rules) (queue.Item, error) {
+	olderOp, newerOp := older.Review.Request.Operation, newer.Review.Request.Operation
+	if olderOp == admissionv1.Create && newerOp == admissionv1.Delete {
+		return queue.Item{}, queue.ErrCancelled
+	}
+
+	merged := newer
+	merged.Review = *newer.Review.DeepCopy()
+	if newerOp != admissionv1.Delete {
+		merged.Review.Request.OldObject = *older.Review.Request.OldObject.DeepCopy()
+	}
+	if olderOp == admissionv1.Create {
+		merged.Review.Request.Operation = admissionv1.Create
+	}
+
+	objectDiff, err := filteredObjectDiff(merged.Review, rules)
+	if err != nil {
+		return queue.Item{}, err
+	}
+	merged.Diff = objectDiff
+
+	return merged, nil
+}
+
 // getOldNewObjects extracts old and new objects from the admission review
 func getOldNewObjects(review admissionv1.AdmissionReview) (map[string]any, map[string]any, error) {
 	var newObject map[string]any
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"channelog/filters"
+	"channelog/queue"
+)
+
+// testReview builds an admission review of a ConfigMap; a nil object is left out
+func testReview(t *testing.T, op admissionv1.Operation, oldObject, newObject map[string]any) admissionv1.AdmissionReview {
+	t.Helper()
+	raw := func(obj map[string]any) runtime.RawExtension {
+		if obj == nil {
+			return runtime.RawExtension{}
+		}
+		data, err := json.Marshal(obj)
+		if err != nil {
+			t.Fatalf("failed to marshal object: %v", err)
+		}
+		return runtime.RawExtension{Raw: data}
+	}
+	return admissionv1.AdmissionReview{
+		Request: &admissionv1.AdmissionRequest{
+			UID:       "uid",
+			Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "ConfigMap"},
+			Namespace: "prod",
+			Name:      "settings",
+			Operation: op,
+			Object:    raw(newObject),
+			OldObject: raw(oldObject),
+		},
+	}
+}
+
+// configMap returns a ConfigMap holding one value
+func configMap(value string) map[string]any {
+	return map[string]any{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]any{"name": "settings", "namespace": "prod"},
+		"data":       map[string]any{"mode": value},
+	}
+}
+
+func TestCoalesceItems(t *testing.T) {
+	v1, v2, v3 := configMap("one"), configMap("two"), configMap("three")
+
+	tests := []struct {
+		name          string
+		older, newer  admissionv1.AdmissionReview
+		wantOperation admissionv1.Operation
+		wantOld       map[string]any
+		wantNew       map[string]any
+	}{
+		{
+			name:          "updates span both changes",
+			older:         testReview(t, admissionv1.Update, v1, v2),
+			newer:         testReview(t, admissionv1.Update, v2, v3),
+			wantOperation: admissionv1.Update,
+			wantOld:       v1,
+			wantNew:       v3,
+		},
+		{
+			name:          "create then update stays a create",
+			older:         testReview(t, admissionv1.Create, nil, v1),
+			newer:         testReview(t, admissionv1.Update, v1, v2),
+			wantOperation: admissionv1.Create,
+			wantNew:       v2,
+		},
+		{
+			name:          "update then delete keeps the final state of the delete",
+			older:         testReview(t, admissionv1.Update, v1, v2),
+			newer:         testReview(t, admissionv1.Delete, v2, nil),
+			wantOperation: admissionv1.Delete,
+			wantOld:       v2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, err := coalesceItems(queue.Item{Review: tt.older}, queue.Item{Review: tt.newer}, filters.DefaultRules())
+			if err != nil {
+				t.Fatalf("coalesceItems() error = %v", err)
+			}
+			if got := merged.Review.Request.Operation; got != tt.wantOperation {
+				t.Errorf("operation = %s, want %s", got, tt.wantOperation)
+			}
+			oldObject, newObject, err := getOldNewObjects(merged.Review)
+			if err != nil {
+				t.Fatalf("getOldNewObjects() error = %v", err)
+			}
+			if got, want := mustJSON(t, oldObject), mustJSON(t, tt.wantOld); got != want {
+				t.Errorf("old object = %s, want %s", got, want)
+			}
+			if got, want := mustJSON(t, newObject), mustJSON(t, tt.wantNew); got != want {
+				t.Errorf("new object = %s, want %s", got, want)
+			}
+			if merged.Diff == nil || merged.Diff.Unified == "" {
+				t.Errorf("diff is empty, want it recomputed")
+			}
+		})
+	}
+}
+
+func TestCoalesceItemsCreateThenDeleteCancels(t *testing.T) {
+	v1 := configMap("one")
+	_, err := coalesceItems(
+		queue.Item{Review: testReview(t, admissionv1.Create, nil, v1)},
+		queue.Item{Review: testReview(t, admissionv1.Delete, v1, nil)},
+		filters.DefaultRules(),
+	)
+	if !errors.Is(err, queue.ErrCancelled) {
+		t.Errorf("coalesceItems() error = %v, want ErrCancelled", err)
+	}
+}
+
+func mustJSON(t *testing.T, obj map[string]any) string {
+	t.Helper()
+	if obj == nil {
+		return "null"
+	}
+	data, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatalf("failed to marshal object: %v", err)
+	}
+	return string(data)
+}
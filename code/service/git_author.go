@@ -0,0 +1,103 @@
+package service
+
+import (
+	"net/mail"
+	"strings"
+
+	"channelog/config"
+	"channelog/helpers"
+)
+
+// CommitAuthor is the identity recorded as the author of a changelog commit
+type CommitAuthor struct {
+	Name  string
+	Email string
+}
+
+// AuthorMapper maps the Kubernetes user behind a change to a git author.
+// The committer always stays the bot identity from USERNAME/USER_EMAIL.
+type AuthorMapper struct {
+	enabled                   bool
+	emailTemplate             string
+	serviceAccountEmailFormat string
+	table                     map[string]string
+}
+
+// NewAuthorMapper creates an AuthorMapper from the GIT_AUTHOR_* configuration
+func NewAuthorMapper(cfg *config.Config) *AuthorMapper {
+	return &AuthorMapper{
+		enabled:                   cfg.GitAuthorFromUser,
+		emailTemplate:             cfg.GitAuthorEmailTemplate,
+		serviceAccountEmailFormat: cfg.GitAuthorServiceAccountEmail,
+		table:                     cfg.GitAuthorMap,
+	}
+}
+
+// Author returns the commit author for actor, or nil when the bot identity
+// should be used. Lookup order:
+//  1. an explicit entry in the author map ("Name <email>" or a bare email)
+//  2. service accounts: the service account email template, if configured
+//  3. humans: the username itself when it is an email address, otherwise
+//     the email template
+//
+// System components and unmapped users fall back to the bot identity.
+func (m *AuthorMapper) Author(actor helpers.Actor) *CommitAuthor {
+	if !m.enabled || actor.Username == "" {
+		return nil
+	}
+
+	if entry, ok := m.table[actor.Username]; ok {
+		if addr, err := mail.ParseAddress(entry); err == nil {
+			name := addr.Name
+			if name == "" {
+				name = actor.Username
+			}
+			return &CommitAuthor{Name: name, Email: addr.Address}
+		}
+	}
+
+	switch actor.Type {
+	case helpers.ActorServiceAccount:
+		if m.serviceAccountEmailFormat == "" {
+			return nil
+		}
+		return &CommitAuthor{
+			Name:  actor.Username,
+			Email: expandAuthorTemplate(m.serviceAccountEmailFormat, actor),
+		}
+	case helpers.ActorSystem:
+		return nil
+	}
+
+	if _, err := mail.ParseAddress(actor.Username); err == nil {
+		// OIDC providers commonly use the email address as the username
+		return &CommitAuthor{Name: actor.Username, Email: actor.Username}
+	}
+
+	if m.emailTemplate == "" {
+		return nil
+	}
+	return &CommitAuthor{
+		Name:  actor.Username,
+		Email: expandAuthorTemplate(m.emailTemplate, actor),
+	}
+}
+
+// expandAuthorTemplate replaces {user}, {namespace} and {name} in template.
+// {user} is the username made safe for the local part of an email address.
+func expandAuthorTemplate(template string, actor helpers.Actor) string {
+	user := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			return r
+		default:
+			return '.'
+		}
+	}, actor.Username)
+
+	return strings.NewReplacer(
+		"{user}", user,
+		"{namespace}", actor.ServiceAccountNamespace,
+		"{name}", actor.ServiceAccountName,
+	).Replace(template)
+}
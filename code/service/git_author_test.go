@@ -0,0 +1,69 @@
+package service
+
+import (
+	"testing"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+
+	"channelog/config"
+	"channelog/helpers"
+)
+
+func TestAuthorMapper(t *testing.T) {
+	mapper := NewAuthorMapper(&config.Config{
+		GitAuthorFromUser:            true,
+		GitAuthorEmailTemplate:       "{user}@example.com",
+		GitAuthorServiceAccountEmail: "{name}+{namespace}@bots.example.com",
+		GitAuthorMap: map[string]string{
+			"alice":                         "Alice Liddell <alice@wonderland.example>",
+			"system:serviceaccount:ci:argo": "argo@example.com",
+		},
+	})
+
+	tests := []struct {
+		username  string
+		wantName  string
+		wantEmail string
+	}{
+		{"alice", "Alice Liddell", "alice@wonderland.example"},
+		{"system:serviceaccount:ci:argo", "system:serviceaccount:ci:argo", "argo@example.com"},
+		{"system:serviceaccount:ci:deployer", "system:serviceaccount:ci:deployer", "deployer+ci@bots.example.com"},
+		{"bob@corp.example", "bob@corp.example", "bob@corp.example"},
+		{"oidc:carol smith", "oidc:carol smith", "oidc.carol.smith@example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.username, func(t *testing.T) {
+			author := mapper.Author(helpers.NewActor(authenticationv1.UserInfo{Username: tt.username}))
+			if author == nil {
+				t.Fatalf("Author() = nil, want %s <%s>", tt.wantName, tt.wantEmail)
+			}
+			if author.Name != tt.wantName || author.Email != tt.wantEmail {
+				t.Errorf("Author() = %s <%s>, want %s <%s>", author.Name, author.Email, tt.wantName, tt.wantEmail)
+			}
+		})
+	}
+}
+
+func TestAuthorMapperFallsBackToBot(t *testing.T) {
+	enabled := NewAuthorMapper(&config.Config{GitAuthorFromUser: true})
+	disabled := NewAuthorMapper(&config.Config{GitAuthorEmailTemplate: "{user}@example.com"})
+
+	tests := []struct {
+		name     string
+		mapper   *AuthorMapper
+		username string
+	}{
+		{"disabled", disabled, "alice"},
+		{"system component", enabled, "system:kube-scheduler"},
+		{"service account without template", enabled, "system:serviceaccount:ci:deployer"},
+		{"human without template", enabled, "alice"},
+		{"unknown user", enabled, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if author := tt.mapper.Author(helpers.NewActor(authenticationv1.UserInfo{Username: tt.username})); author != nil {
+				t.Errorf("Author() = %+v, want nil", author)
+			}
+		})
+	}
+}
@@ -1,13 +1,19 @@
 package service
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-git/go-billy/v5/memfs"
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/go-git/go-git/v5/plumbing/transport"
@@ -23,9 +29,43 @@ const (
 	// Using "__cluster-scope__" ensures it cannot be a valid k8s namespace name
 	// (k8s namespace names cannot contain underscores)
 	ClusterScopeFolder = "__cluster-scope__"
+
+	// ReleaseFolder is the folder holding the entries of releases, changes to
+	// several resources made together; as the folders of kinds are lowercase
+	// kinds it cannot clash with them
+	ReleaseFolder = "__releases__"
+
+	// CoreGroupFolder is the group folder of the core API group in the
+	// resource layout
+	CoreGroupFolder = "core"
 )
 
-// GitService provides in-memory git repository operations using go-git
+// maxPushRetryBackoff caps the exponential backoff between rejected pushes
+const maxPushRetryBackoff = 30 * time.Second
+
+// ErrGitServiceStopped is returned by CreateCommit once the writer goroutine has been stopped
+var ErrGitServiceStopped = errors.New("git service stopped")
+
+// PushRejectedError is returned when the remote kept rejecting the push after
+// every rebase-and-retry attempt
+type PushRejectedError struct {
+	Branch   string
+	Attempts int
+	Err      error
+}
+
+func (e *PushRejectedError) Error() string {
+	return fmt.Sprintf("push to %s rejected after %d attempts: %v", e.Branch, e.Attempts, e.Err)
+}
+
+func (e *PushRejectedError) Unwrap() error {
+	return e.Err
+}
+
+// GitService provides in-memory git repository operations using go-git.
+// A single GitService is shared by all admission requests: it keeps one clone
+// alive for the lifetime of the process and funnels every commit through one
+// writer goroutine, so concurrent changes never race on the worktree or push.
 type GitService struct {
 	repoURL   string
 	branch    string
@@ -35,9 +75,36 @@ type GitService struct {
 	repo      *git.Repository
 	worktree  *git.Worktree
 	auth      transport.AuthMethod
+
+	maxPushRetries   int
+	pushRetryBackoff time.Duration
+
+	// layout and resourceFileMode decide where entries are written
+	layout           string
+	resourceFileMode string
+
+	// appended holds the files each unpushed commit appended to, so that a
+	// replay appends to the remote version of exactly those files
+	appended map[plumbing.Hash][]string
+
+	requests chan commitRequest
+	quit     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// commitRequest is a single unit of work handed to the writer goroutine
+type commitRequest struct {
+	files         []CommitFile
+	commitMessage string
+	author        *CommitAuthor
+	result        chan error
+
+	// do replaces the commit with other work on the repository
+	do func() error
 }
 
-// NewGitService creates a new git service instance
+// NewGitService creates a new git service instance and starts its writer goroutine
 func NewGitService(cfg *channelconfig.Config) *GitService {
 	service := &GitService{
 		repoURL:   cfg.GitRepo,
@@ -45,14 +112,53 @@ func NewGitService(cfg *channelconfig.Config) *GitService {
 		username:  cfg.Username,
 		userEmail: cfg.UserEmail,
 		token:     cfg.GitToken,
+
+		maxPushRetries:   cfg.GitPushMaxRetries,
+		pushRetryBackoff: cfg.GitPushRetryBackoff,
+
+		layout:           cfg.ChangelogLayout,
+		resourceFileMode: cfg.ResourceFileMode,
+
+		requests: make(chan commitRequest),
+		quit:     make(chan struct{}),
+		done:     make(chan struct{}),
 	}
 
 	// Set up authentication
 	service.setupAuth()
 
+	go service.run()
+
 	return service
 }
 
+// Stop terminates the writer goroutine after the in-flight commit, if any, completes.
+// Calls to CreateCommit made after Stop return ErrGitServiceStopped.
+func (g *GitService) Stop() {
+	g.stopOnce.Do(func() {
+		close(g.quit)
+	})
+	<-g.done
+}
+
+// run is the single writer goroutine; it owns repo and worktree exclusively
+func (g *GitService) run() {
+	defer close(g.done)
+	for {
+		select {
+		case req := <-g.requests:
+			if req.do != nil {
+				req.result <- req.do()
+				continue
+			}
+			req.result <- g.commit(req.files, req.commitMessage, req.author)
+		case <-g.quit:
+			log.Info().Msg("Git writer stopped")
+			return
+		}
+	}
+}
+
 // setupAuth configures authentication based on repository URL and token
 func (g *GitService) setupAuth() {
 	if g.token != "" && strings.HasPrefix(g.repoURL, "https://") {
@@ -108,14 +214,188 @@ func (g *GitService) InitializeRepo() error {
 	return nil
 }
 
-// CreateCommit creates a commit with the given file content and pushes it
-func (g *GitService) CreateCommit(fileName, content, commitMessage string) error {
+// CommitFile is a file written by a commit
+type CommitFile struct {
+	Name    string
+	Content string
+
+	// Append adds Content to the end of the file instead of replacing it
+	Append bool
+
+	// Delete removes the file, if it exists, instead of writing it
+	Delete bool
+}
+
+// CreateCommit creates a commit with the given file content and pushes it.
+// The commit is authored by author, or by the bot identity when author is nil;
+// the committer is always the bot identity.
+// The call is queued to the writer goroutine and blocks until the commit has
+// been pushed or has failed.
+func (g *GitService) CreateCommit(fileName, content, commitMessage string, author *CommitAuthor) error {
+	return g.CreateCommitFiles([]CommitFile{{Name: fileName, Content: content}}, commitMessage, author)
+}
+
+// CreateCommitFiles is CreateCommit for several files written by one commit
+func (g *GitService) CreateCommitFiles(files []CommitFile, commitMessage string, author *CommitAuthor) error {
+	return g.send(commitRequest{
+		files:         files,
+		commitMessage: commitMessage,
+		author:        author,
+		result:        make(chan error, 1),
+	})
+}
+
+// send queues a request to the writer goroutine and waits for its result
+func (g *GitService) send(req commitRequest) error {
+	select {
+	case g.requests <- req:
+	case <-g.quit:
+		return ErrGitServiceStopped
+	}
+
+	return <-req.result
+}
+
+// syncRepo makes sure the clone exists and is fast-forwarded to the remote branch.
+// If the existing clone cannot be fast-forwarded it is discarded and re-cloned.
+func (g *GitService) syncRepo() error {
 	if g.repo == nil {
-		if err := g.InitializeRepo(); err != nil {
+		return g.InitializeRepo()
+	}
+
+	err := g.worktree.Pull(&git.PullOptions{
+		RemoteName:    git.DefaultRemoteName,
+		ReferenceName: plumbing.NewBranchReferenceName(g.branch),
+		SingleBranch:  true,
+		Auth:          g.auth,
+	})
+	if err == nil || errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return nil
+	}
+
+	log.Warn().
+		Err(err).
+		Str("branch", g.branch).
+		Msg("Failed to fast-forward repository, re-cloning")
+	g.resetRepo()
+	return g.InitializeRepo()
+}
+
+// resetRepo drops the in-memory clone so the next commit starts from a fresh clone
+func (g *GitService) resetRepo() {
+	g.repo = nil
+	g.worktree = nil
+	clear(g.appended)
+}
+
+// commit writes the files, commits and pushes them. It must only be called from run.
+func (g *GitService) commit(files []CommitFile, commitMessage string, author *CommitAuthor) error {
+	if err := g.syncRepo(); err != nil {
+		return err
+	}
+
+	authorSignature := &object.Signature{
+		Name:  g.username,
+		Email: g.userEmail,
+		When:  time.Now(),
+	}
+	if author != nil {
+		authorSignature.Name = author.Name
+		authorSignature.Email = author.Email
+	}
+
+	commitHash, err := g.commitFiles(files, commitMessage, authorSignature)
+	if err != nil {
+		return err
+	}
+
+	// Push the changes, rebasing onto the remote branch when the push is rejected
+	if err := g.pushWithRetry(); err != nil {
+		// The local branch now holds an unpushed commit; start over on the next request
+		g.resetRepo()
+		return err
+	}
+	clear(g.appended)
+
+	log.Info().
+		Int("files", len(files)).
+		Str("filename", files[0].Name).
+		Str("commit_message", commitMessage).
+		Str("commit_hash", commitHash.String()[:8]).
+		Str("author", authorSignature.Email).
+		Msg("Successfully created and pushed commit")
+
+	return nil
+}
+
+// commitFiles applies the files and commits them locally as author, with
+// the bot identity as committer, remembering the files that were appended to
+func (g *GitService) commitFiles(files []CommitFile, commitMessage string, author *object.Signature) (plumbing.Hash, error) {
+	if err := g.applyFiles(files); err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	commitHash, err := g.worktree.Commit(commitMessage, &git.CommitOptions{
+		Author: author,
+		Committer: &object.Signature{
+			Name:  g.username,
+			Email: g.userEmail,
+			When:  time.Now(),
+		},
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to create commit")
+		return plumbing.ZeroHash, fmt.Errorf("failed to create commit: %w", err)
+	}
+
+	var appended []string
+	for _, file := range files {
+		if file.Append {
+			appended = append(appended, filepath.ToSlash(file.Name))
+		}
+	}
+	g.rememberAppends(commitHash, appended)
+	return commitHash, nil
+}
+
+// rememberAppends records the files an unpushed commit appended to
+func (g *GitService) rememberAppends(commit plumbing.Hash, files []string) {
+	if len(files) == 0 {
+		return
+	}
+	if g.appended == nil {
+		g.appended = make(map[plumbing.Hash][]string)
+	}
+	g.appended[commit] = files
+}
+
+// applyFiles writes, appends to or removes the files in the worktree and
+// stages them
+func (g *GitService) applyFiles(files []CommitFile) error {
+	for _, file := range files {
+		if file.Delete {
+			if err := g.removeFile(file.Name); err != nil {
+				return err
+			}
+			continue
+		}
+		content := file.Content
+		if file.Append {
+			existing, err := g.readFile(file.Name)
+			if err != nil {
+				return err
+			}
+			content = joinEntries(existing, content)
+		}
+		if err := g.writeFile(file.Name, content); err != nil {
 			return err
 		}
 	}
+	return nil
+}
 
+// writeFile writes content to fileName in the worktree and stages it
+func (g *GitService) writeFile(fileName, content string) error {
 	// Ensure the directory exists
 	dir := filepath.Dir(fileName)
 	if dir != "." && dir != "" {
@@ -147,45 +427,330 @@ func (g *GitService) CreateCommit(fileName, content, commitMessage string) error
 		return fmt.Errorf("failed to add file to index: %w", err)
 	}
 
-	// Create the commit
-	commitHash, err := g.worktree.Commit(commitMessage, &git.CommitOptions{
-		Author: &object.Signature{
-			Name:  g.username,
-			Email: g.userEmail,
-			When:  time.Now(),
-		},
-		Committer: &object.Signature{
-			Name:  g.username,
-			Email: g.userEmail,
-			When:  time.Now(),
-		},
-	})
+	return nil
+}
+
+// removeFile removes fileName from the worktree and the index, if it exists
+func (g *GitService) removeFile(fileName string) error {
+	if _, err := g.worktree.Filesystem.Stat(fileName); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if _, err := g.worktree.Remove(fileName); err != nil {
+		log.Error().Err(err).Str("filename", fileName).Msg("Failed to remove file")
+		return fmt.Errorf("failed to remove file %s: %w", fileName, err)
+	}
+	return nil
+}
+
+// readFile returns the content of fileName in the worktree, or an empty
+// string when it does not exist
+func (g *GitService) readFile(fileName string) (string, error) {
+	file, err := g.worktree.Filesystem.Open(fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to create commit")
-		return fmt.Errorf("failed to create commit: %w", err)
+		return "", fmt.Errorf("failed to open file %s: %w", fileName, err)
 	}
+	defer file.Close()
 
-	// Push the changes
-	err = g.repo.Push(&git.PushOptions{
-		Auth: g.auth,
-	})
+	content, err := io.ReadAll(file)
 	if err != nil {
-		log.Error().
+		return "", fmt.Errorf("failed to read file %s: %w", fileName, err)
+	}
+	return string(content), nil
+}
+
+// joinEntries appends an entry to the content of a file, separated by a blank line
+func joinEntries(existing, entry string) string {
+	if existing == "" {
+		return entry
+	}
+	if entry == "" {
+		return existing
+	}
+	return strings.TrimRight(existing, "\n") + "\n\n" + entry
+}
+
+// entryRecordFence opens the fenced YAML block holding the record of an
+// entry in files entries are appended to, where only front matter at the
+// top of the file would be parsed
+const entryRecordFence = "```yaml channelog\n"
+
+// fenceRecords moves the front matter of the entries in content into fenced
+// blocks. Front matter is recognized by the first field of a record, kind or
+// release, so the rule above the footer of an entry is left alone.
+func fenceRecords(content string) string {
+	lines := strings.SplitAfter(content, "\n")
+	var b strings.Builder
+	for i := 0; i < len(lines); i++ {
+		if lines[i] != "---\n" || i+1 == len(lines) || !isRecordStart(lines[i+1]) {
+			b.WriteString(lines[i])
+			continue
+		}
+		end := slices.Index(lines[i+1:], "---\n")
+		if end < 0 {
+			b.WriteString(lines[i])
+			continue
+		}
+		b.WriteString(entryRecordFence)
+		b.WriteString(strings.Join(lines[i+1:i+1+end], ""))
+		b.WriteString("```\n")
+		i += end + 1
+	}
+	return b.String()
+}
+
+// isRecordStart reports whether line is the first line of a changelog or
+// release record
+func isRecordStart(line string) bool {
+	return strings.HasPrefix(line, "kind: ") || strings.HasPrefix(line, "release: ")
+}
+
+// entryRecords returns the YAML records of the entries in a file: its front
+// matter and the fenced records of appended entries
+func entryRecords(content string) []string {
+	var records []string
+	if rest, ok := strings.CutPrefix(content, "---\n"); ok {
+		if end := strings.Index(rest, "\n---\n"); end >= 0 {
+			records = append(records, rest[:end+1])
+			content = rest[end+5:]
+		}
+	}
+	for _, block := range strings.Split("\n"+content, "\n"+entryRecordFence)[1:] {
+		if end := strings.Index(block, "\n```\n"); end >= 0 {
+			records = append(records, block[:end+1])
+		}
+	}
+	return records
+}
+
+// pushWithRetry pushes the local branch. When the remote rejects the push because
+// another writer got there first, it fetches the remote branch, replays the local
+// commits on top of it and tries again with exponential backoff. A PushRejectedError
+// is returned once maxPushRetries is exhausted.
+func (g *GitService) pushWithRetry() error {
+	backoff := g.pushRetryBackoff
+	for attempt := 1; ; attempt++ {
+		err := g.repo.Push(&git.PushOptions{
+			Auth: g.auth,
+		})
+		if err == nil || errors.Is(err, git.NoErrAlreadyUpToDate) {
+			return nil
+		}
+
+		if !isPushRejected(err) {
+			log.Error().
+				Err(err).
+				Str("branch", g.branch).
+				Msg("Failed to push commit")
+			return fmt.Errorf("failed to push commit: %w", err)
+		}
+
+		if attempt > g.maxPushRetries {
+			log.Error().
+				Err(err).
+				Str("branch", g.branch).
+				Int("attempts", attempt).
+				Msg("Push rejected, retries exhausted")
+			return &PushRejectedError{Branch: g.branch, Attempts: attempt, Err: err}
+		}
+
+		log.Warn().
 			Err(err).
 			Str("branch", g.branch).
-			Msg("Failed to push commit")
-		return fmt.Errorf("failed to push commit: %w", err)
+			Int("attempt", attempt).
+			Dur("backoff", backoff).
+			Msg("Push rejected, rebasing onto remote branch")
+
+		time.Sleep(backoff)
+		backoff = min(backoff*2, maxPushRetryBackoff)
+
+		if err := g.rebaseOnRemote(); err != nil {
+			log.Error().Err(err).Str("branch", g.branch).Msg("Failed to rebase onto remote branch")
+			return fmt.Errorf("failed to rebase onto remote branch: %w", err)
+		}
+	}
+}
+
+// rebaseOnRemote fetches the remote branch, hard-resets the local branch to it and
+// replays the commits that were not yet pushed on top, oldest first
+func (g *GitService) rebaseOnRemote() error {
+	remoteRefName := plumbing.NewRemoteReferenceName(git.DefaultRemoteName, g.branch)
+
+	// The remote-tracking ref still points at the last state we were in sync with
+	base, err := g.repo.Reference(remoteRefName, true)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", remoteRefName, err)
+	}
+
+	head, err := g.repo.Head()
+	if err != nil {
+		return fmt.Errorf("failed to resolve HEAD: %w", err)
+	}
+
+	pending, err := g.commitsSince(head.Hash(), base.Hash())
+	if err != nil {
+		return err
+	}
+
+	err = g.repo.Fetch(&git.FetchOptions{
+		RemoteName: git.DefaultRemoteName,
+		RefSpecs: []config.RefSpec{
+			config.RefSpec(fmt.Sprintf("+%s:%s", plumbing.NewBranchReferenceName(g.branch), remoteRefName)),
+		},
+		Auth: g.auth,
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return fmt.Errorf("failed to fetch remote branch: %w", err)
+	}
+
+	remote, err := g.repo.Reference(remoteRefName, true)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", remoteRefName, err)
+	}
+
+	if err := g.worktree.Reset(&git.ResetOptions{Commit: remote.Hash(), Mode: git.HardReset}); err != nil {
+		return fmt.Errorf("failed to reset to remote branch: %w", err)
+	}
+
+	for i := len(pending) - 1; i >= 0; i-- {
+		if err := g.replayCommit(pending[i]); err != nil {
+			return err
+		}
 	}
 
 	log.Info().
-		Str("filename", fileName).
-		Str("commit_message", commitMessage).
-		Str("commit_hash", commitHash.String()[:8]).
-		Msg("Successfully created and pushed commit")
+		Str("branch", g.branch).
+		Str("remote_head", remote.Hash().String()[:8]).
+		Int("replayed", len(pending)).
+		Msg("Rebased local commits onto remote branch")
 
 	return nil
 }
 
+// commitsSince returns the first-parent commits reachable from head but not from base,
+// newest first
+func (g *GitService) commitsSince(head, base plumbing.Hash) ([]*object.Commit, error) {
+	var commits []*object.Commit
+	for hash := head; hash != base; {
+		c, err := g.repo.CommitObject(hash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read commit %s: %w", hash, err)
+		}
+		commits = append(commits, c)
+		if c.NumParents() == 0 {
+			return nil, fmt.Errorf("commit %s is not based on %s", head, base)
+		}
+		hash = c.ParentHashes[0]
+	}
+	return commits, nil
+}
+
+// replayCommit re-applies the file changes of c on the current worktree and commits
+// them with the original message and author. Files c appended to get the
+// appended text added to their remote version; all others are written as c
+// left them.
+func (g *GitService) replayCommit(c *object.Commit) error {
+	tree, err := c.Tree()
+	if err != nil {
+		return fmt.Errorf("failed to read tree of %s: %w", c.Hash, err)
+	}
+
+	parent, err := c.Parent(0)
+	if err != nil {
+		return fmt.Errorf("failed to read parent of %s: %w", c.Hash, err)
+	}
+	parentTree, err := parent.Tree()
+	if err != nil {
+		return fmt.Errorf("failed to read tree of %s: %w", parent.Hash, err)
+	}
+
+	changes, err := object.DiffTree(parentTree, tree)
+	if err != nil {
+		return fmt.Errorf("failed to diff %s: %w", c.Hash, err)
+	}
+
+	appended := g.appended[c.Hash]
+	for _, change := range changes {
+		if change.To.Name == "" {
+			// The remote may have removed the file already
+			if err := g.removeFile(change.From.Name); err != nil {
+				return err
+			}
+			continue
+		}
+
+		content, err := fileContents(tree, change.To.Name)
+		if err != nil {
+			return err
+		}
+
+		// A commit that appended to a file appends the same text to the
+		// remote version, which may have grown meanwhile
+		if change.From.Name != "" && slices.Contains(appended, change.To.Name) {
+			previous, err := fileContents(parentTree, change.From.Name)
+			if err != nil {
+				return err
+			}
+			if appended, ok := strings.CutPrefix(content, previous); ok && previous != "" {
+				current, err := g.readFile(change.To.Name)
+				if err != nil {
+					return err
+				}
+				content = current + appended
+			}
+		}
+
+		if err := g.writeFile(change.To.Name, content); err != nil {
+			return err
+		}
+	}
+
+	replayed, err := g.worktree.Commit(c.Message, &git.CommitOptions{
+		Author: &c.Author,
+		Committer: &object.Signature{
+			Name:  c.Committer.Name,
+			Email: c.Committer.Email,
+			When:  time.Now(),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to replay commit %s: %w", c.Hash, err)
+	}
+
+	// The next rejected push replays the replayed commit
+	delete(g.appended, c.Hash)
+	g.rememberAppends(replayed, appended)
+	return nil
+}
+
+// fileContents reads a file of a tree
+func fileContents(tree *object.Tree, name string) (string, error) {
+	file, err := tree.File(name)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	content, err := file.Contents()
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	return content, nil
+}
+
+// isPushRejected reports whether err means the remote branch moved ahead of ours
+func isPushRejected(err error) bool {
+	if errors.Is(err, plumbing.ErrObjectNotFound) || errors.Is(err, git.ErrNonFastForwardUpdate) {
+		// The remote head is a commit our clone has never seen, or one we
+		// cannot fast-forward from
+		return true
+	}
+	// go-git has no sentinel for its own fast-forward check before a push
+	// nor for the status reported by the server, which are plain errors
+	msg := err.Error()
+	return strings.Contains(msg, "non-fast-forward") || strings.Contains(msg, "fetch first")
+}
+
 // GenerateFileName generates a filename for the changelog entry
 // Layout structure:
 // - Cluster-scoped: __cluster-scope__/{kind}/{name}_{timestamp}.yaml
@@ -221,3 +786,82 @@ func (g *GitService) GenerateFileName(namespace, name, kind string) string {
 	// (k8s namespace names cannot contain underscores)
 	return filepath.Join(ClusterScopeFolder, strings.ToLower(kind), fileName)
 }
+
+// GenerateReleaseFileName generates a filename for the entry of a release
+// Layout structure: {namespace}/__releases__/{release}_{timestamp}.yaml
+func (g *GitService) GenerateReleaseFileName(namespace, release string) string {
+	return g.GenerateFileName(namespace, release, ReleaseFolder)
+}
+
+// GenerateResourceFileName generates the stable filename of a resource in
+// the resource layout. The core group is written as core.
+// Layout structure:
+// - Cluster-scoped: __cluster-scope__/{group}/{kind}/{name}.md
+// - Namespace-scoped: {namespace}/{group}/{kind}/{name}.md
+func (g *GitService) GenerateResourceFileName(namespace, group, kind, name string) string {
+	if group == "" {
+		group = CoreGroupFolder
+	}
+	return filepath.Join(scopeFolder(namespace), safePathSegment(group), strings.ToLower(kind), safePathSegment(name)+".md")
+}
+
+// GenerateReleaseResourceFileName generates the stable filename of a release
+// in the resource layout: {namespace}/__releases__/{release}.md
+func (g *GitService) GenerateReleaseResourceFileName(namespace, release string) string {
+	return filepath.Join(scopeFolder(namespace), ReleaseFolder, safePathSegment(release)+".md")
+}
+
+// GenerateManifestFileName generates the filename of the manifest of a
+// resource, which is the same in both layouts. The core group is written as
+// core.
+// Layout structure:
+// - Cluster-scoped: __cluster-scope__/{group}/{kind}/{name}.yaml
+// - Namespace-scoped: {namespace}/{group}/{kind}/{name}.yaml
+func (g *GitService) GenerateManifestFileName(namespace, group, kind, name string) string {
+	if group == "" {
+		group = CoreGroupFolder
+	}
+	return filepath.Join(scopeFolder(namespace), safePathSegment(group), strings.ToLower(kind), safePathSegment(name)+".yaml")
+}
+
+// EntryFile returns the file the entry of a resource is written to in the
+// configured layout
+func (g *GitService) EntryFile(namespace, group, kind, name, content string) CommitFile {
+	if g.layout != channelconfig.LayoutResource {
+		return CommitFile{Name: g.GenerateFileName(namespace, name, kind), Content: content}
+	}
+	return g.resourceFile(g.GenerateResourceFileName(namespace, group, kind, name), content)
+}
+
+// ReleaseFile returns the file the entry of a release is written to in the
+// configured layout
+func (g *GitService) ReleaseFile(namespace, release, content string) CommitFile {
+	if g.layout != channelconfig.LayoutResource {
+		return CommitFile{Name: g.GenerateReleaseFileName(namespace, release), Content: content}
+	}
+	return g.resourceFile(g.GenerateReleaseResourceFileName(namespace, release), content)
+}
+
+// resourceFile returns the file of a resource or release in the resource
+// layout. In append mode the record of the entry goes in a fenced block
+// rather than front matter, so that the records of all entries parse.
+func (g *GitService) resourceFile(name, content string) CommitFile {
+	if g.resourceFileMode != channelconfig.ResourceFileAppend {
+		return CommitFile{Name: name, Content: content}
+	}
+	return CommitFile{Name: name, Content: fenceRecords(content), Append: true}
+}
+
+// scopeFolder returns the folder of a namespace, or ClusterScopeFolder
+func scopeFolder(namespace string) string {
+	if namespace == "" {
+		return ClusterScopeFolder
+	}
+	return safePathSegment(namespace)
+}
+
+// safePathSegment makes a name usable as a single path segment
+func safePathSegment(name string) string {
+	name = strings.ReplaceAll(name, "/", "_")
+	return strings.ReplaceAll(name, ":", "_")
+}
@@ -0,0 +1,347 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	channelconfig "channelog/config"
+)
+
+const testBranch = "main"
+
+// newTestRemote creates a bare repository with one commit holding files
+func newTestRemote(t *testing.T, files map[string]string) string {
+	t.Helper()
+	remote := filepath.Join(t.TempDir(), "remote.git")
+	if _, err := git.PlainInit(remote, true); err != nil {
+		t.Fatalf("failed to create bare repository: %v", err)
+	}
+
+	seed, err := git.PlainInit(t.TempDir(), false)
+	if err != nil {
+		t.Fatalf("failed to create seed repository: %v", err)
+	}
+	if _, err := seed.CreateRemote(&config.RemoteConfig{Name: git.DefaultRemoteName, URLs: []string{remote}}); err != nil {
+		t.Fatalf("failed to add remote: %v", err)
+	}
+	worktree, err := seed.Worktree()
+	if err != nil {
+		t.Fatalf("failed to get worktree: %v", err)
+	}
+	for name, content := range files {
+		writeTestFile(t, worktree, name, content)
+	}
+	commitTestChange(t, worktree, "Seed")
+	head, err := seed.Head()
+	if err != nil {
+		t.Fatalf("failed to resolve HEAD: %v", err)
+	}
+	err = seed.Push(&git.PushOptions{RefSpecs: []config.RefSpec{
+		config.RefSpec(head.Name().String() + ":" + plumbing.NewBranchReferenceName(testBranch).String()),
+	}})
+	if err != nil {
+		t.Fatalf("failed to push seed commit: %v", err)
+	}
+	return remote
+}
+
+// cloneTestRemote clones the remote to disk, as another writer would
+func cloneTestRemote(t *testing.T, remote string) (*git.Repository, *git.Worktree) {
+	t.Helper()
+	repo, err := git.PlainClone(t.TempDir(), false, &git.CloneOptions{
+		URL:           remote,
+		ReferenceName: plumbing.NewBranchReferenceName(testBranch),
+		SingleBranch:  true,
+	})
+	if err != nil {
+		t.Fatalf("failed to clone remote: %v", err)
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("failed to get worktree: %v", err)
+	}
+	return repo, worktree
+}
+
+// pushCompetingCommit commits a change from another clone, so that the next
+// push of the service is rejected
+func pushCompetingCommit(t *testing.T, remote string, change func(*git.Worktree)) {
+	t.Helper()
+	repo, worktree := cloneTestRemote(t, remote)
+	change(worktree)
+	commitTestChange(t, worktree, "Competing change")
+	if err := repo.Push(&git.PushOptions{}); err != nil {
+		t.Fatalf("failed to push competing commit: %v", err)
+	}
+}
+
+func writeTestFile(t *testing.T, worktree *git.Worktree, name, content string) {
+	t.Helper()
+	path := filepath.Join(worktree.Filesystem.Root(), name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write %s: %v", name, err)
+	}
+	if _, err := worktree.Add(name); err != nil {
+		t.Fatalf("failed to stage %s: %v", name, err)
+	}
+}
+
+func commitTestChange(t *testing.T, worktree *git.Worktree, message string) {
+	t.Helper()
+	_, err := worktree.Commit(message, &git.CommitOptions{
+		Author: &object.Signature{Name: "other", Email: "other@example.com", When: time.Now()},
+	})
+	if err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+}
+
+// newTestGitService returns a GitService cloned from remote, without its
+// writer goroutine, so that tests can call its steps in order
+func newTestGitService(t *testing.T, remote string, maxPushRetries int) *GitService {
+	t.Helper()
+	g := &GitService{
+		repoURL:          remote,
+		branch:           testBranch,
+		username:         "channelog",
+		userEmail:        "channelog@example.com",
+		maxPushRetries:   maxPushRetries,
+		pushRetryBackoff: time.Millisecond,
+		layout:           channelconfig.LayoutResource,
+		resourceFileMode: channelconfig.ResourceFileAppend,
+	}
+	if err := g.InitializeRepo(); err != nil {
+		t.Fatalf("failed to clone remote: %v", err)
+	}
+	return g
+}
+
+// commitLocally makes an unpushed commit of files, as commit does before pushing
+func commitLocally(t *testing.T, g *GitService, files []CommitFile, message string) {
+	t.Helper()
+	author := &object.Signature{Name: g.username, Email: g.userEmail, When: time.Now()}
+	if _, err := g.commitFiles(files, message, author); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+}
+
+// remoteHead returns the head commit of the remote branch and the content of
+// name in it, or an empty string when name does not exist
+func remoteHead(t *testing.T, remote, name string) (*object.Commit, string) {
+	t.Helper()
+	repo, err := git.PlainOpen(remote)
+	if err != nil {
+		t.Fatalf("failed to open remote: %v", err)
+	}
+	ref, err := repo.Reference(plumbing.NewBranchReferenceName(testBranch), true)
+	if err != nil {
+		t.Fatalf("failed to resolve remote branch: %v", err)
+	}
+	head, err := repo.CommitObject(ref.Hash())
+	if err != nil {
+		t.Fatalf("failed to read remote head: %v", err)
+	}
+	file, err := head.File(name)
+	if errors.Is(err, object.ErrFileNotFound) {
+		return head, ""
+	}
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", name, err)
+	}
+	content, err := file.Contents()
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", name, err)
+	}
+	return head, content
+}
+
+func TestPushWithRetryReplaysAppendedEntries(t *testing.T) {
+	const history = "prod/apps/deployment/web.md"
+	remote := newTestRemote(t, map[string]string{history: "first\n"})
+	g := newTestGitService(t, remote, 3)
+
+	pushCompetingCommit(t, remote, func(worktree *git.Worktree) {
+		writeTestFile(t, worktree, history, "first\n\nsecond\n")
+	})
+	commitLocally(t, g, []CommitFile{{Name: history, Content: "third\n", Append: true}}, "Add changelog for Deployment/web")
+
+	if err := g.pushWithRetry(); err != nil {
+		t.Fatalf("pushWithRetry() = %v, want nil", err)
+	}
+
+	head, content := remoteHead(t, remote, history)
+	if head.Message != "Add changelog for Deployment/web" {
+		t.Errorf("remote head message = %q, want the replayed commit", head.Message)
+	}
+	if head.Author.Email != "channelog@example.com" {
+		t.Errorf("remote head author = %q, want the original author", head.Author.Email)
+	}
+	parent, err := head.Parent(0)
+	if err != nil {
+		t.Fatalf("failed to read parent: %v", err)
+	}
+	if parent.Message != "Competing change" {
+		t.Errorf("parent message = %q, want the competing commit", parent.Message)
+	}
+	if want := "first\n\nsecond\n\nthird\n"; content != want {
+		t.Errorf("merged history = %q, want %q", content, want)
+	}
+}
+
+func TestPushWithRetryReplaysRemovalOfRemovedFile(t *testing.T) {
+	const old = "prod/deployment/web_Mon,_02_Jan_2006_15-04-05_IST.yaml"
+	remote := newTestRemote(t, map[string]string{old: "entry\n", "README.md": "changelog\n"})
+	g := newTestGitService(t, remote, 3)
+
+	pushCompetingCommit(t, remote, func(worktree *git.Worktree) {
+		if _, err := worktree.Remove(old); err != nil {
+			t.Fatalf("failed to remove %s: %v", old, err)
+		}
+	})
+	commitLocally(t, g, []CommitFile{
+		{Name: old, Delete: true},
+		{Name: "prod/apps/deployment/web.md", Content: "entry\n"},
+	}, "Migrate changelog to the resource layout")
+
+	if err := g.pushWithRetry(); err != nil {
+		t.Fatalf("pushWithRetry() = %v, want nil", err)
+	}
+	if _, content := remoteHead(t, remote, "prod/apps/deployment/web.md"); content != "entry\n" {
+		t.Errorf("migrated file = %q, want %q", content, "entry\n")
+	}
+}
+
+func TestPushWithRetryReplaysRewrittenManifest(t *testing.T) {
+	const manifest = "prod/apps/deployment/web.yaml"
+	remote := newTestRemote(t, map[string]string{manifest: "spec:\n    replicas: 2\n"})
+	g := newTestGitService(t, remote, 3)
+
+	pushCompetingCommit(t, remote, func(worktree *git.Worktree) {
+		writeTestFile(t, worktree, manifest, "spec:\n    replicas: 5\n")
+	})
+	// The new manifest starts with the old one but replaces the file
+	local := "spec:\n    replicas: 2\nstatus:\n    ready: true\n"
+	commitLocally(t, g, []CommitFile{{Name: manifest, Content: local}}, "Add changelog for Deployment/web")
+
+	if err := g.pushWithRetry(); err != nil {
+		t.Fatalf("pushWithRetry() = %v, want nil", err)
+	}
+	if _, content := remoteHead(t, remote, manifest); content != local {
+		t.Errorf("manifest = %q, want the replayed manifest %q", content, local)
+	}
+}
+
+func TestPushWithRetryReplaysAppendsAcrossRetries(t *testing.T) {
+	const history = "prod/apps/deployment/web.md"
+	remote := newTestRemote(t, map[string]string{history: "first\n"})
+	g := newTestGitService(t, remote, 3)
+
+	commitLocally(t, g, []CommitFile{{Name: history, Content: "third\n", Append: true}}, "Add changelog for Deployment/web")
+	for _, entry := range []string{"second\n", "fourth\n"} {
+		pushCompetingCommit(t, remote, func(worktree *git.Worktree) {
+			_, current := remoteHead(t, remote, history)
+			writeTestFile(t, worktree, history, joinEntries(current, entry))
+		})
+		// Replay onto the first competing commit only, so that the push
+		// is rejected again and the replayed commit is replayed once more
+		if err := g.rebaseOnRemote(); err != nil {
+			t.Fatalf("rebaseOnRemote() = %v, want nil", err)
+		}
+	}
+	pushCompetingCommit(t, remote, func(worktree *git.Worktree) {
+		writeTestFile(t, worktree, "other.md", "other\n")
+	})
+
+	if err := g.pushWithRetry(); err != nil {
+		t.Fatalf("pushWithRetry() = %v, want nil", err)
+	}
+	if _, content := remoteHead(t, remote, history); content != "first\n\nsecond\n\nfourth\n\nthird\n" {
+		t.Errorf("merged history = %q, want every entry once", content)
+	}
+}
+
+func TestPushWithRetryReturnsPushRejectedError(t *testing.T) {
+	remote := newTestRemote(t, map[string]string{"README.md": "changelog\n"})
+	g := newTestGitService(t, remote, 0)
+
+	pushCompetingCommit(t, remote, func(worktree *git.Worktree) {
+		writeTestFile(t, worktree, "other.md", "other\n")
+	})
+	commitLocally(t, g, []CommitFile{{Name: "mine.md", Content: "mine\n"}}, "Add changelog")
+
+	err := g.pushWithRetry()
+	var rejected *PushRejectedError
+	if !errors.As(err, &rejected) {
+		t.Fatalf("pushWithRetry() = %v, want a PushRejectedError", err)
+	}
+	if rejected.Branch != testBranch || rejected.Attempts != 1 {
+		t.Errorf("PushRejectedError = %+v, want branch %s after 1 attempt", rejected, testBranch)
+	}
+	if head, _ := remoteHead(t, remote, "mine.md"); head.Message != "Competing change" {
+		t.Errorf("remote head message = %q, want the competing commit to stay", head.Message)
+	}
+}
+
+func TestCreateCommitSyncsWithRemote(t *testing.T) {
+	const history = "prod/apps/deployment/web.md"
+	remote := newTestRemote(t, map[string]string{history: "first\n"})
+	g := NewGitService(&channelconfig.Config{
+		GitRepo:             remote,
+		GitBranch:           testBranch,
+		Username:            "channelog",
+		UserEmail:           "channelog@example.com",
+		GitPushMaxRetries:   3,
+		GitPushRetryBackoff: time.Millisecond,
+		ChangelogLayout:     channelconfig.LayoutResource,
+		ResourceFileMode:    channelconfig.ResourceFileAppend,
+	})
+	defer g.Stop()
+
+	if err := g.CreateCommit(history, "second\n", "First", nil); err != nil {
+		t.Fatalf("CreateCommit() = %v, want nil", err)
+	}
+	// Another writer pushes between the commits of the service
+	pushCompetingCommit(t, remote, func(worktree *git.Worktree) {
+		writeTestFile(t, worktree, "other.md", "other\n")
+	})
+	file := g.EntryFile("prod", "apps", "Deployment", "web", "third\n")
+	if err := g.CreateCommitFiles([]CommitFile{file}, "Second", nil); err != nil {
+		t.Fatalf("CreateCommitFiles() = %v, want nil", err)
+	}
+
+	head, content := remoteHead(t, remote, history)
+	if head.Message != "Second" {
+		t.Errorf("remote head message = %q, want %q", head.Message, "Second")
+	}
+	if want := "second\n\nthird\n"; content != want {
+		t.Errorf("history = %q, want %q", content, want)
+	}
+}
+
+func TestGenerateManifestFileName(t *testing.T) {
+	g := &GitService{}
+	tests := []struct {
+		namespace, group, kind, name string
+		want                         string
+	}{
+		{"prod", "apps", "Deployment", "web", "prod/apps/deployment/web.yaml"},
+		{"prod", "", "ConfigMap", "settings", "prod/core/configmap/settings.yaml"},
+		{"", "rbac.authorization.k8s.io", "ClusterRole", "system:admin", "__cluster-scope__/rbac.authorization.k8s.io/clusterrole/system_admin.yaml"},
+	}
+	for _, tt := range tests {
+		if got := g.GenerateManifestFileName(tt.namespace, tt.group, tt.kind, tt.name); got != tt.want {
+			t.Errorf("GenerateManifestFileName(%q, %q, %q, %q) = %q, want %q", tt.namespace, tt.group, tt.kind, tt.name, got, tt.want)
+		}
+	}
+}
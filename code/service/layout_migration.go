@@ -0,0 +1,204 @@
+package service
+
+import (
+	"fmt"
+	"maps"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+
+	channelconfig "channelog/config"
+	"channelog/helpers"
+)
+
+// timestampedFile matches the files of the timestamped layout, e.g.
+// web_Mon,_02_Jan_2006_15-04-05_IST.yaml
+var timestampedFile = regexp.MustCompile(`^(.+)_([A-Z][a-z]{2},_\d{2}_[A-Z][a-z]{2}_\d{4}_\d{2}-\d{2}-\d{2}_[^_]+)\.yaml$`)
+
+// MigrationResult describes what MigrateLayout changed
+type MigrationResult struct {
+	// Migrated is the number of timestamped files moved
+	Migrated int
+
+	// Resources is the number of resource files they were moved to
+	Resources int
+
+	// Skipped are the files left in place because the API group of their
+	// kind is unknown
+	Skipped []string
+}
+
+// migrationSource is a timestamped file moved to a resource file
+type migrationSource struct {
+	name    string
+	content string
+	time    time.Time
+}
+
+// MigrateLayout moves the entries of a repository in the timestamped layout
+// to the resource layout in one commit. The entries of a resource are joined
+// oldest first in append mode, with their records fenced; in rewrite mode
+// only the latest is kept.
+// Entries already in a resource file are newer than any timestamped file and
+// stay at its end. The API group comes from the front matter of an entry or,
+// for entries written before it existed, from the built-in kinds; files of
+// other kinds are skipped.
+func (g *GitService) MigrateLayout() (*MigrationResult, error) {
+	var result *MigrationResult
+	err := g.send(commitRequest{
+		result: make(chan error, 1),
+		do: func() error {
+			var err error
+			result, err = g.migrateLayout()
+			return err
+		},
+	})
+	return result, err
+}
+
+// migrateLayout implements MigrateLayout. It must only be called from run.
+func (g *GitService) migrateLayout() (*MigrationResult, error) {
+	if err := g.syncRepo(); err != nil {
+		return nil, err
+	}
+
+	result := &MigrationResult{}
+	sources := make(map[string][]migrationSource)
+	scopes, err := g.worktree.Filesystem.ReadDir("")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list repository: %w", err)
+	}
+	for _, scope := range scopes {
+		if !scope.IsDir() || strings.HasPrefix(scope.Name(), ".") {
+			continue
+		}
+		namespace := scope.Name()
+		if namespace == ClusterScopeFolder {
+			namespace = ""
+		}
+
+		kinds, err := g.worktree.Filesystem.ReadDir(scope.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", scope.Name(), err)
+		}
+		for _, kind := range kinds {
+			if !kind.IsDir() {
+				continue
+			}
+			dir := path.Join(scope.Name(), kind.Name())
+			files, err := g.worktree.Filesystem.ReadDir(dir)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list %s: %w", dir, err)
+			}
+			for _, file := range files {
+				match := timestampedFile.FindStringSubmatch(file.Name())
+				if file.IsDir() || match == nil {
+					continue
+				}
+				name := path.Join(dir, file.Name())
+				content, err := g.readFile(name)
+				if err != nil {
+					return nil, err
+				}
+
+				var target string
+				if kind.Name() == ReleaseFolder {
+					target = g.GenerateReleaseResourceFileName(namespace, match[1])
+				} else {
+					group, ok := entryGroup(content, kind.Name())
+					if !ok {
+						result.Skipped = append(result.Skipped, name)
+						continue
+					}
+					target = g.GenerateResourceFileName(namespace, group, kind.Name(), match[1])
+				}
+				sources[target] = append(sources[target], migrationSource{
+					name:    name,
+					content: content,
+					time:    parseFileTimestamp(match[2]),
+				})
+			}
+		}
+	}
+
+	if len(sources) == 0 {
+		return result, nil
+	}
+
+	var files []CommitFile
+	for _, target := range slices.Sorted(maps.Keys(sources)) {
+		entries := sources[target]
+		slices.SortStableFunc(entries, func(a, b migrationSource) int {
+			if c := a.time.Compare(b.time); c != 0 {
+				return c
+			}
+			return strings.Compare(a.name, b.name)
+		})
+
+		existing, err := g.readFile(target)
+		if err != nil {
+			return nil, err
+		}
+		content := existing
+		if g.resourceFileMode == channelconfig.ResourceFileAppend {
+			content = ""
+			for _, entry := range entries {
+				content = joinEntries(content, entry.content)
+			}
+			content = fenceRecords(joinEntries(content, existing))
+		} else if content == "" {
+			content = entries[len(entries)-1].content
+		}
+
+		files = append(files, CommitFile{Name: target, Content: content})
+		for _, entry := range entries {
+			files = append(files, CommitFile{Name: entry.name, Delete: true})
+		}
+		result.Migrated += len(entries)
+		result.Resources++
+	}
+
+	message := fmt.Sprintf("Migrate changelog to the resource layout\n\nMoved %d timestamped files into %d resource files.\n", result.Migrated, result.Resources)
+	if err := g.commit(files, message, nil); err != nil {
+		return nil, err
+	}
+
+	log.Info().
+		Int("migrated", result.Migrated).
+		Int("resources", result.Resources).
+		Int("skipped", len(result.Skipped)).
+		Msg("Migrated changelog repository to the resource layout")
+	return result, nil
+}
+
+// entryGroup returns the API group of an entry from its record, or from the
+// built-in kinds when it has none
+func entryGroup(content, kind string) (string, bool) {
+	for _, data := range entryRecords(content) {
+		var record struct {
+			Kind  string `yaml:"kind"`
+			Group string `yaml:"group"`
+		}
+		if yaml.Unmarshal([]byte(data), &record) == nil && record.Kind != "" {
+			return record.Group, true
+		}
+	}
+	return helpers.GroupOfKind(kind)
+}
+
+// parseFileTimestamp parses the timestamp of a timestamped file name, in
+// which spaces became underscores and colons dashes; a timestamp that does
+// not parse yields the zero time
+func parseFileTimestamp(timestamp string) time.Time {
+	fields := strings.Split(timestamp, "_")
+	if len(fields) == 6 {
+		fields[4] = strings.ReplaceAll(fields[4], "-", ":")
+	}
+	t, _ := time.Parse(time.RFC1123, strings.Join(fields, " "))
+	return t
+}
@@ -0,0 +1,220 @@
+package service
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	admissionv1 "k8s.io/api/admission/v1"
+
+	channelconfig "channelog/config"
+	"channelog/models"
+)
+
+// testEntry renders an entry of Deployment prod/web in group with its front
+// matter and footer, as formatChangelogContent does
+func testEntry(t *testing.T, group, summary string) string {
+	t.Helper()
+	review := testReview(t, admissionv1.Update, configMap("one"), configMap("two"))
+	review.Request.Kind.Group, review.Request.Kind.Kind, review.Request.Name = group, "Deployment", "web"
+	return formatFrontMatter(review, &models.Entry{Summary: summary}, time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)) +
+		"# Changelog Entry\n\n## Change Summary\n\n" + summary + "\n\n---\n*Generated automatically by Channelog*\n"
+}
+
+// recordSummaries returns the summaries of the records in content
+func recordSummaries(t *testing.T, content string) []string {
+	t.Helper()
+	var summaries []string
+	for _, data := range entryRecords(content) {
+		var record changelogRecord
+		if err := yaml.Unmarshal([]byte(data), &record); err != nil {
+			t.Fatalf("failed to parse record %q: %v", data, err)
+		}
+		summaries = append(summaries, record.Summary)
+	}
+	return summaries
+}
+
+func TestFenceRecords(t *testing.T) {
+	entry := testEntry(t, "apps", "Scaled web.")
+	fenced := fenceRecords(entry)
+	if !strings.HasPrefix(fenced, entryRecordFence+"kind: Deployment\n") {
+		t.Errorf("fenceRecords() = %q, want the record in a fenced block", fenced)
+	}
+	if !strings.HasSuffix(fenced, "Scaled web.\n\n---\n*Generated automatically by Channelog*\n") {
+		t.Errorf("fenceRecords() = %q, want the footer rule left alone", fenced)
+	}
+	if again := fenceRecords(fenced); again != fenced {
+		t.Errorf("fenceRecords() of fenced content = %q, want it unchanged", again)
+	}
+
+	// Entries appended with front matter before records were fenced are fenced too
+	joined := joinEntries(entry, testEntry(t, "apps", "Rolled back web."))
+	if got := fenceRecords(joined); strings.Count(got, entryRecordFence) != 2 || strings.Contains(got, "---\nkind:") {
+		t.Errorf("fenceRecords() = %q, want both records fenced", got)
+	}
+
+	release := "---\nrelease: Helm release prod/web\nsource: Helm release\n---\n\n# Release Changelog Entry\n"
+	if got := fenceRecords(release); !strings.HasPrefix(got, entryRecordFence+"release: ") {
+		t.Errorf("fenceRecords() = %q, want the release record fenced", got)
+	}
+}
+
+func TestEntryRecords(t *testing.T) {
+	first, second := testEntry(t, "apps", "Scaled web."), testEntry(t, "apps", "Rolled back web.")
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{name: "front matter", content: first, want: []string{"Scaled web."}},
+		{name: "fenced", content: fenceRecords(first), want: []string{"Scaled web."}},
+		{
+			name:    "appended",
+			content: joinEntries(fenceRecords(first), fenceRecords(second)),
+			want:    []string{"Scaled web.", "Rolled back web."},
+		},
+		{
+			name:    "front matter then fenced",
+			content: joinEntries(first, fenceRecords(second)),
+			want:    []string{"Scaled web.", "Rolled back web."},
+		},
+		{name: "no record", content: "# Changelog Entry\n\n---\n*Generated automatically by Channelog*\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := recordSummaries(t, tt.content); !slices.Equal(got, tt.want) {
+				t.Errorf("entryRecords() summaries = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEntryGroup(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		kind    string
+		want    string
+		wantOK  bool
+	}{
+		{name: "front matter", content: testEntry(t, "example.com", "Scaled web."), kind: "deployment", want: "example.com", wantOK: true},
+		{name: "fenced record", content: fenceRecords(testEntry(t, "example.com", "Scaled web.")), kind: "deployment", want: "example.com", wantOK: true},
+		{name: "built-in kind", content: "# Changelog Entry\n", kind: "deployment", want: "apps", wantOK: true},
+		{name: "core kind", content: "# Changelog Entry\n", kind: "configmap", want: "", wantOK: true},
+		{name: "unknown kind", content: "# Changelog Entry\n", kind: "widget"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := entryGroup(tt.content, tt.kind)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("entryGroup() = %q, %v, want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestParseFileTimestamp(t *testing.T) {
+	want := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+	if got := parseFileTimestamp("Mon,_02_Jan_2006_15-04-05_UTC"); !got.Equal(want) {
+		t.Errorf("parseFileTimestamp() = %v, want %v", got, want)
+	}
+	if got := parseFileTimestamp("yesterday"); !got.IsZero() {
+		t.Errorf("parseFileTimestamp() = %v, want the zero time", got)
+	}
+}
+
+func TestEntryFileAppendsFencedRecords(t *testing.T) {
+	const history = "prod/apps/deployment/web.md"
+	g := newTestGitService(t, newTestRemote(t, map[string]string{"README.md": "changelog\n"}), 0)
+
+	for _, summary := range []string{"Scaled web.", "Rolled back web."} {
+		file := g.EntryFile("prod", "apps", "Deployment", "web", testEntry(t, "apps", summary))
+		if file.Name != history || !file.Append {
+			t.Fatalf("EntryFile() = %+v, want an append to %s", file, history)
+		}
+		commitLocally(t, g, []CommitFile{file}, summary)
+	}
+	content, err := g.readFile(history)
+	if err != nil {
+		t.Fatalf("readFile() error = %v", err)
+	}
+	if got, want := recordSummaries(t, content), []string{"Scaled web.", "Rolled back web."}; !slices.Equal(got, want) {
+		t.Errorf("record summaries = %q, want %q", got, want)
+	}
+
+	// In rewrite mode the file holds one entry, with front matter
+	g.resourceFileMode = channelconfig.ResourceFileRewrite
+	entry := testEntry(t, "apps", "Scaled web.")
+	if file := g.EntryFile("prod", "apps", "Deployment", "web", entry); file.Append || file.Content != entry {
+		t.Errorf("EntryFile() = %+v, want the entry to replace the file", file)
+	}
+}
+
+func TestMigrateLayout(t *testing.T) {
+	const (
+		history = "prod/apps/deployment/web.md"
+		older   = "prod/deployment/web_Mon,_02_Jan_2006_15-04-05_UTC.yaml"
+		newer   = "prod/deployment/web_Tue,_03_Jan_2006_15-04-05_UTC.yaml"
+		legacy  = "prod/configmap/settings_Mon,_02_Jan_2006_15-04-05_UTC.yaml"
+		unknown = "prod/widget/thing_Mon,_02_Jan_2006_15-04-05_UTC.yaml"
+	)
+	seed := func() map[string]string {
+		return map[string]string{
+			newer:   testEntry(t, "apps", "Rolled back web."),
+			older:   testEntry(t, "apps", "Scaled web."),
+			legacy:  "# Changelog Entry\n\nChanged settings.\n",
+			unknown: "# Changelog Entry\n\nChanged thing.\n",
+		}
+	}
+
+	t.Run("append", func(t *testing.T) {
+		files := seed()
+		files[history] = fenceRecords(testEntry(t, "apps", "Restarted web."))
+		remote := newTestRemote(t, files)
+		g := newTestGitService(t, remote, 0)
+
+		result, err := g.migrateLayout()
+		if err != nil {
+			t.Fatalf("migrateLayout() error = %v", err)
+		}
+		if result.Migrated != 3 || result.Resources != 2 || !slices.Equal(result.Skipped, []string{unknown}) {
+			t.Errorf("migrateLayout() = %+v, want 3 files in 2 resources and %s skipped", result, unknown)
+		}
+
+		_, content := remoteHead(t, remote, history)
+		want := []string{"Scaled web.", "Rolled back web.", "Restarted web."}
+		if got := recordSummaries(t, content); !slices.Equal(got, want) {
+			t.Errorf("record summaries = %q, want %q", got, want)
+		}
+		if _, content := remoteHead(t, remote, "prod/core/configmap/settings.md"); content != files[legacy] {
+			t.Errorf("settings = %q, want %q", content, files[legacy])
+		}
+		for name, wantGone := range map[string]bool{older: true, newer: true, legacy: true, unknown: false} {
+			if _, content := remoteHead(t, remote, name); (content == "") != wantGone {
+				t.Errorf("%s removed = %v, want %v", name, content == "", wantGone)
+			}
+		}
+
+		// Nothing is left to migrate
+		if result, err := g.migrateLayout(); err != nil || result.Migrated != 0 {
+			t.Errorf("second migrateLayout() = %+v, %v, want nothing migrated", result, err)
+		}
+	})
+
+	t.Run("rewrite", func(t *testing.T) {
+		files := seed()
+		remote := newTestRemote(t, files)
+		g := newTestGitService(t, remote, 0)
+		g.resourceFileMode = channelconfig.ResourceFileRewrite
+
+		if _, err := g.migrateLayout(); err != nil {
+			t.Fatalf("migrateLayout() error = %v", err)
+		}
+		if _, content := remoteHead(t, remote, history); content != files[newer] {
+			t.Errorf("history = %q, want the latest entry %q", content, files[newer])
+		}
+	})
+}
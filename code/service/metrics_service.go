@@ -0,0 +1,13 @@
+package service
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"channelog/metrics"
+)
+
+// MetricsService exposes the registered metrics in the Prometheus text format.
+func MetricsService(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, "text/plain; version=0.0.4; charset=utf-8")
+	return metrics.Write(c)
+}
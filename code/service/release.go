@@ -0,0 +1,97 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	admissionv1 "k8s.io/api/admission/v1"
+
+	"channelog/queue"
+)
+
+// Labels and annotations that tie a resource to the release that applied it
+const (
+	argoTrackingAnnotation         = "argocd.argoproj.io/tracking-id"
+	argoInstanceLabel              = "argocd.argoproj.io/instance"
+	helmReleaseNameAnnotation      = "meta.helm.sh/release-name"
+	helmReleaseNamespaceAnnotation = "meta.helm.sh/release-namespace"
+	appInstanceLabel               = "app.kubernetes.io/instance"
+	releaseSourceArgoCD            = "Argo CD application"
+	releaseSourceHelm              = "Helm release"
+	releaseSourceAppInstance       = "instance"
+)
+
+// Release identifies a set of resources applied together, such as a Helm
+// release or an Argo CD application
+type Release struct {
+	// Source is the kind of release, e.g. Helm release
+	Source string
+
+	// Namespace is where the release lives; for Argo CD applications and
+	// instance labels it is the namespace of the resource
+	Namespace string
+	Name      string
+}
+
+// String names the release, e.g. Helm release prod/web
+func (r Release) String() string {
+	if r.Namespace == "" {
+		return fmt.Sprintf("%s %s", r.Source, r.Name)
+	}
+	return fmt.Sprintf("%s %s/%s", r.Source, r.Namespace, r.Name)
+}
+
+// releaseOf returns the release of the resource in a review, preferring the
+// Argo CD tracking annotation and instance label, then the Helm release
+// annotations and finally the app.kubernetes.io/instance label. ok is false
+// for resources without any of them.
+func releaseOf(review admissionv1.AdmissionReview) (release Release, ok bool) {
+	raw := review.Request.Object.Raw
+	if raw == nil {
+		// The final state of a deleted resource
+		raw = review.Request.OldObject.Raw
+	}
+	var obj struct {
+		Metadata struct {
+			Labels      map[string]string `json:"labels"`
+			Annotations map[string]string `json:"annotations"`
+		} `json:"metadata"`
+	}
+	if raw == nil || json.Unmarshal(raw, &obj) != nil {
+		return Release{}, false
+	}
+	labels, annotations := obj.Metadata.Labels, obj.Metadata.Annotations
+	namespace := review.Request.Namespace
+
+	// The tracking id is <application>:<group>/<kind>:<namespace>/<name>
+	if app, _, found := strings.Cut(annotations[argoTrackingAnnotation], ":"); found && app != "" {
+		return Release{Source: releaseSourceArgoCD, Namespace: namespace, Name: app}, true
+	}
+	if app := labels[argoInstanceLabel]; app != "" {
+		return Release{Source: releaseSourceArgoCD, Namespace: namespace, Name: app}, true
+	}
+	if name := annotations[helmReleaseNameAnnotation]; name != "" {
+		if ns := annotations[helmReleaseNamespaceAnnotation]; ns != "" {
+			namespace = ns
+		}
+		return Release{Source: releaseSourceHelm, Namespace: namespace, Name: name}, true
+	}
+	if instance := labels[appInstanceLabel]; instance != "" {
+		return Release{Source: releaseSourceAppInstance, Namespace: namespace, Name: instance}, true
+	}
+	return Release{}, false
+}
+
+// NewBatchKeyFunc returns a queue.BatchKeyFunc that batches the changes one
+// user makes to the resources of one release. Changes to resources without a
+// release are recorded on their own.
+func NewBatchKeyFunc() queue.BatchKeyFunc {
+	return func(item queue.Item) string {
+		release, ok := releaseOf(item.Review)
+		if !ok {
+			return ""
+		}
+		return item.Review.Request.UserInfo.Username + "\x00" + release.String()
+	}
+}
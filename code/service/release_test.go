@@ -0,0 +1,112 @@
+package service
+
+import (
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+
+	"channelog/queue"
+)
+
+// releaseReview is an update of ConfigMap prod/settings with the given labels
+// and annotations
+func releaseReview(t *testing.T, user string, labels, annotations map[string]any) admissionv1.AdmissionReview {
+	t.Helper()
+	obj := configMap("one")
+	metadata := obj["metadata"].(map[string]any)
+	metadata["labels"], metadata["annotations"] = labels, annotations
+	review := testReview(t, admissionv1.Update, obj, obj)
+	review.Request.UserInfo.Username = user
+	return review
+}
+
+func TestReleaseOf(t *testing.T) {
+	tests := []struct {
+		name        string
+		labels      map[string]any
+		annotations map[string]any
+		want        string
+	}{
+		{
+			name:        "Argo CD tracking id",
+			labels:      map[string]any{argoInstanceLabel: "other", appInstanceLabel: "web"},
+			annotations: map[string]any{argoTrackingAnnotation: "shop:/ConfigMap:prod/settings", helmReleaseNameAnnotation: "web"},
+			want:        "Argo CD application prod/shop",
+		},
+		{
+			name:   "Argo CD instance label",
+			labels: map[string]any{argoInstanceLabel: "shop", appInstanceLabel: "web"},
+			want:   "Argo CD application prod/shop",
+		},
+		{
+			name:        "Helm release in another namespace",
+			labels:      map[string]any{appInstanceLabel: "other"},
+			annotations: map[string]any{helmReleaseNameAnnotation: "web", helmReleaseNamespaceAnnotation: "releases"},
+			want:        "Helm release releases/web",
+		},
+		{
+			name:        "Helm release",
+			annotations: map[string]any{helmReleaseNameAnnotation: "web"},
+			want:        "Helm release prod/web",
+		},
+		{
+			name:   "instance label",
+			labels: map[string]any{appInstanceLabel: "web"},
+			want:   "instance prod/web",
+		},
+		{
+			name:        "empty tracking id",
+			annotations: map[string]any{argoTrackingAnnotation: ":/ConfigMap:prod/settings"},
+		},
+		{name: "no release"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			release, ok := releaseOf(releaseReview(t, "alice", tt.labels, tt.annotations))
+			if ok != (tt.want != "") {
+				t.Fatalf("releaseOf() ok = %v, want %v", ok, tt.want != "")
+			}
+			if ok && release.String() != tt.want {
+				t.Errorf("releaseOf() = %q, want %q", release, tt.want)
+			}
+		})
+	}
+}
+
+func TestReleaseOfDeletion(t *testing.T) {
+	review := testReview(t, admissionv1.Delete, map[string]any{
+		"metadata": map[string]any{"labels": map[string]any{appInstanceLabel: "web"}},
+	}, nil)
+	if release, ok := releaseOf(review); !ok || release.String() != "instance prod/web" {
+		t.Errorf("releaseOf() = %q, %v, want the release of the final state", release, ok)
+	}
+}
+
+func TestReleaseString(t *testing.T) {
+	if got := (Release{Source: releaseSourceHelm, Name: "web"}).String(); got != "Helm release web" {
+		t.Errorf("String() = %q, want %q", got, "Helm release web")
+	}
+}
+
+func TestBatchKeyFunc(t *testing.T) {
+	key := NewBatchKeyFunc()
+	helm := map[string]any{helmReleaseNameAnnotation: "web"}
+
+	alice := key(queue.Item{Review: releaseReview(t, "alice", nil, helm)})
+	if alice == "" {
+		t.Fatal("key of a release change is empty")
+	}
+	if again := key(queue.Item{Review: releaseReview(t, "alice", nil, helm)}); again != alice {
+		t.Errorf("key = %q, then %q", alice, again)
+	}
+	if bob := key(queue.Item{Review: releaseReview(t, "bob", nil, helm)}); bob == alice {
+		t.Error("changes by different users share a key")
+	}
+	other := map[string]any{helmReleaseNameAnnotation: "api"}
+	if got := key(queue.Item{Review: releaseReview(t, "alice", nil, other)}); got == alice {
+		t.Error("changes to different releases share a key")
+	}
+	if got := key(queue.Item{Review: releaseReview(t, "alice", nil, nil)}); got != "" {
+		t.Errorf("key of a change without a release = %q, want empty", got)
+	}
+}
@@ -58,10 +58,10 @@ k8s-deploy-update: ## Patch deployment.yaml with new image and rollout (ENV=$(PR
 	fi
 	kubectl apply -f $(DEPLOYMENT_FILE)
 	kubectl apply -f $(CONFIG_FILE)
-	kubectl -n $(K8S_NAMESPACE) rollout restart deployment/channelog
+	kubectl -n $(K8S_NAMESPACE) rollout restart statefulset/channelog
 
 	@echo "⏳ Waiting for rollout to finish…"
-	kubectl rollout status deployment/channelog -n $(K8S_NAMESPACE)
+	kubectl rollout status statefulset/channelog -n $(K8S_NAMESPACE)
 
 ## Regenerate certs, patch deployment, and rollout.
 k8s-deploy-full: cert-refresh k8s-deploy-update ## Regenerate certs, patch deployment, and rollout (ENV=$(PRODUCTION_ENV) uses deploy/, others use deploy/testenv/).